@@ -0,0 +1,154 @@
+// Package completionevents finds what changed on a zone between two fetches.
+package completionevents
+
+import (
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/tempushttp"
+	"time"
+)
+
+// TopRanks is how far down the leaderboard rank changes are reported. Below
+// it every new completion would move thousands of ranks.
+const TopRanks = 10
+
+type zoneClass struct {
+	MapID     uint64
+	ZoneType  tempushttp.ZoneType
+	ZoneIndex uint8
+	Class     tempushttp.ClassType
+}
+
+type playerZoneClass struct {
+	zoneClass
+	PlayerID uint64
+}
+
+// Diff compares freshly fetched zone class info and results against what was
+// stored before. Zone classes with no stored info have never been fetched, so
+// their results are not reported as new.
+func Diff(prevInfo, nextInfo []completionstore.ZoneClassInfo, prevResults, nextResults []completionstore.PlayerClassZoneResult, now time.Time) []completionstore.Event {
+	var events []completionstore.Event
+
+	known := make(map[zoneClass]completionstore.ZoneClassInfo, len(prevInfo))
+
+	for _, info := range prevInfo {
+		known[zoneClass{MapID: info.MapID, ZoneType: info.ZoneType, ZoneIndex: info.ZoneIndex, Class: info.Class}] = info
+	}
+
+	for _, info := range nextInfo {
+		prev, ok := known[zoneClass{MapID: info.MapID, ZoneType: info.ZoneType, ZoneIndex: info.ZoneIndex, Class: info.Class}]
+		if !ok || prev.Tier == info.Tier {
+			continue
+		}
+
+		events = append(events, completionstore.Event{
+			Type:      completionstore.EventTierChange,
+			Created:   now,
+			MapID:     info.MapID,
+			MapName:   info.MapName,
+			ZoneType:  info.ZoneType,
+			ZoneIndex: info.ZoneIndex,
+			Class:     info.Class,
+			OldTier:   prev.Tier,
+			NewTier:   info.Tier,
+		})
+	}
+
+	prev := make(map[playerZoneClass]completionstore.PlayerClassZoneResult, len(prevResults))
+
+	for _, r := range prevResults {
+		prev[keyOf(r)] = r
+	}
+
+	for _, r := range nextResults {
+		k := keyOf(r)
+
+		if _, ok := known[k.zoneClass]; !ok {
+			continue
+		}
+
+		event := completionstore.Event{
+			Created:     now,
+			MapID:       r.MapID,
+			MapName:     r.MapName,
+			ZoneType:    r.ZoneType,
+			ZoneIndex:   r.ZoneIndex,
+			Class:       r.Class,
+			PlayerID:    r.PlayerID,
+			Date:        r.Date,
+			NewRank:     r.Rank,
+			NewDuration: r.Duration,
+			OldTier:     r.Tier,
+			NewTier:     r.Tier,
+		}
+
+		p, ok := prev[k]
+
+		if ok {
+			event.OldRank = p.Rank
+			event.OldDuration = p.Duration
+		}
+
+		add := func(t completionstore.EventType) {
+			e := event
+			e.Type = t
+			events = append(events, e)
+		}
+
+		switch {
+		case !ok:
+			add(completionstore.EventNewCompletion)
+		case r.Duration < p.Duration:
+			add(completionstore.EventImprovedTime)
+		}
+
+		if ok && r.Rank != p.Rank && (r.Rank <= TopRanks || p.Rank <= TopRanks) {
+			add(completionstore.EventRankChange)
+		}
+
+		if r.Rank == 1 && (!ok || p.Rank != 1) {
+			add(completionstore.EventNewWR)
+		}
+
+		if r.Rank <= TopRanks && (!ok || p.Rank > TopRanks) {
+			add(completionstore.EventNewTopTen)
+		}
+	}
+
+	return events
+}
+
+// Changed returns the fetched results that are new, or whose run differs from
+// the stored one.
+func Changed(prevResults, nextResults []completionstore.PlayerClassZoneResult) []completionstore.PlayerClassZoneResult {
+	prev := make(map[playerZoneClass]completionstore.PlayerClassZoneResult, len(prevResults))
+
+	for _, r := range prevResults {
+		prev[keyOf(r)] = r
+	}
+
+	var changed []completionstore.PlayerClassZoneResult
+
+	for _, r := range nextResults {
+		p, ok := prev[keyOf(r)]
+		if ok && p.Duration == r.Duration && p.Date.Equal(r.Date) {
+			continue
+		}
+
+		changed = append(changed, r)
+	}
+
+	return changed
+}
+
+func keyOf(r completionstore.PlayerClassZoneResult) playerZoneClass {
+	return playerZoneClass{
+		zoneClass: zoneClass{
+			MapID:     r.MapID,
+			ZoneType:  r.ZoneType,
+			ZoneIndex: r.ZoneIndex,
+			Class:     r.Class,
+		},
+		PlayerID: r.PlayerID,
+	}
+}
@@ -0,0 +1,117 @@
+package completionevents_test
+
+import (
+	"tempus-completion/cmd/tempus-completion-fetcher/completionevents"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/tempushttp"
+	"testing"
+	"time"
+)
+
+func info(mapID uint64, tier uint8) completionstore.ZoneClassInfo {
+	return completionstore.ZoneClassInfo{
+		MapID:     mapID,
+		MapName:   "jump_test",
+		ZoneType:  tempushttp.ZoneTypeMap,
+		ZoneIndex: 1,
+		Class:     tempushttp.ClassTypeSoldier,
+		Tier:      tier,
+	}
+}
+
+func result(mapID, playerID uint64, rank uint32, seconds int) completionstore.PlayerClassZoneResult {
+	return completionstore.PlayerClassZoneResult{
+		MapID:     mapID,
+		MapName:   "jump_test",
+		ZoneType:  tempushttp.ZoneTypeMap,
+		ZoneIndex: 1,
+		Class:     tempushttp.ClassTypeSoldier,
+		PlayerID:  playerID,
+		Tier:      3,
+		Rank:      rank,
+		Duration:  time.Duration(seconds) * time.Second,
+	}
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Now()
+
+	prevInfo := []completionstore.ZoneClassInfo{info(1, 3)}
+	nextInfo := []completionstore.ZoneClassInfo{info(1, 4), info(2, 2)}
+
+	prevResults := []completionstore.PlayerClassZoneResult{
+		result(1, 100, 1, 60),
+		result(1, 101, 10, 90),
+		result(1, 102, 40, 200),
+	}
+
+	nextResults := []completionstore.PlayerClassZoneResult{
+		// 102 takes the record, pushing everyone else down
+		result(1, 102, 1, 55),
+		result(1, 100, 2, 60),
+		result(1, 101, 11, 90),
+		result(1, 103, 41, 300),
+		// zone 2 has never been fetched
+		result(2, 100, 1, 10),
+	}
+
+	events := completionevents.Diff(prevInfo, nextInfo, prevResults, nextResults, now)
+
+	type key struct {
+		eventType completionstore.EventType
+		playerID  uint64
+	}
+
+	got := make(map[key]completionstore.Event)
+	for _, e := range events {
+		got[key{e.Type, e.PlayerID}] = e
+	}
+
+	expected := []key{
+		{completionstore.EventTierChange, 0},
+		{completionstore.EventImprovedTime, 102},
+		{completionstore.EventRankChange, 102},
+		{completionstore.EventNewWR, 102},
+		{completionstore.EventNewTopTen, 102},
+		{completionstore.EventRankChange, 100},
+		{completionstore.EventRankChange, 101},
+		{completionstore.EventNewCompletion, 103},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+
+	for _, k := range expected {
+		if _, ok := got[k]; !ok {
+			t.Errorf("missing %s event for player %d", k.eventType, k.playerID)
+		}
+	}
+
+	if e := got[key{completionstore.EventTierChange, 0}]; e.OldTier != 3 || e.NewTier != 4 {
+		t.Errorf("expected tier change from 3 to 4, got %d to %d", e.OldTier, e.NewTier)
+	}
+
+	if e := got[key{completionstore.EventImprovedTime, 102}]; e.OldDuration != 200*time.Second || e.NewDuration != 55*time.Second || e.OldRank != 40 {
+		t.Errorf("unexpected improved time event %+v", e)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	prevResults := []completionstore.PlayerClassZoneResult{
+		result(1, 100, 1, 60),
+		result(1, 101, 2, 90),
+	}
+
+	nextResults := []completionstore.PlayerClassZoneResult{
+		result(1, 100, 2, 60),
+		result(1, 101, 1, 50),
+		result(1, 102, 3, 120),
+	}
+
+	changed := completionevents.Changed(prevResults, nextResults)
+
+	if len(changed) != 2 || changed[0].PlayerID != 101 || changed[1].PlayerID != 102 {
+		t.Fatalf("expected players 101 and 102 to change, got %+v", changed)
+	}
+}
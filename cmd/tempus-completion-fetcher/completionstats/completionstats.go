@@ -48,6 +48,121 @@ func AggregateMapStats(zones []completionstore.ZoneClassInfo) map[completionstor
 	return maps
 }
 
+type zoneClass struct {
+	ZoneType  tempushttp.ZoneType
+	ZoneIndex uint8
+}
+
+// MapStatsAggregator keeps AggregateMapStats up to date as zone class info
+// changes, recomputing only the maps that a change touches.
+type MapStatsAggregator struct {
+	zones map[completionstore.MapClass]map[zoneClass]completionstore.ZoneClassInfo
+	stats map[completionstore.MapClass]completionstore.MapClassStatsInfo
+}
+
+func NewMapStatsAggregator(zones []completionstore.ZoneClassInfo) *MapStatsAggregator {
+	a := &MapStatsAggregator{
+		zones: make(map[completionstore.MapClass]map[zoneClass]completionstore.ZoneClassInfo, 1430),
+		stats: make(map[completionstore.MapClass]completionstore.MapClassStatsInfo, 1430),
+	}
+
+	a.Apply(zones)
+
+	return a
+}
+
+// Stats returns the current stats per map and class. The map must not be
+// modified, and is only valid until the next call to Apply.
+func (a *MapStatsAggregator) Stats() map[completionstore.MapClass]completionstore.MapClassStatsInfo {
+	return a.stats
+}
+
+// Apply updates the stats with new or changed zone class info, where a tier
+// of zero removes the zone. It returns the names of the maps whose stats
+// changed, by map ID.
+func (a *MapStatsAggregator) Apply(changed []completionstore.ZoneClassInfo) map[uint64]string {
+	dirty := make(map[completionstore.MapClass]struct{})
+	names := make(map[uint64]string)
+
+	for _, info := range changed {
+		mc := completionstore.MapClass{
+			MapID: info.MapID,
+			Class: info.Class,
+		}
+
+		zc := zoneClass{
+			ZoneType:  info.ZoneType,
+			ZoneIndex: info.ZoneIndex,
+		}
+
+		zones, ok := a.zones[mc]
+		if !ok {
+			zones = make(map[zoneClass]completionstore.ZoneClassInfo)
+			a.zones[mc] = zones
+		}
+
+		prev, ok := zones[zc]
+
+		if info.Tier == 0 {
+			if !ok {
+				continue
+			}
+
+			delete(zones, zc)
+		} else {
+			// completion counts change on every fetch but do not
+			// contribute to the stats
+			if ok && prev.Tier == info.Tier && prev.MapName == info.MapName {
+				continue
+			}
+
+			zones[zc] = info
+		}
+
+		dirty[mc] = struct{}{}
+		names[info.MapID] = info.MapName
+	}
+
+	infos := make([]completionstore.ZoneClassInfo, 0, 16)
+
+	for mc := range dirty {
+		infos = infos[:0]
+
+		for _, info := range a.zones[mc] {
+			infos = append(infos, info)
+		}
+
+		if len(infos) == 0 {
+			delete(a.zones, mc)
+			delete(a.stats, mc)
+			continue
+		}
+
+		a.stats[mc] = AggregateMapStats(infos)[mc]
+	}
+
+	return names
+}
+
+// Rename changes the name of a map in its zone class info and stats.
+func (a *MapStatsAggregator) Rename(mapID uint64, name string) {
+	for mc, zones := range a.zones {
+		if mc.MapID != mapID {
+			continue
+		}
+
+		for zc, info := range zones {
+			info.MapName = name
+			zones[zc] = info
+		}
+
+		if stats, ok := a.stats[mc]; ok {
+			stats.MapName = name
+			a.stats[mc] = stats
+		}
+	}
+}
+
 type MapStatCalculator struct {
 	PlayerMapResults  map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult
 	MapClassStatsInfo map[completionstore.MapClass]completionstore.MapClassStatsInfo
@@ -0,0 +1,69 @@
+package completionstats_test
+
+import (
+	"reflect"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstats"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/tempushttp"
+	"testing"
+)
+
+func zoneClassInfo(mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, class tempushttp.ClassType, tier uint8) completionstore.ZoneClassInfo {
+	return completionstore.ZoneClassInfo{
+		MapID:     mapID,
+		MapName:   "jump_test",
+		ZoneType:  zoneType,
+		ZoneIndex: zoneIndex,
+		Class:     class,
+		Tier:      tier,
+	}
+}
+
+func TestMapStatsAggregatorApply(t *testing.T) {
+	initial := []completionstore.ZoneClassInfo{
+		zoneClassInfo(1, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeSoldier, 2),
+		zoneClassInfo(1, tempushttp.ZoneTypeBonus, 1, tempushttp.ClassTypeSoldier, 1),
+		zoneClassInfo(2, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeSoldier, 4),
+		zoneClassInfo(2, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeDemoman, 3),
+	}
+
+	a := completionstats.NewMapStatsAggregator(initial)
+
+	if !reflect.DeepEqual(a.Stats(), completionstats.AggregateMapStats(initial)) {
+		t.Fatalf("initial stats differ from a full aggregation")
+	}
+
+	changed := a.Apply([]completionstore.ZoneClassInfo{
+		// unchanged
+		zoneClassInfo(2, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeDemoman, 3),
+		// retiered
+		zoneClassInfo(1, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeSoldier, 3),
+		// removed
+		zoneClassInfo(1, tempushttp.ZoneTypeBonus, 1, tempushttp.ClassTypeSoldier, 0),
+		// added
+		zoneClassInfo(3, tempushttp.ZoneTypeCourse, 1, tempushttp.ClassTypeSoldier, 5),
+	})
+
+	if len(changed) != 2 || changed[1] == "" || changed[3] == "" {
+		t.Fatalf("expected maps 1 and 3 to change, got %v", changed)
+	}
+
+	expected := completionstats.AggregateMapStats([]completionstore.ZoneClassInfo{
+		zoneClassInfo(1, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeSoldier, 3),
+		zoneClassInfo(2, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeSoldier, 4),
+		zoneClassInfo(2, tempushttp.ZoneTypeMap, 1, tempushttp.ClassTypeDemoman, 3),
+		zoneClassInfo(3, tempushttp.ZoneTypeCourse, 1, tempushttp.ClassTypeSoldier, 5),
+	})
+
+	if !reflect.DeepEqual(a.Stats(), expected) {
+		t.Fatalf("expected %+v, got %+v", expected, a.Stats())
+	}
+
+	a.Rename(2, "jump_renamed")
+
+	for _, class := range []tempushttp.ClassType{tempushttp.ClassTypeSoldier, tempushttp.ClassTypeDemoman} {
+		if name := a.Stats()[completionstore.MapClass{MapID: 2, Class: class}].MapName; name != "jump_renamed" {
+			t.Fatalf("expected map 2 to be renamed, got %q", name)
+		}
+	}
+}
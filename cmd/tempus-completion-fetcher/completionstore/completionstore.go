@@ -1,11 +1,147 @@
 package completionstore
 
 import (
+	"context"
+	"embed"
 	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
 	"tempus-completion/tempushttp"
 	"time"
 )
 
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// MigrationsTable records the migrations applied to a SQL store.
+const MigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER NOT NULL,
+	name    TEXT    NOT NULL,
+	applied INTEGER NOT NULL,
+	PRIMARY KEY (version)
+);
+`
+
+// Migration is a schema change shared by the SQL stores. Once released a
+// migration is never edited, later changes go in a new one.
+type Migration struct {
+	Version int
+	Name    string
+	Query   string
+}
+
+// Migrations returns the migrations in migrations/, which are named
+// VERSION_NAME.sql and numbered from 1 without gaps.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+
+	for _, e := range entries {
+		version, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named VERSION_NAME.sql", e.Name())
+		}
+
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("parse migration version %s: %w", e.Name(), err)
+		}
+
+		if v != len(migrations)+1 {
+			return nil, fmt.Errorf("migration %s should be version %d", e.Name(), len(migrations)+1)
+		}
+
+		query, err := fs.ReadFile(migrationFiles, "migrations/"+e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", e.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version: v,
+			Name:    name,
+			Query:   string(query),
+		})
+	}
+
+	return migrations, nil
+}
+
+// Migrator is a store that records the migrations applied to it.
+type Migrator interface {
+	// AppliedMigrations returns when each applied migration was applied. It
+	// does not create schema_migrations.
+	AppliedMigrations(ctx context.Context) (map[int]time.Time, error)
+	// ApplyMigration runs the migration and records it, in one transaction.
+	ApplyMigration(ctx context.Context, m Migration, t time.Time) error
+}
+
+// MigrationStatus is a migration and when it was applied, zero if it is
+// pending.
+type MigrationStatus struct {
+	Migration
+	Applied time.Time
+}
+
+// GetMigrationStatus returns every migration in order. It fails if the store
+// has applied a migration this build does not know about.
+func GetMigrationStatus(ctx context.Context, m Migrator) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.AppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get applied migrations: %w", err)
+	}
+
+	for version := range applied {
+		if version > len(migrations) {
+			return nil, fmt.Errorf("store has migration %d applied, this build only knows %d", version, len(migrations))
+		}
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status = append(status, MigrationStatus{
+			Migration: migration,
+			Applied:   applied[migration.Version],
+		})
+	}
+
+	return status, nil
+}
+
+// Migrate applies the pending migrations in order and returns them.
+func Migrate(ctx context.Context, m Migrator, t time.Time) ([]Migration, error) {
+	status, err := GetMigrationStatus(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	for _, s := range status {
+		if !s.Applied.IsZero() {
+			continue
+		}
+
+		if err := m.ApplyMigration(ctx, s.Migration, t); err != nil {
+			return applied, fmt.Errorf("apply migration %d %s: %w", s.Version, s.Name, err)
+		}
+
+		applied = append(applied, s.Migration)
+	}
+
+	return applied, nil
+}
+
 type Zone struct {
 	MapName   string
 	MapID     uint64
@@ -13,6 +149,17 @@ type Zone struct {
 	ZoneIndex uint8
 }
 
+// ZoneSchedule is what the fetcher knows about a zone when deciding how soon
+// to refresh it. Zero times mean never.
+type ZoneSchedule struct {
+	Zone
+	Fetched           time.Time
+	Completions       uint32
+	FirstResult       time.Time
+	LastResult        time.Time
+	LastTrackedResult time.Time
+}
+
 type MapList struct {
 	Updated  time.Time
 	Response tempushttp.GetDetailedMapListResponse
@@ -131,3 +278,57 @@ type MapStats struct {
 	Demoman MapClassStats `json:"demoman"`
 	Soldier MapClassStats `json:"soldier"`
 }
+
+type EventType string
+
+const (
+	EventNewCompletion EventType = "new_completion"
+	EventImprovedTime  EventType = "improved_time"
+	EventRankChange    EventType = "rank_change"
+	EventNewWR         EventType = "new_wr"
+	EventNewTopTen     EventType = "new_top_10"
+	EventTierChange    EventType = "tier_change"
+)
+
+// Event is a change seen between two fetches of a zone. Tier changes have no
+// player, and only set the tier fields.
+type Event struct {
+	Type        EventType
+	Created     time.Time
+	MapID       uint64
+	MapName     string
+	ZoneType    tempushttp.ZoneType
+	ZoneIndex   uint8
+	Class       tempushttp.ClassType
+	PlayerID    uint64
+	Date        time.Time
+	OldRank     uint32
+	NewRank     uint32
+	OldDuration time.Duration
+	NewDuration time.Duration
+	OldTier     uint8
+	NewTier     uint8
+}
+
+// ResultHistory is one distinct run of a player on a zone, with the rank it
+// held when the fetcher first saw it.
+type ResultHistory struct {
+	Class    tempushttp.ClassType
+	Rank     uint32
+	Duration time.Duration
+	Date     time.Time
+	Observed time.Time
+}
+
+// ZoneCommit is everything a refresh of one zone stores. A commit with a zero
+// Fetched, such as a player backfill's, stores results on any number of zones
+// and leaves when they were fetched alone.
+type ZoneCommit struct {
+	Zone     Zone
+	Fetched  time.Time
+	Info     []ZoneClassInfo
+	Results  []PlayerClassZoneResult
+	History  []PlayerClassZoneResult
+	Events   []Event
+	SteamIDs map[string]uint64
+}
@@ -0,0 +1,76 @@
+-- The schema created by -initialize before there were migrations. IF NOT
+-- EXISTS lets those databases record it as applied without changes.
+
+CREATE TABLE IF NOT EXISTS kv (
+	key     TEXT     NOT NULL,
+	updated INTEGER  NOT NULL,
+	value   TEXT     NOT NULL,
+	PRIMARY KEY (key)
+);
+
+CREATE INDEX IF NOT EXISTS kv_updated_index
+ON kv (updated);
+
+CREATE TABLE IF NOT EXISTS steam_ids (
+	steam_id     TEXT    NOT NULL,
+	player_id    INTEGER NOT NULL,
+	PRIMARY KEY (steam_id)
+);
+
+CREATE TABLE IF NOT EXISTS zones (
+	map_id     INTEGER NOT NULL,
+	zone_type  TEXT    NOT NULL,
+	zone_index INTEGER NOT NULL,
+	map_name   TEXT    NOT NULL,
+	updated    INTEGER NOT NULL,
+	fetched    INTEGER NOT NULL,
+	PRIMARY KEY (map_id, zone_type, zone_index)
+);
+
+CREATE TABLE IF NOT EXISTS map_stats (
+	map_id        INTEGER NOT NULL,
+	map_name      TEXT    NOT NULL,
+	data          TEXT    NOT NULL,
+	PRIMARY KEY (map_id)
+);
+
+CREATE TABLE IF NOT EXISTS zone_class_info (
+	map_id        INTEGER NOT NULL,
+	zone_type     TEXT    NOT NULL,
+	zone_index    INTEGER NOT NULL,
+	class         INTEGER NOT NULL,
+	map_name      TEXT    NOT NULL,
+	custom_name   TEXT    NOT NULL,
+	tier          INTEGER NOT NULL,
+	completions   INTEGER NOT NULL,
+	PRIMARY KEY (map_id, zone_type, zone_index, class)
+);
+
+CREATE TABLE IF NOT EXISTS player_class_zone_results (
+	player_id   INTEGER NOT NULL,
+	map_id      INTEGER NOT NULL,
+	zone_type   TEXT    NOT NULL,
+	zone_index  INTEGER NOT NULL,
+	class       INTEGER NOT NULL,
+	custom_name TEXT    NOT NULL,
+	map_name    TEXT    NOT NULL,
+	tier        INTEGER NOT NULL,
+	updated     INTEGER NOT NULL,
+	rank        INTEGER NOT NULL,
+	duration    INTEGER NOT NULL,
+	date        INTEGER NOT NULL,
+	completions INTEGER NOT NULL,
+	PRIMARY KEY (player_id, map_id, zone_type, zone_index, class)
+);
+
+CREATE TABLE IF NOT EXISTS player_map_stats (
+	player_id                   INTEGER NOT NULL,
+	map_id                      INTEGER NOT NULL,
+	latest_update               INTEGER NOT NULL,
+	latest_processed_update     INTEGER NOT NULL,
+	data                        TEXT    NOT NULL,
+	PRIMARY KEY (player_id, map_id)
+);
+
+CREATE INDEX IF NOT EXISTS player_map_stats_times_index
+ON player_map_stats (latest_update, latest_processed_update, player_id, map_id);
@@ -0,0 +1,66 @@
+-- Zones, maps and results are retired instead of deleted, and the tables
+-- for history, change events and the job queue are added.
+
+ALTER TABLE zones ADD COLUMN retired INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE map_stats ADD COLUMN retired INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE zone_class_info ADD COLUMN retired INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE player_class_zone_results ADD COLUMN retired INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX player_class_zone_results_zone_index
+ON player_class_zone_results (map_id, zone_type, zone_index);
+
+CREATE TABLE player_class_zone_history (
+	player_id   INTEGER NOT NULL,
+	map_id      INTEGER NOT NULL,
+	zone_type   TEXT    NOT NULL,
+	zone_index  INTEGER NOT NULL,
+	class       INTEGER NOT NULL,
+	duration    INTEGER NOT NULL,
+	date        INTEGER NOT NULL,
+	rank        INTEGER NOT NULL,
+	observed    INTEGER NOT NULL,
+	PRIMARY KEY (player_id, map_id, zone_type, zone_index, class, duration, date)
+);
+
+CREATE TABLE events (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	created       INTEGER NOT NULL,
+	type          TEXT    NOT NULL,
+	map_id        INTEGER NOT NULL,
+	map_name      TEXT    NOT NULL,
+	zone_type     TEXT    NOT NULL,
+	zone_index    INTEGER NOT NULL,
+	class         INTEGER NOT NULL,
+	player_id     INTEGER NOT NULL,
+	date          INTEGER NOT NULL,
+	old_rank      INTEGER NOT NULL,
+	new_rank      INTEGER NOT NULL,
+	old_duration  INTEGER NOT NULL,
+	new_duration  INTEGER NOT NULL,
+	old_tier      INTEGER NOT NULL,
+	new_tier      INTEGER NOT NULL
+);
+
+CREATE INDEX events_created_index
+ON events (created);
+
+CREATE INDEX events_player_index
+ON events (player_id, created);
+
+CREATE TABLE jobs (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind       TEXT    NOT NULL,
+	target     INTEGER NOT NULL,
+	state      TEXT    NOT NULL,
+	attempts   INTEGER NOT NULL,
+	error      TEXT    NOT NULL,
+	created    INTEGER NOT NULL,
+	available  INTEGER NOT NULL,
+	finished   INTEGER NOT NULL
+);
+
+CREATE INDEX jobs_available_index
+ON jobs (state, available);
+
+CREATE INDEX jobs_target_index
+ON jobs (kind, target, state);
@@ -0,0 +1,40 @@
+-- Map names move to maps and zone names to zones. Info and results refer to
+-- them by map and zone, events keep the name the map had at the time.
+
+CREATE TABLE maps (
+	map_id INTEGER NOT NULL,
+	name   TEXT    NOT NULL,
+	PRIMARY KEY (map_id)
+);
+
+INSERT INTO maps (map_id, name)
+SELECT map_id, MAX(map_name) FROM zones GROUP BY map_id;
+
+INSERT OR IGNORE INTO maps (map_id, name)
+SELECT map_id, MAX(map_name) FROM zone_class_info GROUP BY map_id;
+
+INSERT OR IGNORE INTO maps (map_id, name)
+SELECT map_id, MAX(map_name) FROM player_class_zone_results GROUP BY map_id;
+
+INSERT OR IGNORE INTO maps (map_id, name)
+SELECT map_id, map_name FROM map_stats;
+
+ALTER TABLE zones ADD COLUMN custom_name TEXT NOT NULL DEFAULT '';
+
+UPDATE zones SET custom_name = COALESCE((
+	SELECT
+		MAX(custom_name)
+	FROM
+		zone_class_info
+	WHERE
+		zone_class_info.map_id = zones.map_id AND
+		zone_class_info.zone_type = zones.zone_type AND
+		zone_class_info.zone_index = zones.zone_index
+), '');
+
+ALTER TABLE zones DROP COLUMN map_name;
+ALTER TABLE map_stats DROP COLUMN map_name;
+ALTER TABLE zone_class_info DROP COLUMN map_name;
+ALTER TABLE zone_class_info DROP COLUMN custom_name;
+ALTER TABLE player_class_zone_results DROP COLUMN map_name;
+ALTER TABLE player_class_zone_results DROP COLUMN custom_name;
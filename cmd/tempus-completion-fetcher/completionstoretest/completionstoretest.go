@@ -0,0 +1,781 @@
+// Package completionstoretest checks that a completion store behaves like
+// the others. Every store's tests run it.
+package completionstoretest
+
+import (
+	"context"
+	"sort"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/tempushttp"
+	"testing"
+	"time"
+)
+
+// Store is everything the fetcher and statsd need of a store.
+type Store interface {
+	CommitZone(ctx context.Context, c completionstore.ZoneCommit) error
+	GetZoneSchedule(ctx context.Context, trackedPlayers []uint64) ([]completionstore.ZoneSchedule, error)
+	GetAllZoneClassInfo(ctx context.Context) ([]completionstore.ZoneClassInfo, error)
+	GetZoneClassInfo(ctx context.Context, zones []completionstore.Zone) ([]completionstore.ZoneClassInfo, error)
+	SetZonesFetched(ctx context.Context, zones []completionstore.Zone, t time.Time) error
+	InsertPlayerClassZoneResults(ctx context.Context, results []completionstore.PlayerClassZoneResult) error
+	GetZoneResults(ctx context.Context, zones []completionstore.Zone) ([]completionstore.PlayerClassZoneResult, error)
+	InsertEvents(ctx context.Context, events []completionstore.Event) error
+	InsertResultHistory(ctx context.Context, results []completionstore.PlayerClassZoneResult) error
+	GetPlayerZoneHistory(ctx context.Context, playerID, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, class tempushttp.ClassType) ([]completionstore.ResultHistory, error)
+	InsertZones(ctx context.Context, zones map[completionstore.Zone]struct{}) error
+	RetireZones(ctx context.Context, zones []completionstore.Zone, t time.Time) error
+	RetireMaps(ctx context.Context, mapIDs []uint64) error
+	RenameMaps(ctx context.Context, names map[uint64]string, t time.Time) error
+	InsertMapStats(ctx context.Context, stats map[uint64]completionstore.MapStatsInfo) error
+	SetPlayerMapsProcessed(ctx context.Context, maps []completionstore.StalePlayerMap) error
+	InsertPlayerMapStats(ctx context.Context, stats map[completionstore.PlayerMap]completionstore.PlayerMapStats) error
+	GetStalePlayerMaps(ctx context.Context) ([]completionstore.StalePlayerMap, error)
+	GetPlayerMapResults(ctx context.Context, playerMaps []completionstore.StalePlayerMap) (map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, error)
+	GetPlayerZones(ctx context.Context, playerID uint64) ([]completionstore.Zone, error)
+	GetPlayerResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error)
+	GetPlayerMapClassResults(ctx context.Context, playerID, mapID uint64, class tempushttp.ClassType) ([]completionstore.PlayerClassZoneResult, bool, error)
+	GetPlayerRecentResults(ctx context.Context, playerID uint64) ([]completionstore.PlayerClassZoneResult, bool, error)
+	GetPlayerClassZoneResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error)
+	InsertZoneClassInfo(ctx context.Context, info []completionstore.ZoneClassInfo) error
+	InsertMaps(ctx context.Context, list *completionstore.MapList) error
+	GetMaps(ctx context.Context) (*completionstore.MapList, error)
+	InsertSteamIDs(ctx context.Context, steamIDs map[string]uint64) error
+	GetPlayerBySteamID(ctx context.Context, steamID string) (uint64, bool, error)
+}
+
+// Run runs every check against stores returned by open, which must be empty
+// and have their schema created.
+func Run(t *testing.T, open func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Store)
+	}{
+		{"CommitZone", testCommitZone},
+		{"Staleness", testStaleness},
+		{"PlayerClassZoneResults", testPlayerClassZoneResults},
+		{"PlayerResults", testPlayerResults},
+		{"RetireAndRename", testRetireAndRename},
+		{"Names", testNames},
+		{"History", testHistory},
+		{"MapsAndSteamIDs", testMapsAndSteamIDs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+var (
+	now = time.UnixMilli(time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC).UnixMilli())
+
+	beefBonus = completionstore.Zone{MapID: 439, MapName: "jump_beef", ZoneType: tempushttp.ZoneTypeBonus, ZoneIndex: 1}
+	beefMap   = completionstore.Zone{MapID: 439, MapName: "jump_beef", ZoneType: tempushttp.ZoneTypeMap, ZoneIndex: 1}
+	beefTrick = completionstore.Zone{MapID: 439, MapName: "jump_beef", ZoneType: tempushttp.ZoneTypeTrick, ZoneIndex: 1}
+	rushMap   = completionstore.Zone{MapID: 512, MapName: "jump_rush", ZoneType: tempushttp.ZoneTypeMap, ZoneIndex: 1}
+)
+
+const (
+	player      = 59983
+	otherPlayer = 1234
+)
+
+func info(z completionstore.Zone, class tempushttp.ClassType, tier uint8, completions uint32) completionstore.ZoneClassInfo {
+	return completionstore.ZoneClassInfo{
+		MapID:       z.MapID,
+		ZoneType:    z.ZoneType,
+		ZoneIndex:   z.ZoneIndex,
+		Class:       class,
+		MapName:     z.MapName,
+		Tier:        tier,
+		Completions: completions,
+	}
+}
+
+func result(z completionstore.Zone, playerID uint64, class tempushttp.ClassType, tier uint8, rank uint32, date time.Time) completionstore.PlayerClassZoneResult {
+	return completionstore.PlayerClassZoneResult{
+		MapID:       z.MapID,
+		ZoneType:    z.ZoneType,
+		ZoneIndex:   z.ZoneIndex,
+		PlayerID:    playerID,
+		Class:       class,
+		MapName:     z.MapName,
+		Tier:        tier,
+		Updated:     now,
+		Rank:        rank,
+		Duration:    time.Duration(rank) * 10 * time.Second,
+		Date:        date,
+		Completions: 2,
+	}
+}
+
+// setup stores the zones of two maps, with info for both classes on each and
+// results of two players.
+func setup(t *testing.T, s Store) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	zones := map[completionstore.Zone]struct{}{beefBonus: {}, beefMap: {}, beefTrick: {}, rushMap: {}}
+
+	if err := s.InsertZones(ctx, zones); err != nil {
+		t.Fatalf("insert zones: %s", err)
+	}
+
+	infos := []completionstore.ZoneClassInfo{
+		info(beefBonus, tempushttp.ClassTypeSoldier, 2, 2),
+		info(beefBonus, tempushttp.ClassTypeDemoman, 3, 0),
+		info(beefMap, tempushttp.ClassTypeSoldier, 4, 1),
+		info(beefMap, tempushttp.ClassTypeDemoman, 0, 0),
+		info(beefTrick, tempushttp.ClassTypeSoldier, 1, 1),
+		info(rushMap, tempushttp.ClassTypeSoldier, 5, 1),
+	}
+
+	if err := s.InsertZoneClassInfo(ctx, infos); err != nil {
+		t.Fatalf("insert zone class info: %s", err)
+	}
+
+	results := []completionstore.PlayerClassZoneResult{
+		result(beefBonus, player, tempushttp.ClassTypeSoldier, 2, 1, now.Add(-3*time.Hour)),
+		result(beefBonus, otherPlayer, tempushttp.ClassTypeSoldier, 2, 2, now.Add(-2*time.Hour)),
+		result(beefMap, player, tempushttp.ClassTypeSoldier, 4, 1, now.Add(-time.Hour)),
+		result(beefTrick, player, tempushttp.ClassTypeSoldier, 1, 1, now),
+		result(rushMap, otherPlayer, tempushttp.ClassTypeSoldier, 5, 1, now.Add(-4*time.Hour)),
+	}
+
+	if err := s.InsertPlayerClassZoneResults(ctx, results); err != nil {
+		t.Fatalf("insert player class zone results: %s", err)
+	}
+}
+
+func findSchedule(schedule []completionstore.ZoneSchedule, z completionstore.Zone) (completionstore.ZoneSchedule, bool) {
+	for _, zs := range schedule {
+		if zs.Zone == z {
+			return zs, true
+		}
+	}
+
+	return completionstore.ZoneSchedule{}, false
+}
+
+func testCommitZone(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	setup(t, s)
+
+	r := result(beefBonus, player, tempushttp.ClassTypeDemoman, 3, 1, now.Add(-30*time.Minute))
+
+	c := completionstore.ZoneCommit{
+		Zone:    beefBonus,
+		Fetched: now,
+		Info: []completionstore.ZoneClassInfo{
+			info(beefBonus, tempushttp.ClassTypeSoldier, 2, 2),
+			info(beefBonus, tempushttp.ClassTypeDemoman, 3, 1),
+		},
+		Results: []completionstore.PlayerClassZoneResult{r},
+		History: []completionstore.PlayerClassZoneResult{r},
+		Events: []completionstore.Event{
+			{Type: completionstore.EventNewCompletion, Created: now, MapID: r.MapID, MapName: r.MapName, ZoneType: r.ZoneType, ZoneIndex: r.ZoneIndex, Class: r.Class, PlayerID: player, Date: r.Date, NewRank: 1},
+		},
+		SteamIDs: map[string]uint64{"STEAM_0:1:1": player},
+	}
+
+	if err := s.CommitZone(ctx, c); err != nil {
+		t.Fatalf("commit zone: %s", err)
+	}
+
+	schedule, err := s.GetZoneSchedule(ctx, []uint64{player})
+	if err != nil {
+		t.Fatalf("get zone schedule: %s", err)
+	}
+
+	if len(schedule) != 4 {
+		t.Fatalf("expected 4 zones, got %+v", schedule)
+	}
+
+	zs, _ := findSchedule(schedule, beefBonus)
+
+	expected := completionstore.ZoneSchedule{
+		Zone:              beefBonus,
+		Fetched:           now,
+		Completions:       3,
+		FirstResult:       now.Add(-3 * time.Hour),
+		LastResult:        now.Add(-30 * time.Minute),
+		LastTrackedResult: now.Add(-30 * time.Minute),
+	}
+
+	if !equalSchedule(zs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, zs)
+	}
+
+	zs, _ = findSchedule(schedule, rushMap)
+
+	if !zs.Fetched.IsZero() || !zs.LastTrackedResult.IsZero() || !zs.LastResult.Equal(now.Add(-4*time.Hour)) {
+		t.Fatalf("expected an unfetched zone with no tracked results, got %+v", zs)
+	}
+
+	results, err := s.GetZoneResults(ctx, []completionstore.Zone{beefBonus})
+	if err != nil {
+		t.Fatalf("get zone results: %s", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results on the bonus, got %+v", results)
+	}
+
+	infos, err := s.GetZoneClassInfo(ctx, []completionstore.Zone{beefBonus, beefMap})
+	if err != nil {
+		t.Fatalf("get zone class info: %s", err)
+	}
+
+	if len(infos) != 4 {
+		t.Fatalf("expected info including tier 0, got %+v", infos)
+	}
+
+	all, err := s.GetAllZoneClassInfo(ctx)
+	if err != nil {
+		t.Fatalf("get all zone class info: %s", err)
+	}
+
+	if len(all) != 5 {
+		t.Fatalf("expected info without tier 0, got %+v", all)
+	}
+
+	if playerID, ok, err := s.GetPlayerBySteamID(ctx, "STEAM_0:1:1"); err != nil || !ok || playerID != player {
+		t.Fatalf("unexpected player %d %v %v", playerID, ok, err)
+	}
+
+	history, err := s.GetPlayerZoneHistory(ctx, player, beefBonus.MapID, beefBonus.ZoneType, beefBonus.ZoneIndex, tempushttp.ClassTypeDemoman)
+	if err != nil || len(history) != 1 || !history[0].Date.Equal(r.Date) {
+		t.Fatalf("unexpected history %+v %v", history, err)
+	}
+
+	if err := s.SetZonesFetched(ctx, []completionstore.Zone{rushMap}, now); err != nil {
+		t.Fatalf("set zones fetched: %s", err)
+	}
+
+	schedule, _ = s.GetZoneSchedule(ctx, nil)
+
+	if zs, _ = findSchedule(schedule, rushMap); !zs.Fetched.Equal(now) {
+		t.Fatalf("expected the zone to be fetched, got %+v", zs)
+	}
+
+	// a commit without a fetch time only stores its results
+	backfilled := result(rushMap, player, tempushttp.ClassTypeDemoman, 2, 5, now.Add(-time.Minute))
+
+	if err := s.CommitZone(ctx, completionstore.ZoneCommit{Results: []completionstore.PlayerClassZoneResult{backfilled}}); err != nil {
+		t.Fatalf("commit zone: %s", err)
+	}
+
+	schedule, _ = s.GetZoneSchedule(ctx, nil)
+
+	if zs, _ = findSchedule(schedule, rushMap); !zs.Fetched.Equal(now) || !zs.LastResult.Equal(backfilled.Date) {
+		t.Fatalf("expected the zone to keep its fetch time and gain the result, got %+v", zs)
+	}
+}
+
+func equalSchedule(a, b completionstore.ZoneSchedule) bool {
+	return a.Zone == b.Zone &&
+		a.Fetched.Equal(b.Fetched) &&
+		a.Completions == b.Completions &&
+		a.FirstResult.Equal(b.FirstResult) &&
+		a.LastResult.Equal(b.LastResult) &&
+		a.LastTrackedResult.Equal(b.LastTrackedResult)
+}
+
+func stalePlayerMaps(t *testing.T, s Store) map[completionstore.PlayerMap]time.Time {
+	t.Helper()
+
+	stale, err := s.GetStalePlayerMaps(context.Background())
+	if err != nil {
+		t.Fatalf("get stale player maps: %s", err)
+	}
+
+	m := make(map[completionstore.PlayerMap]time.Time, len(stale))
+	for _, pm := range stale {
+		m[pm.PlayerMap] = pm.LatestUpdate
+	}
+
+	return m
+}
+
+func testStaleness(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	setup(t, s)
+
+	stale := stalePlayerMaps(t, s)
+
+	beef := completionstore.PlayerMap{PlayerID: player, MapID: beefBonus.MapID}
+
+	if len(stale) != 3 || !stale[beef].Equal(now) {
+		t.Fatalf("expected every player map to be stale, got %+v", stale)
+	}
+
+	processed := []completionstore.StalePlayerMap{{PlayerMap: beef, LatestUpdate: now}}
+
+	if err := s.SetPlayerMapsProcessed(ctx, processed); err != nil {
+		t.Fatalf("set player maps processed: %s", err)
+	}
+
+	stats := map[completionstore.PlayerMap]completionstore.PlayerMapStats{beef: {MapID: beef.MapID, MapName: "jump_beef"}}
+
+	if err := s.InsertPlayerMapStats(ctx, stats); err != nil {
+		t.Fatalf("insert player map stats: %s", err)
+	}
+
+	if _, ok := stalePlayerMaps(t, s)[beef]; ok {
+		t.Fatalf("expected processed stats not to be stale")
+	}
+
+	results, err := s.GetPlayerMapResults(ctx, processed)
+	if err != nil {
+		t.Fatalf("get player map results: %s", err)
+	}
+
+	// the trick's results are tier 1, the map's demoman info is tier 0 but
+	// there is no result on it
+	if len(results) != 1 || len(results[beef]) != 3 {
+		t.Fatalf("expected the player's results on the map, got %+v", results)
+	}
+
+	r := result(beefMap, player, tempushttp.ClassTypeSoldier, 4, 1, now.Add(-time.Minute))
+	r.Updated = now.Add(time.Minute)
+
+	if err := s.InsertPlayerClassZoneResults(ctx, []completionstore.PlayerClassZoneResult{r}); err != nil {
+		t.Fatalf("insert player class zone results: %s", err)
+	}
+
+	if updated := stalePlayerMaps(t, s)[beef]; !updated.Equal(r.Updated) {
+		t.Fatalf("expected a new result to make the stats stale, got %s", updated)
+	}
+
+	results, _ = s.GetPlayerMapResults(ctx, processed)
+
+	for _, got := range results[beef] {
+		if got.ZoneType == tempushttp.ZoneTypeMap && !got.Date.Equal(r.Date) {
+			t.Fatalf("expected the result to be updated, got %+v", got)
+		}
+	}
+}
+
+func sortResults(results []completionstore.PlayerClassZoneResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+
+		if a.MapID != b.MapID {
+			return a.MapID < b.MapID
+		}
+
+		if a.ZoneType != b.ZoneType {
+			return a.ZoneType < b.ZoneType
+		}
+
+		if a.ZoneIndex != b.ZoneIndex {
+			return a.ZoneIndex < b.ZoneIndex
+		}
+
+		return a.Class < b.Class
+	})
+}
+
+func testPlayerClassZoneResults(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	setup(t, s)
+
+	results, ok, err := s.GetPlayerClassZoneResults(ctx, player, []string{"map", "bonus"}, []uint8{0, 2, 3, 4, 5}, []uint8{3, 4})
+	if err != nil || !ok {
+		t.Fatalf("get player class zone results: %v %v", ok, err)
+	}
+
+	sortResults(results)
+
+	// every zone is returned, with the player's run where they have one
+	expected := []struct {
+		zone  completionstore.Zone
+		class tempushttp.ClassType
+		tier  uint8
+		rank  uint32
+	}{
+		{beefBonus, tempushttp.ClassTypeSoldier, 2, 1},
+		{beefBonus, tempushttp.ClassTypeDemoman, 3, 0},
+		{beefMap, tempushttp.ClassTypeSoldier, 4, 1},
+		{beefMap, tempushttp.ClassTypeDemoman, 0, 0},
+		{rushMap, tempushttp.ClassTypeSoldier, 5, 0},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), results)
+	}
+
+	for i, e := range expected {
+		r := results[i]
+
+		if r.MapID != e.zone.MapID || r.ZoneType != e.zone.ZoneType || r.Class != e.class || r.Tier != e.tier || r.Rank != e.rank || r.PlayerID != player || r.MapName != e.zone.MapName {
+			t.Fatalf("expected %+v at %d, got %+v", e, i, r)
+		}
+
+		if e.rank == 0 && r.Duration != 0 {
+			t.Fatalf("expected no run at %d, got %+v", i, r)
+		}
+	}
+
+	results, _, _ = s.GetPlayerClassZoneResults(ctx, player, []string{"bonus"}, []uint8{2}, []uint8{3})
+
+	if len(results) != 1 || results[0].Completions != 2 || results[0].Duration != 10*time.Second {
+		t.Fatalf("expected the filters to apply, got %+v", results)
+	}
+
+	if _, ok, _ := s.GetPlayerClassZoneResults(ctx, player, []string{"course"}, []uint8{2}, []uint8{3}); ok {
+		t.Fatalf("expected nothing to be found")
+	}
+
+	results, ok, err = s.GetPlayerMapClassResults(ctx, otherPlayer, beefMap.MapID, tempushttp.ClassTypeSoldier)
+	if err != nil || !ok {
+		t.Fatalf("get player map class results: %v %v", ok, err)
+	}
+
+	// the trick is left out, and the zone with a run comes first
+	if len(results) != 2 || results[0].ZoneType != tempushttp.ZoneTypeBonus || results[0].Rank != 2 || results[1].Rank != 0 {
+		t.Fatalf("unexpected map class results %+v", results)
+	}
+}
+
+func testPlayerResults(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	setup(t, s)
+
+	results, ok, err := s.GetPlayerResults(ctx, player, []string{"map", "bonus", "trick"}, []uint8{1, 2, 3, 4, 5}, []uint8{3, 4})
+	if err != nil || !ok {
+		t.Fatalf("get player results: %v %v", ok, err)
+	}
+
+	// newest first, without tricks
+	if len(results) != 2 || results[0].ZoneType != tempushttp.ZoneTypeMap || results[1].ZoneType != tempushttp.ZoneTypeBonus {
+		t.Fatalf("unexpected player results %+v", results)
+	}
+
+	if r := results[0]; r.PlayerID != player || r.Tier != 4 || r.Rank != 1 || r.Duration != 10*time.Second || !r.Date.Equal(now.Add(-time.Hour)) || r.Completions != 2 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+
+	if _, ok, _ := s.GetPlayerResults(ctx, player, []string{"map"}, []uint8{1}, []uint8{3}); ok {
+		t.Fatalf("expected the tier filter to apply")
+	}
+
+	many := make([]completionstore.PlayerClassZoneResult, 0, 12)
+	zones := make(map[completionstore.Zone]struct{}, 12)
+
+	for i := range 12 {
+		z := completionstore.Zone{MapID: 600, MapName: "jump_many", ZoneType: tempushttp.ZoneTypeCourse, ZoneIndex: uint8(i + 1)}
+		zones[z] = struct{}{}
+		many = append(many, result(z, player, tempushttp.ClassTypeDemoman, 3, 5, now.Add(time.Duration(i)*time.Minute)))
+	}
+
+	if err := s.InsertZones(ctx, zones); err != nil {
+		t.Fatalf("insert zones: %s", err)
+	}
+
+	if err := s.InsertPlayerClassZoneResults(ctx, many); err != nil {
+		t.Fatalf("insert player class zone results: %s", err)
+	}
+
+	recent, ok, err := s.GetPlayerRecentResults(ctx, player)
+	if err != nil || !ok {
+		t.Fatalf("get player recent results: %v %v", ok, err)
+	}
+
+	if len(recent) != 10 || recent[0].ZoneIndex != 12 || recent[9].ZoneIndex != 3 {
+		t.Fatalf("expected the 10 newest results, got %+v", recent)
+	}
+
+	playerZones, err := s.GetPlayerZones(ctx, player)
+	if err != nil {
+		t.Fatalf("get player zones: %s", err)
+	}
+
+	if len(playerZones) != 15 {
+		t.Fatalf("expected a zone for every result, got %+v", playerZones)
+	}
+
+	if _, ok, _ := s.GetPlayerRecentResults(ctx, 1); ok {
+		t.Fatalf("expected an unknown player to have no results")
+	}
+}
+
+func testRetireAndRename(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	setup(t, s)
+
+	beef := completionstore.PlayerMap{PlayerID: player, MapID: beefBonus.MapID}
+	rush := completionstore.PlayerMap{PlayerID: otherPlayer, MapID: rushMap.MapID}
+
+	processed := []completionstore.StalePlayerMap{
+		{PlayerMap: beef, LatestUpdate: now},
+		{PlayerMap: completionstore.PlayerMap{PlayerID: otherPlayer, MapID: beefBonus.MapID}, LatestUpdate: now},
+		{PlayerMap: rush, LatestUpdate: now},
+	}
+
+	if err := s.SetPlayerMapsProcessed(ctx, processed); err != nil {
+		t.Fatalf("set player maps processed: %s", err)
+	}
+
+	retiredAt := now.Add(time.Hour)
+
+	if err := s.RetireZones(ctx, []completionstore.Zone{beefMap}, retiredAt); err != nil {
+		t.Fatalf("retire zones: %s", err)
+	}
+
+	schedule, _ := s.GetZoneSchedule(ctx, nil)
+
+	if _, ok := findSchedule(schedule, beefMap); ok || len(schedule) != 3 {
+		t.Fatalf("expected the retired zone to be left out, got %+v", schedule)
+	}
+
+	stale := stalePlayerMaps(t, s)
+
+	if len(stale) != 2 || !stale[beef].Equal(retiredAt) {
+		t.Fatalf("expected every player on the map to be stale, got %+v", stale)
+	}
+
+	results, _, _ := s.GetPlayerResults(ctx, player, []string{"map", "bonus"}, []uint8{2, 4}, []uint8{3})
+
+	if len(results) != 1 || results[0].ZoneType != tempushttp.ZoneTypeBonus {
+		t.Fatalf("expected the retired result to be hidden, got %+v", results)
+	}
+
+	results, _, _ = s.GetPlayerClassZoneResults(ctx, player, []string{"map"}, []uint8{0, 4, 5}, []uint8{3, 4})
+
+	if len(results) != 1 || results[0].MapID != rushMap.MapID {
+		t.Fatalf("expected the retired info to be hidden, got %+v", results)
+	}
+
+	maps, _ := s.GetPlayerMapResults(ctx, []completionstore.StalePlayerMap{{PlayerMap: beef}})
+
+	if len(maps[beef]) != 2 {
+		t.Fatalf("expected the retired result to be left out, got %+v", maps)
+	}
+
+	if err := s.InsertZones(ctx, map[completionstore.Zone]struct{}{beefMap: {}}); err != nil {
+		t.Fatalf("insert zones: %s", err)
+	}
+
+	schedule, _ = s.GetZoneSchedule(ctx, nil)
+
+	if _, ok := findSchedule(schedule, beefMap); !ok {
+		t.Fatalf("expected the zone to be restored, got %+v", schedule)
+	}
+
+	renamedAt := now.Add(2 * time.Hour)
+
+	if err := s.RenameMaps(ctx, map[uint64]string{rushMap.MapID: "jump_rush_a2"}, renamedAt); err != nil {
+		t.Fatalf("rename maps: %s", err)
+	}
+
+	if stale := stalePlayerMaps(t, s); !stale[rush].Equal(renamedAt) {
+		t.Fatalf("expected the renamed map to be stale, got %+v", stale)
+	}
+
+	results, _, _ = s.GetPlayerMapClassResults(ctx, otherPlayer, rushMap.MapID, tempushttp.ClassTypeSoldier)
+
+	if len(results) != 1 || results[0].MapName != "jump_rush_a2" {
+		t.Fatalf("expected the info to be renamed, got %+v", results)
+	}
+
+	zones, _ := s.GetPlayerZones(ctx, otherPlayer)
+
+	for _, z := range zones {
+		if z.MapID == rushMap.MapID && z.MapName != "jump_rush_a2" {
+			t.Fatalf("expected the result to be renamed, got %+v", z)
+		}
+	}
+
+	schedule, _ = s.GetZoneSchedule(ctx, nil)
+
+	for _, zs := range schedule {
+		if zs.MapID == rushMap.MapID && zs.MapName != "jump_rush_a2" {
+			t.Fatalf("expected the zone to be renamed, got %+v", zs)
+		}
+	}
+
+	stats := map[uint64]completionstore.MapStatsInfo{rushMap.MapID: {MapName: "jump_rush_a2"}}
+
+	if err := s.InsertMapStats(ctx, stats); err != nil {
+		t.Fatalf("insert map stats: %s", err)
+	}
+
+	if err := s.RetireMaps(ctx, []uint64{rushMap.MapID}); err != nil {
+		t.Fatalf("retire maps: %s", err)
+	}
+}
+
+// testNames checks that names come from the zones and maps, whatever the
+// results were stored with.
+func testNames(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	setup(t, s)
+
+	soldier := info(beefBonus, tempushttp.ClassTypeSoldier, 2, 2)
+	soldier.CustomName = "the bonus"
+
+	if err := s.InsertZoneClassInfo(ctx, []completionstore.ZoneClassInfo{soldier}); err != nil {
+		t.Fatalf("insert zone class info: %s", err)
+	}
+
+	r := result(beefBonus, player, tempushttp.ClassTypeSoldier, 2, 1, now)
+	r.MapName = "jump_old"
+	r.CustomName = "old bonus"
+
+	if err := s.InsertPlayerClassZoneResults(ctx, []completionstore.PlayerClassZoneResult{r}); err != nil {
+		t.Fatalf("insert player class zone results: %s", err)
+	}
+
+	named := func(mapName, customName string, results []completionstore.PlayerClassZoneResult) bool {
+		for _, r := range results {
+			if r.MapID == beefBonus.MapID && r.ZoneType == beefBonus.ZoneType && (r.MapName != mapName || r.CustomName != customName) {
+				return false
+			}
+		}
+
+		return len(results) > 0
+	}
+
+	results, _ := s.GetZoneResults(ctx, []completionstore.Zone{beefBonus})
+	if !named("jump_beef", "the bonus", results) {
+		t.Fatalf("expected the zone's names, got %+v", results)
+	}
+
+	if err := s.RenameMaps(ctx, map[uint64]string{beefBonus.MapID: "jump_beef_final"}, now); err != nil {
+		t.Fatalf("rename maps: %s", err)
+	}
+
+	results, _, _ = s.GetPlayerRecentResults(ctx, player)
+	if !named("jump_beef_final", "the bonus", results) {
+		t.Fatalf("expected the renamed map, got %+v", results)
+	}
+
+	results, _, _ = s.GetPlayerClassZoneResults(ctx, player, []string{"bonus"}, []uint8{2, 3}, []uint8{3, 4})
+	if !named("jump_beef_final", "the bonus", results) {
+		t.Fatalf("expected the renamed map on the joined info, got %+v", results)
+	}
+
+	infos, _ := s.GetZoneClassInfo(ctx, []completionstore.Zone{beefBonus})
+
+	for _, info := range infos {
+		if info.MapName != "jump_beef_final" || info.CustomName != "the bonus" {
+			t.Fatalf("expected the info to be named, got %+v", infos)
+		}
+	}
+}
+
+func testHistory(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	first := result(beefBonus, player, tempushttp.ClassTypeSoldier, 2, 3, now.Add(-2*time.Hour))
+	first.Updated = now.Add(-time.Hour)
+
+	improved := result(beefBonus, player, tempushttp.ClassTypeSoldier, 2, 1, now.Add(-30*time.Minute))
+	improved.Duration = 5 * time.Second
+
+	// seen again later with a different rank
+	again := first
+	again.Rank = 4
+	again.Updated = now
+
+	if err := s.InsertResultHistory(ctx, []completionstore.PlayerClassZoneResult{first, improved}); err != nil {
+		t.Fatalf("insert result history: %s", err)
+	}
+
+	if err := s.InsertResultHistory(ctx, []completionstore.PlayerClassZoneResult{again}); err != nil {
+		t.Fatalf("insert result history: %s", err)
+	}
+
+	history, err := s.GetPlayerZoneHistory(ctx, player, beefBonus.MapID, beefBonus.ZoneType, beefBonus.ZoneIndex, tempushttp.ClassTypeSoldier)
+	if err != nil {
+		t.Fatalf("get player zone history: %s", err)
+	}
+
+	if len(history) != 2 {
+		t.Fatalf("expected 2 runs, got %+v", history)
+	}
+
+	if h := history[0]; h.Rank != 3 || !h.Observed.Equal(first.Updated) || !h.Date.Equal(first.Date) || h.Duration != first.Duration || h.Class != tempushttp.ClassTypeSoldier {
+		t.Fatalf("expected the first run as first observed, got %+v", h)
+	}
+
+	if h := history[1]; h.Rank != 1 || h.Duration != improved.Duration {
+		t.Fatalf("expected the improved run, got %+v", h)
+	}
+
+	if history, _ := s.GetPlayerZoneHistory(ctx, player, beefBonus.MapID, beefBonus.ZoneType, beefBonus.ZoneIndex, tempushttp.ClassTypeDemoman); len(history) != 0 {
+		t.Fatalf("expected no demoman history, got %+v", history)
+	}
+
+	events := []completionstore.Event{{Type: completionstore.EventTierChange, Created: now, MapID: beefBonus.MapID, MapName: beefBonus.MapName, ZoneType: beefBonus.ZoneType, ZoneIndex: beefBonus.ZoneIndex, Class: tempushttp.ClassTypeSoldier, OldTier: 2, NewTier: 3}}
+
+	if err := s.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("insert events: %s", err)
+	}
+}
+
+func testMapsAndSteamIDs(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	list, err := s.GetMaps(ctx)
+	if err != nil {
+		t.Fatalf("get maps: %s", err)
+	}
+
+	if !list.Updated.IsZero() || len(list.Response) != 0 {
+		t.Fatalf("expected no maps, got %+v", list)
+	}
+
+	list = &completionstore.MapList{
+		Updated: now,
+		Response: tempushttp.GetDetailedMapListResponse{
+			{ID: 439, Name: "jump_beef", TierInfo: tempushttp.DetailedMapListTierInfo{Soldier: 2, Demoman: 3}},
+		},
+	}
+
+	if err := s.InsertMaps(ctx, list); err != nil {
+		t.Fatalf("insert maps: %s", err)
+	}
+
+	list.Updated = now.Add(time.Hour)
+	list.Response[0].Name = "jump_beef_a2"
+
+	if err := s.InsertMaps(ctx, list); err != nil {
+		t.Fatalf("insert maps: %s", err)
+	}
+
+	got, err := s.GetMaps(ctx)
+	if err != nil {
+		t.Fatalf("get maps: %s", err)
+	}
+
+	if !got.Updated.Equal(list.Updated) || len(got.Response) != 1 || got.Response[0].Name != "jump_beef_a2" || got.Response[0].TierInfo.Demoman != 3 {
+		t.Fatalf("expected the latest maps, got %+v", got)
+	}
+
+	if err := s.InsertSteamIDs(ctx, map[string]uint64{"STEAM_0:1:1": player}); err != nil {
+		t.Fatalf("insert steam ids: %s", err)
+	}
+
+	if err := s.InsertSteamIDs(ctx, map[string]uint64{"STEAM_0:1:1": otherPlayer}); err != nil {
+		t.Fatalf("insert steam ids: %s", err)
+	}
+
+	if playerID, ok, err := s.GetPlayerBySteamID(ctx, "STEAM_0:1:1"); err != nil || !ok || playerID != player {
+		t.Fatalf("expected the first association to be kept, got %d %v %v", playerID, ok, err)
+	}
+
+	if _, ok, err := s.GetPlayerBySteamID(ctx, "STEAM_0:1:2"); err != nil || ok {
+		t.Fatalf("expected an unknown steam id not to be found, got %v %v", ok, err)
+	}
+}
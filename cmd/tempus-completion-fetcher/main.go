@@ -6,15 +6,27 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionevents"
 	"tempus-completion/cmd/tempus-completion-fetcher/completionstats"
 	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/mapreconcile"
 	"tempus-completion/cmd/tempus-completion-fetcher/rqlitecompletionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/sqlitecompletionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/zonescheduler"
+	"tempus-completion/httpserveutil"
+	"tempus-completion/jobqueue"
+	"tempus-completion/logutil"
 	"tempus-completion/tempushttp"
 	"tempus-completion/tempushttprpc"
+	"tempus-completion/tempusmetrics"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -31,105 +43,129 @@ type Store interface {
 	InsertSteamIDs(ctx context.Context, steamIDs map[string]uint64) error
 	InsertMapStats(ctx context.Context, stats map[uint64]completionstore.MapStatsInfo) error
 	GetAllZoneClassInfo(ctx context.Context) ([]completionstore.ZoneClassInfo, error)
-	InsertZoneClassInfo(ctx context.Context, info []completionstore.ZoneClassInfo) error
 	SetPlayerMapsProcessed(ctx context.Context, maps []completionstore.StalePlayerMap) error
 	InsertPlayerMapStats(ctx context.Context, stats map[completionstore.PlayerMap]completionstore.PlayerMapStats) error
 	GetStalePlayerMaps(ctx context.Context) ([]completionstore.StalePlayerMap, error)
 	GetPlayerMapResults(ctx context.Context, playerMaps []completionstore.StalePlayerMap) (map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, error)
-	SetZonesFetched(ctx context.Context, zones []completionstore.Zone, t time.Time) error
+	CommitZone(ctx context.Context, c completionstore.ZoneCommit) error
 	InsertPlayerClassZoneResults(ctx context.Context, results []completionstore.PlayerClassZoneResult) error
-	GetStaleZones(ctx context.Context, t time.Time) ([]completionstore.Zone, error)
+	GetZoneSchedule(ctx context.Context, trackedPlayers []uint64) ([]completionstore.ZoneSchedule, error)
+	GetZoneResults(ctx context.Context, zones []completionstore.Zone) ([]completionstore.PlayerClassZoneResult, error)
+	GetZoneClassInfo(ctx context.Context, zones []completionstore.Zone) ([]completionstore.ZoneClassInfo, error)
+	InsertResultHistory(ctx context.Context, results []completionstore.PlayerClassZoneResult) error
+	GetPlayerZones(ctx context.Context, playerID uint64) ([]completionstore.Zone, error)
 	InsertZones(ctx context.Context, zones map[completionstore.Zone]struct{}) error
+	RetireZones(ctx context.Context, zones []completionstore.Zone, t time.Time) error
+	RetireMaps(ctx context.Context, mapIDs []uint64) error
+	RenameMaps(ctx context.Context, names map[uint64]string, t time.Time) error
 	InsertMaps(ctx context.Context, maps *completionstore.MapList) error
 	GetMaps(ctx context.Context) (*completionstore.MapList, error)
+	completionstore.Migrator
 }
 
-type Fetcher struct {
-	client *tempushttprpc.Client
-	store  Store
-
-	maps  *completionstore.MapList
-	maps2 map[completionstore.MapClass]completionstore.MapClassStatsInfo
-
-	stdout io.Writer
-}
+// openStore opens the store at addr, either an rqlite address or
+// sqlite:///path/to/file. rqlite writes are sent in chunks of chunkSize
+// statements.
+func openStore(addr string, chunkSize int, logger *slog.Logger) (Store, jobqueue.Queue, error) {
+	if path, ok := strings.CutPrefix(addr, "sqlite://"); ok {
+		db, err := sqlitecompletionstore.New(path, sqlitecompletionstore.WithLogger(logger))
+		if err != nil {
+			return nil, nil, fmt.Errorf("new sqlite store: %w", err)
+		}
 
-func (f *Fetcher) UpdateMaps(ctx context.Context) error {
-	response, err := f.client.GetDetailedMapList(ctx)
-	if err != nil {
-		return fmt.Errorf("get detailed map list: %w", err)
+		return db, db.Jobs(), nil
 	}
 
-	list := &completionstore.MapList{
-		Updated:  time.Now(),
-		Response: response,
+	db, err := rqlitecompletionstore.New(
+		addr,
+		rqlitecompletionstore.WithLogger(logger),
+		rqlitecompletionstore.WithWriteChunkSize(chunkSize),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new rqlite store: %w", err)
 	}
 
-	if err := f.store.InsertMaps(ctx, list); err != nil {
-		return fmt.Errorf("insert maps: %w", err)
-	}
+	return db, db.Jobs(), nil
+}
 
-	f.maps = list
+type Fetcher struct {
+	client *tempushttprpc.Client
+	store  Store
 
-	const estzones = 3000
+	maps      *completionstore.MapList
+	mapStats  *completionstats.MapStatsAggregator
+	scheduler *zonescheduler.Scheduler
 
-	zones := make(map[completionstore.Zone]struct{}, estzones)
+	trackedPlayers map[uint64]struct{}
 
-	for _, r := range response {
-		for i := 0; i < r.ZoneCounts.Bonus; i++ {
-			zone := completionstore.Zone{
-				MapID:     uint64(r.ID),
-				MapName:   r.Name,
-				ZoneType:  tempushttp.ZoneTypeBonus,
-				ZoneIndex: uint8(i + 1),
-			}
+	concurrency  int
+	mapsInterval time.Duration
+	zonePageSize uint32
+	zoneBatch    int
 
-			zones[zone] = struct{}{}
-		}
+	// mapsIncomplete is set while the changes from a new map list have not
+	// all been stored, so that a failed update fetches the list again
+	// instead of asking whether it changed.
+	mapsIncomplete bool
 
-		for i := 0; i < r.ZoneCounts.Map; i++ {
-			zone := completionstore.Zone{
-				MapID:     uint64(r.ID),
-				MapName:   r.Name,
-				ZoneType:  tempushttp.ZoneTypeMap,
-				ZoneIndex: uint8(i + 1),
-			}
+	mu        sync.Mutex
+	status    Status
+	forceMaps bool
+	wake      chan struct{}
 
-			zones[zone] = struct{}{}
-		}
+	jobs     jobqueue.Queue
+	jobLease time.Duration
 
-		for i := 0; i < r.ZoneCounts.Course; i++ {
-			zone := completionstore.Zone{
-				MapID:     uint64(r.ID),
-				MapName:   r.Name,
-				ZoneType:  tempushttp.ZoneTypeCourse,
-				ZoneIndex: uint8(i + 1),
-			}
+	logger *slog.Logger
+}
 
-			zones[zone] = struct{}{}
-		}
+// Status is what the fetcher reports about itself on the admin server.
+type Status struct {
+	Iteration     int       `json:"iteration"`
+	Running       bool      `json:"running"`
+	Paused        bool      `json:"paused"`
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished"`
+	LastError     string    `json:"last_error"`
+	LastErrorTime time.Time `json:"last_error_time"`
+	MapsUpdated   time.Time `json:"maps_updated"`
+	Zones         int       `json:"zones"`
+	DueZones      int       `json:"due_zones"`
+
+	Job *jobqueue.Job `json:"job"`
+}
 
-		for i := 0; i < r.ZoneCounts.Trick; i++ {
-			zone := completionstore.Zone{
-				MapID:     uint64(r.ID),
-				MapName:   r.Name,
-				ZoneType:  tempushttp.ZoneTypeTrick,
-				ZoneIndex: uint8(i + 1),
-			}
+type refreshResponse struct {
+	Zones int `json:"zones"`
+}
 
-			zones[zone] = struct{}{}
-		}
+func (f *Fetcher) UpdateMaps(ctx context.Context) error {
+	modified, err := f.updateMapList(ctx)
+	if err != nil {
+		return err
 	}
 
-	if err := f.store.InsertZones(ctx, zones); err != nil {
-		return fmt.Errorf("insert zones: %w", err)
+	if !modified {
+		f.logger.InfoContext(ctx, "maps unchanged")
 	}
 
-	fmt.Fprintf(f.stdout, "inserted %d maps\n", len(response))
+	return nil
+}
+
+// mapStatsInfo collects the stats of the given maps. Maps without any zones
+// with tiers get empty stats.
+func (f *Fetcher) mapStatsInfo(mapIDs map[uint64]string) map[uint64]completionstore.MapStatsInfo {
+	mapStats := make(map[uint64]completionstore.MapStatsInfo, len(mapIDs))
 
-	mapStats := make(map[uint64]completionstore.MapStatsInfo)
+	for mapID, mapName := range mapIDs {
+		mapStats[mapID] = completionstore.MapStatsInfo{MapName: mapName}
+	}
+
+	for mc, mapClassStats := range f.mapStats.Stats() {
+		if _, ok := mapIDs[mc.MapID]; !ok {
+			continue
+		}
 
-	for mc, mapClassStats := range f.maps2 {
 		s := mapStats[mc.MapID]
 		s.MapName = mapClassStats.MapName
 
@@ -153,23 +189,161 @@ func (f *Fetcher) UpdateMaps(ctx context.Context) error {
 		mapStats[mc.MapID] = s
 	}
 
-	if err := f.store.InsertMapStats(ctx, mapStats); err != nil {
-		return fmt.Errorf("insert map stats: %w", err)
+	return mapStats
+}
+
+// updateMapList fetches the detailed map list and stores the maps and zones
+// it describes, unless it is unchanged since the last fetch.
+func (f *Fetcher) updateMapList(ctx context.Context) (bool, error) {
+	var (
+		response tempushttp.GetDetailedMapListResponse
+		modified = true
+		err      error
+	)
+
+	if len(f.maps.Response) == 0 || f.mapsIncomplete {
+		response, err = f.client.GetDetailedMapList(ctx)
+	} else {
+		response, modified, err = f.client.GetDetailedMapListIfModified(ctx)
 	}
 
-	return nil
+	if err != nil {
+		return false, fmt.Errorf("get detailed map list: %w", err)
+	}
+
+	if !modified {
+		f.maps.Updated = time.Now()
+		return false, nil
+	}
+
+	changes := mapreconcile.Reconcile(f.maps.Response, response)
+
+	// the list is stored last, the changes are reconciled against the stored
+	// list again if any of them fail
+	f.mapsIncomplete = true
+
+	if err := f.store.InsertZones(ctx, changes.Zones); err != nil {
+		return false, fmt.Errorf("insert zones: %w", err)
+	}
+
+	// the stats of other maps are saved as their zone class info changes
+	if len(changes.AddedMaps) > 0 {
+		names := make(map[uint64]string, len(response))
+
+		for _, m := range response {
+			names[uint64(m.ID)] = m.Name
+		}
+
+		added := make(map[uint64]string, len(changes.AddedMaps))
+
+		for _, mapID := range changes.AddedMaps {
+			added[mapID] = names[mapID]
+		}
+
+		if err := f.store.InsertMapStats(ctx, f.mapStatsInfo(added)); err != nil {
+			return false, fmt.Errorf("insert map stats: %w", err)
+		}
+	}
+
+	now := time.Now()
+
+	if len(changes.Renames) > 0 {
+		names := make(map[uint64]string, len(changes.Renames))
+
+		for _, r := range changes.Renames {
+			names[r.MapID] = r.NewName
+			f.mapStats.Rename(r.MapID, r.NewName)
+
+			f.logger.InfoContext(ctx, "map renamed", "map_id", r.MapID, "old_name", r.OldName, "new_name", r.NewName)
+		}
+
+		if err := f.store.RenameMaps(ctx, names, now); err != nil {
+			return false, fmt.Errorf("rename maps: %w", err)
+		}
+	}
+
+	if len(changes.RemovedZones) > 0 {
+		if err := f.store.RetireZones(ctx, changes.RemovedZones, now); err != nil {
+			return false, fmt.Errorf("retire zones: %w", err)
+		}
+
+		// a tier of zero leaves the zones out of the map stats
+		removed := make([]completionstore.ZoneClassInfo, 0, 2*len(changes.RemovedZones))
+
+		for _, z := range changes.RemovedZones {
+			for _, class := range []tempushttp.ClassType{tempushttp.ClassTypeSoldier, tempushttp.ClassTypeDemoman} {
+				removed = append(removed, completionstore.ZoneClassInfo{
+					MapID:     z.MapID,
+					MapName:   z.MapName,
+					ZoneType:  z.ZoneType,
+					ZoneIndex: z.ZoneIndex,
+					Class:     class,
+				})
+			}
+		}
+
+		if err := f.applyZoneClassInfo(ctx, removed); err != nil {
+			return false, fmt.Errorf("apply zone class info: %w", err)
+		}
+	}
+
+	if len(changes.RemovedMaps) > 0 {
+		if err := f.store.RetireMaps(ctx, changes.RemovedMaps); err != nil {
+			return false, fmt.Errorf("retire maps: %w", err)
+		}
+	}
+
+	list := &completionstore.MapList{
+		Updated:  time.Now(),
+		Response: response,
+	}
+
+	if err := f.store.InsertMaps(ctx, list); err != nil {
+		return false, fmt.Errorf("insert maps: %w", err)
+	}
+
+	f.maps = list
+	f.mapsIncomplete = false
+
+	f.scheduler.Sync(changes.Zones, now)
+
+	if len(changes.RemovedZones) > 0 || len(changes.RemovedMaps) > 0 {
+		f.logger.InfoContext(ctx, "retired zones and maps", "zones", len(changes.RemovedZones), "maps", len(changes.RemovedMaps))
+	}
+
+	f.logger.InfoContext(ctx, "inserted maps", "maps", len(response))
+
+	return true, nil
 }
 
 func (f *Fetcher) Run(ctx context.Context) (bool, error) {
-	if time.Since(f.maps.Updated) > 24*time.Hour {
-		fmt.Fprintln(f.stdout, "maps data out-of-date, updating")
+	f.mu.Lock()
+	forced := f.forceMaps
+	f.forceMaps = false
+	f.mu.Unlock()
+
+	if forced || time.Since(f.maps.Updated) > f.mapsInterval {
+		f.logger.InfoContext(ctx, "updating maps", "forced", forced, "updated", f.maps.Updated)
 
 		if err := f.UpdateMaps(ctx); err != nil {
 			return false, fmt.Errorf("update maps: %w", err)
 		}
 	}
 
-	ok, err := f.updateRawPlayerCompletionsNew(ctx)
+	job, ok, err := f.jobs.Claim(ctx, time.Now(), f.jobLease)
+	if err != nil {
+		return false, fmt.Errorf("claim job: %w", err)
+	}
+
+	if ok {
+		if err := f.runJob(ctx, job); err != nil {
+			return false, fmt.Errorf("run job %d: %w", job.ID, err)
+		}
+
+		return true, nil
+	}
+
+	ok, err = f.updateRawPlayerCompletionsNew(ctx)
 	if err != nil {
 		return false, fmt.Errorf("update raw player completions: %w", err)
 	}
@@ -187,363 +361,1255 @@ func (f *Fetcher) Run(ctx context.Context) (bool, error) {
 }
 
 type zoneResults struct {
+	Zone               completionstore.Zone
+	Err                error
 	Demoman            completionstore.ZoneClassInfo
 	Soldier            completionstore.ZoneClassInfo
 	PlayerClassResults []completionstore.PlayerClassZoneResult
 	SteamIDs           map[string]uint64
 }
 
-func (f *Fetcher) fetchPlayerClassZoneResults(ctx context.Context, zones []completionstore.Zone) ([]zoneResults, error) {
-	estsize := len(zones)
-
-	in := make(chan completionstore.Zone, estsize)
-	out := make(chan zoneResults, estsize)
-	defer close(out)
+// fetchZone streams a zone's records a page at a time. Pages are ordered by
+// rank rather than date, so every page has to be read to find new completions.
+func (f *Fetcher) fetchZone(ctx context.Context, data completionstore.Zone, updated time.Time) (zoneResults, error) {
+	zr := zoneResults{
+		Zone:     data,
+		SteamIDs: make(map[string]uint64),
+	}
 
-	g, ctx := errgroup.WithContext(ctx)
+	type playerClass struct {
+		playerID uint64
+		class    tempushttp.ClassType
+	}
 
-	updated := time.Now()
+	// a record set while paging can push a player onto the next page too
+	seen := make(map[playerClass]struct{})
+	found := make(map[tempushttp.ClassType]int)
 
-	for i := 0; i < 8; i++ {
-		g.Go(func() error {
-			for data := range in {
-				// change to 1 for fast zone refreshes
-				const limit = 0
+	add := func(r tempushttp.CompletionResult, info completionstore.ZoneClassInfo) {
+		key := playerClass{playerID: uint64(r.PlayerInfo.ID), class: info.Class}
 
-				ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-				response, err := f.client.GetZoneRecords(ctx, data.MapID, data.ZoneType, data.ZoneIndex, limit)
-				cancel()
+		if _, ok := seen[key]; ok {
+			return
+		}
 
-				if err != nil {
-					return fmt.Errorf("get zone records: %w", err)
-				}
+		seen[key] = struct{}{}
+		found[info.Class]++
+
+		result := completionstore.PlayerClassZoneResult{
+			MapID:       info.MapID,
+			ZoneType:    info.ZoneType,
+			ZoneIndex:   info.ZoneIndex,
+			PlayerID:    key.playerID,
+			Class:       info.Class,
+			CustomName:  info.CustomName,
+			MapName:     data.MapName,
+			Tier:        info.Tier,
+			Updated:     updated,
+			Rank:        uint32(r.Rank),
+			Duration:    time.Duration(float64(time.Second) * r.Duration),
+			Date:        time.Unix(int64(r.Date), 0),
+			Completions: info.Completions,
+		}
 
-				ns := len(response.Results.Soldier)
-				nd := len(response.Results.Demoman)
+		zr.PlayerClassResults = append(zr.PlayerClassResults, result)
+		zr.SteamIDs[r.SteamID] = result.PlayerID
+	}
 
-				if ns != response.CompletionInfo.Soldier {
-					fmt.Fprintf(f.stdout, "response expects %d soldier completions, found %d\n", response.CompletionInfo.Soldier, ns)
+	first := true
 
-					ns = response.CompletionInfo.Soldier
-				}
+	for response, err := range f.client.ZoneRecordPages(ctx, data.MapID, data.ZoneType, data.ZoneIndex, f.zonePageSize) {
+		if err != nil {
+			return zoneResults{}, err
+		}
 
-				if nd != response.CompletionInfo.Demoman {
-					fmt.Fprintf(f.stdout, "response expects %d demoman completions, found %d\n", response.CompletionInfo.Demoman, nd)
+		if first {
+			first = false
+
+			mapID := response.ZoneInfo.MapID
+			zoneType := tempushttp.ZoneType(response.ZoneInfo.Type)
+			zoneIndex := uint8(response.ZoneInfo.Zoneindex)
+			customName := response.ZoneInfo.CustomName
+
+			zr.Demoman = completionstore.ZoneClassInfo{
+				MapID:       mapID,
+				MapName:     data.MapName,
+				ZoneType:    zoneType,
+				ZoneIndex:   zoneIndex,
+				Class:       tempushttp.ClassTypeDemoman,
+				CustomName:  customName,
+				Tier:        uint8(response.TierInfo.Demoman),
+				Completions: uint32(response.CompletionInfo.Demoman),
+			}
 
-					nd = response.CompletionInfo.Demoman
-				}
+			zr.Soldier = completionstore.ZoneClassInfo{
+				MapID:       mapID,
+				MapName:     data.MapName,
+				ZoneType:    zoneType,
+				ZoneIndex:   zoneIndex,
+				Class:       tempushttp.ClassTypeSoldier,
+				CustomName:  customName,
+				Tier:        uint8(response.TierInfo.Soldier),
+				Completions: uint32(response.CompletionInfo.Soldier),
+			}
 
-				results := make([]completionstore.PlayerClassZoneResult, 0, ns+nd)
-
-				steamIDs := make(map[string]uint64)
-
-				mapID := response.ZoneInfo.MapID
-				zoneType := tempushttp.ZoneType(response.ZoneInfo.Type)
-				zoneIndex := uint8(response.ZoneInfo.Zoneindex)
-				customName := response.ZoneInfo.CustomName
-
-				for _, r := range response.Results.Soldier {
-					result := completionstore.PlayerClassZoneResult{
-						MapID:       mapID,
-						ZoneType:    zoneType,
-						ZoneIndex:   zoneIndex,
-						PlayerID:    uint64(r.PlayerInfo.ID),
-						Class:       tempushttp.ClassTypeSoldier,
-						CustomName:  customName,
-						MapName:     data.MapName,
-						Tier:        uint8(response.TierInfo.Soldier),
-						Updated:     updated,
-						Rank:        uint32(r.Rank),
-						Duration:    time.Duration(float64(time.Second) * r.Duration),
-						Date:        time.Unix(int64(r.Date), 0),
-						Completions: uint32(ns),
-					}
-
-					results = append(results, result)
-					steamIDs[r.SteamID] = result.PlayerID
-				}
+			zr.PlayerClassResults = make([]completionstore.PlayerClassZoneResult, 0, response.CompletionInfo.Soldier+response.CompletionInfo.Demoman)
+		}
 
-				for _, r := range response.Results.Demoman {
-					result := completionstore.PlayerClassZoneResult{
-						MapID:       mapID,
-						ZoneType:    zoneType,
-						ZoneIndex:   zoneIndex,
-						PlayerID:    uint64(r.PlayerInfo.ID),
-						Class:       tempushttp.ClassTypeDemoman,
-						CustomName:  customName,
-						MapName:     data.MapName,
-						Tier:        uint8(response.TierInfo.Demoman),
-						Updated:     updated,
-						Rank:        uint32(r.Rank),
-						Duration:    time.Duration(float64(time.Second) * r.Duration),
-						Date:        time.Unix(int64(r.Date), 0),
-						Completions: uint32(nd),
-					}
-
-					results = append(results, result)
-					steamIDs[r.SteamID] = result.PlayerID
-				}
+		for _, r := range response.Results.Soldier {
+			add(r, zr.Soldier)
+		}
 
-				zr := zoneResults{
-					Demoman: completionstore.ZoneClassInfo{
-						MapID:       mapID,
-						MapName:     data.MapName,
-						ZoneType:    zoneType,
-						ZoneIndex:   zoneIndex,
-						Class:       tempushttp.ClassTypeDemoman,
-						CustomName:  customName,
-						Tier:        uint8(response.TierInfo.Demoman),
-						Completions: uint32(nd),
-					},
-					Soldier: completionstore.ZoneClassInfo{
-						MapID:       mapID,
-						MapName:     data.MapName,
-						ZoneType:    zoneType,
-						ZoneIndex:   zoneIndex,
-						Class:       tempushttp.ClassTypeSoldier,
-						CustomName:  customName,
-						Tier:        uint8(response.TierInfo.Soldier),
-						Completions: uint32(ns),
-					},
-					PlayerClassResults: results,
-					SteamIDs:           steamIDs,
-				}
+		for _, r := range response.Results.Demoman {
+			add(r, zr.Demoman)
+		}
+	}
 
-				out <- zr
-			}
+	if ns := found[tempushttp.ClassTypeSoldier]; ns != int(zr.Soldier.Completions) {
+		f.logger.WarnContext(ctx, "unexpected number of completions", zoneArgs(data, "class", "soldier", "expected", zr.Soldier.Completions, "found", ns)...)
+	}
 
-			return nil
-		})
+	if nd := found[tempushttp.ClassTypeDemoman]; nd != int(zr.Demoman.Completions) {
+		f.logger.WarnContext(ctx, "unexpected number of completions", zoneArgs(data, "class", "demoman", "expected", zr.Demoman.Completions, "found", nd)...)
 	}
 
-	start := time.Now()
-	for _, z := range zones {
-		in <- z
+	return zr, nil
+}
+
+func (f *Fetcher) updateRawPlayerCompletionsNew(ctx context.Context) (bool, error) {
+	now := time.Now()
+
+	zones := f.scheduler.Due(now, f.zoneBatch)
+
+	f.logger.InfoContext(ctx, "found due zones", "due", len(zones), "zones", f.scheduler.Len())
+
+	if len(zones) == 0 {
+		return false, nil
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
+	return f.refreshZones(ctx, zones, now)
+}
 
-	done := ctx.Done()
+// refreshZones fetches the zones and stores each one as soon as it arrives.
+// Once ctx is done no more zones are started, but zones already being fetched
+// are finished and stored, so that nothing fetched is lost on shutdown. Zones
+// that could not be fetched are left for a later refresh.
+func (f *Fetcher) refreshZones(ctx context.Context, zones []completionstore.Zone, now time.Time) (bool, error) {
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
 
-	results := make([]zoneResults, 0, len(zones))
+	// in-flight work outlives a shutdown
+	drainCtx := context.WithoutCancel(ctx)
 
-loop:
-	for i := 0; i < len(zones); i++ {
-		select {
-		case <-done:
-			break loop
-		case r := <-out:
-			results = append(results, r)
+	in := make(chan completionstore.Zone)
+	out := make(chan zoneResults, f.concurrency)
+
+	go func() {
+		defer close(in)
+
+		for _, z := range zones {
+			select {
+			case in <- z:
+			case <-dispatchCtx.Done():
+				return
+			}
 		}
-	}
+	}()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < f.concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for data := range in {
+				// covers every page and every retry made by the client, each
+				// attempt is bounded by the HTTP client timeout
+				ctx, cancel := context.WithTimeout(drainCtx, time.Minute)
+				zr, err := f.fetchZone(ctx, data, now)
+				cancel()
 
-	close(in)
+				if err != nil {
+					zr = zoneResults{Zone: data, Err: fmt.Errorf("fetch zone: %w", err)}
+				}
 
-	if err := g.Wait(); err != nil {
-		return nil, fmt.Errorf("errgroup: %w", err)
+				out <- zr
+			}
+		}()
 	}
 
-	elapsed := time.Since(start)
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
 
-	fmt.Fprintf(f.stdout, "found %d results in %s seconds\n", len(results), elapsed)
+	start := time.Now()
 
-	return results, nil
-}
+	var (
+		committed int
+		commitErr error
+	)
 
-func (f *Fetcher) updateRawPlayerCompletionsNew(ctx context.Context) (bool, error) {
-	now := time.Now()
+	for r := range out {
+		if r.Err != nil {
+			f.scheduler.Defer(r.Zone, time.Now())
+			f.logger.WarnContext(ctx, "deferring zone", zoneArgs(r.Zone, "error", r.Err)...)
+			continue
+		}
 
-	threshold := now.Add(-1 * (24 * time.Hour))
+		if commitErr != nil {
+			continue
+		}
 
-	zones, err := f.store.GetStaleZones(ctx, threshold)
-	if err != nil {
-		return false, fmt.Errorf("get stale zones: %w", err)
+		if err := f.commitZone(drainCtx, r, now); err != nil {
+			commitErr = fmt.Errorf("commit zone %s %s %d: %w", r.Zone.MapName, r.Zone.ZoneType, r.Zone.ZoneIndex, err)
+			stopDispatch()
+			continue
+		}
+
+		committed++
 	}
 
-	fmt.Fprintf(f.stdout, "found %d stale zones\n", len(zones))
+	f.logger.InfoContext(ctx, "refreshed zones", "committed", committed, "zones", len(zones), "latency", time.Since(start))
 
-	if len(zones) == 0 {
-		return false, nil
+	if commitErr != nil {
+		return false, commitErr
 	}
 
-	zoneResults, err := f.fetchPlayerClassZoneResults(ctx, zones)
+	return committed > 0, nil
+}
+
+// commitZone stores a fetched zone along with the changes it brings, then
+// reschedules it and updates the map stats.
+func (f *Fetcher) commitZone(ctx context.Context, r zoneResults, now time.Time) error {
+	info := []completionstore.ZoneClassInfo{r.Demoman, r.Soldier}
+
+	events, changed, err := f.diffZones(ctx, []completionstore.Zone{r.Zone}, info, r.PlayerClassResults, now)
 	if err != nil {
-		return false, fmt.Errorf("fetch player class zone results: %w", err)
+		return fmt.Errorf("diff zones: %w", err)
 	}
 
-	if len(zoneResults) == 0 {
-		return false, nil
+	c := completionstore.ZoneCommit{
+		Zone:     r.Zone,
+		Fetched:  now,
+		Info:     info,
+		Results:  r.PlayerClassResults,
+		History:  changed,
+		Events:   events,
+		SteamIDs: r.SteamIDs,
 	}
 
-	results := make([]completionstore.PlayerClassZoneResult, 0, len(zoneResults)*5000)
-	info := make([]completionstore.ZoneClassInfo, 0, len(zoneResults)*2)
-	steamIDs := make(map[string]uint64, 10000)
-
-	for _, r := range zoneResults {
-		results = append(results, r.PlayerClassResults...)
-		info = append(info, r.Demoman, r.Soldier)
-
-		for steamID, playerID := range r.SteamIDs {
-			steamIDs[steamID] = playerID
-		}
+	if err := f.store.CommitZone(ctx, c); err != nil {
+		return fmt.Errorf("commit zone: %w", err)
 	}
 
-	if err := f.store.InsertPlayerClassZoneResults(ctx, results); err != nil {
-		return false, fmt.Errorf("insert player class zone results: %w", err)
+	if len(events) > 0 {
+		f.logger.InfoContext(ctx, "recorded events", zoneArgs(r.Zone, "events", len(events))...)
 	}
 
-	if err := f.store.InsertZoneClassInfo(ctx, info); err != nil {
-		return false, fmt.Errorf("insert zone info: %w", err)
-	}
+	f.scheduler.Update(f.zoneSchedule(r, now), now)
 
-	if err := f.store.InsertSteamIDs(ctx, steamIDs); err != nil {
-		return false, fmt.Errorf("insert steam IDs: %w", err)
+	if err := f.applyZoneClassInfo(ctx, info); err != nil {
+		return fmt.Errorf("apply zone class info: %w", err)
 	}
 
-	if err := f.store.SetZonesFetched(ctx, zones, now); err != nil {
-		return false, fmt.Errorf("set zones fetched: %w", err)
+	return nil
+}
+
+// diffZones compares fetched zones with what is stored for them, before the
+// fetched results overwrite it. It returns the change events and the results
+// whose run is new to the history.
+func (f *Fetcher) diffZones(ctx context.Context, zones []completionstore.Zone, info []completionstore.ZoneClassInfo, results []completionstore.PlayerClassZoneResult, now time.Time) ([]completionstore.Event, []completionstore.PlayerClassZoneResult, error) {
+	prevInfo, err := f.store.GetZoneClassInfo(ctx, zones)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get zone class info: %w", err)
 	}
 
-	// TODO incremental update
-	zoneClassInfo, err := f.store.GetAllZoneClassInfo(ctx)
+	prevResults, err := f.store.GetZoneResults(ctx, zones)
 	if err != nil {
-		return false, fmt.Errorf("get all zone class info: %w", err)
+		return nil, nil, fmt.Errorf("get zone results: %w", err)
 	}
 
-	f.maps2 = completionstats.AggregateMapStats(zoneClassInfo)
+	events := completionevents.Diff(prevInfo, info, prevResults, results, now)
+	changed := completionevents.Changed(prevResults, results)
 
-	return true, nil
+	return events, changed, nil
 }
 
-func (f *Fetcher) transformRawPlayerCompletionsNew(ctx context.Context) (bool, error) {
-	stalePlayerMaps, err := f.store.GetStalePlayerMaps(ctx)
-	if err != nil {
-		return false, fmt.Errorf("get stale player maps: %w", err)
+// zoneSchedule summarises a freshly fetched zone for the scheduler.
+func (f *Fetcher) zoneSchedule(r zoneResults, fetched time.Time) completionstore.ZoneSchedule {
+	schedule := completionstore.ZoneSchedule{
+		Zone:        r.Zone,
+		Fetched:     fetched,
+		Completions: r.Soldier.Completions + r.Demoman.Completions,
 	}
 
-	fmt.Fprintf(f.stdout, "found %d stale player maps\n", len(stalePlayerMaps))
+	for _, result := range r.PlayerClassResults {
+		if schedule.FirstResult.IsZero() || result.Date.Before(schedule.FirstResult) {
+			schedule.FirstResult = result.Date
+		}
 
-	if len(stalePlayerMaps) == 0 {
-		return false, nil
-	}
+		if result.Date.After(schedule.LastResult) {
+			schedule.LastResult = result.Date
+		}
 
-	results, err := f.store.GetPlayerMapResults(ctx, stalePlayerMaps)
-	if err != nil {
-		return false, fmt.Errorf("get player map results: %w", err)
+		if _, ok := f.trackedPlayers[result.PlayerID]; ok && result.Date.After(schedule.LastTrackedResult) {
+			schedule.LastTrackedResult = result.Date
+		}
 	}
 
-	calculator := completionstats.MapStatCalculator{
-		PlayerMapResults:  results,
-		MapClassStatsInfo: f.maps2,
-	}
+	return schedule
+}
 
-	stats := calculator.Calculate()
+// zoneArgs returns the fields identifying a zone followed by args.
+func zoneArgs(z completionstore.Zone, args ...any) []any {
+	return append([]any{"map_id", z.MapID, "zone", fmt.Sprintf("%s %s %d", z.MapName, z.ZoneType, z.ZoneIndex)}, args...)
+}
 
-	if err := f.store.InsertPlayerMapStats(ctx, stats); err != nil {
-		return false, fmt.Errorf("insert player map stats: %w", err)
+// applyZoneClassInfo updates the cached map stats with changed zone class
+// info, persisting the stats of only the maps it affected.
+func (f *Fetcher) applyZoneClassInfo(ctx context.Context, info []completionstore.ZoneClassInfo) error {
+	changed := f.mapStats.Apply(info)
+
+	if len(changed) == 0 {
+		return nil
 	}
 
-	if err := f.store.SetPlayerMapsProcessed(ctx, stalePlayerMaps); err != nil {
-		return false, fmt.Errorf("set player maps processed: %w", err)
+	if err := f.store.InsertMapStats(ctx, f.mapStatsInfo(changed)); err != nil {
+		return fmt.Errorf("insert map stats: %w", err)
 	}
 
-	return true, nil
+	f.logger.InfoContext(ctx, "updated map stats", "maps", len(changed))
+
+	return nil
 }
 
-func run(args []string, stdout, stderr io.Writer) error {
-	flags := NewFlagSet("fetcher")
+// runJob runs a claimed job and records how it went. Only failing to record it
+// is returned, the job itself is retried by the queue.
+func (f *Fetcher) runJob(ctx context.Context, job jobqueue.Job) error {
+	f.mu.Lock()
+	f.status.Job = &job
+	f.mu.Unlock()
 
-	var rqliteaddr string
-	var initialize bool
+	defer func() {
+		f.mu.Lock()
+		f.status.Job = nil
+		f.mu.Unlock()
+	}()
 
-	flags.StringVar(&rqliteaddr, "rqlite-address", "", "")
-	flags.BoolVar(&initialize, "initialize", false, "")
+	ctx = logutil.With(ctx, "job_id", job.ID)
 
-	ok, err := Parse(flags, args, stderr, "")
-	if err != nil {
-		return fmt.Errorf("parse args: %w", err)
-	}
+	f.logger.InfoContext(ctx, "running job", "kind", job.Kind, "target", job.Target, "attempt", job.Attempts)
 
-	if !ok {
-		return nil
+	var jobErr error
+
+	switch job.Kind {
+	case jobqueue.KindRefreshPlayer:
+		jobErr = f.BackfillPlayer(ctx, job.Target)
+	case jobqueue.KindRefreshMap:
+		jobErr = f.RefreshMap(ctx, job.Target)
+	default:
+		jobErr = fmt.Errorf("unknown job kind %s", job.Kind)
 	}
 
-	if rqliteaddr == "" {
-		return fmt.Errorf("-rqlite-address must be set")
+	if jobErr != nil {
+		f.logger.ErrorContext(ctx, "job failed", "error", jobErr)
 	}
 
-	ctx := context.Background()
-	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM)
-	defer cancel()
+	// an interrupted job is retried like a failed one
+	if err := f.jobs.Complete(context.WithoutCancel(ctx), job, time.Now(), jobErr); err != nil {
+		return fmt.Errorf("complete job: %w", err)
+	}
 
-	httpc := http.Client{}
+	return nil
+}
 
-	client := tempushttprpc.NewClient(httpc, "")
+// RefreshMap refreshes every zone of a map straight away.
+func (f *Fetcher) RefreshMap(ctx context.Context, mapID uint64) error {
+	zones := f.scheduler.MapZones(mapID)
+	if len(zones) == 0 {
+		return fmt.Errorf("map %d has no scheduled zones", mapID)
+	}
 
-	store, err := rqlitecompletionstore.New(rqliteaddr)
-	if err != nil {
-		return fmt.Errorf("new completion store: %w", err)
+	if _, err := f.refreshZones(ctx, zones, time.Now()); err != nil {
+		return err
 	}
 
-	if initialize {
-		if err := store.CreateSchema(ctx); err != nil {
-			return fmt.Errorf("create schema: %w", err)
+	return nil
+}
+
+// BackfillPlayer refreshes a player's results on every rated zone, rather than
+// waiting for each zone's turn in the schedule, and then updates the stats of
+// the maps they are on. The results come from the player's records, a page at
+// a time, and only zones the player has stored results on that the records
+// miss are looked up one by one.
+//
+// Lookups that fail are logged and left to the zones' next refresh. The
+// backfill only fails if every lookup did.
+func (f *Fetcher) BackfillPlayer(ctx context.Context, playerID uint64) error {
+	ctx = logutil.With(ctx, "player_id", playerID)
+
+	// every zone would be not found for an unknown player
+	if _, err := f.client.GetPlayerInfo(ctx, playerID); err != nil {
+		if errors.Is(err, tempushttprpc.ErrNotFound) {
+			f.logger.InfoContext(ctx, "player not found, skipping backfill")
+			return nil
 		}
-	}
 
-	list, err := store.GetMaps(ctx)
-	if err != nil {
-		return fmt.Errorf("get maps: %w", err)
+		return fmt.Errorf("get player info: %w", err)
 	}
 
-	zoneClassInfo, err := store.GetAllZoneClassInfo(ctx)
+	infos, err := f.store.GetAllZoneClassInfo(ctx)
 	if err != nil {
 		return fmt.Errorf("get all zone class info: %w", err)
 	}
 
-	f := &Fetcher{
-		client: client,
-		store:  store,
-		maps:   list,
-		maps2:  completionstats.AggregateMapStats(zoneClassInfo),
-		stdout: stdout,
+	type zoneClass struct {
+		MapID     uint64
+		ZoneType  tempushttp.ZoneType
+		ZoneIndex uint8
+		Class     tempushttp.ClassType
 	}
 
-	done := ctx.Done()
+	rated := make(map[zoneClass]completionstore.ZoneClassInfo, len(infos))
 
-	var retries uint8
+	for _, info := range infos {
+		rated[zoneClass{MapID: info.MapID, ZoneType: info.ZoneType, ZoneIndex: info.ZoneIndex, Class: info.Class}] = info
+	}
+
+	stored, err := f.playerResults(ctx, playerID)
+	if err != nil {
+		return err
+	}
+
+	f.logger.InfoContext(ctx, "backfilling player", "zone_classes", len(infos), "stored_results", len(stored))
+
+	updated := time.Now()
+
+	var (
+		mu       sync.Mutex
+		found    = make(map[zoneClass]completionstore.PlayerClassZoneResult, len(stored))
+		steamIDs = make(map[string]uint64, 1)
+		failures int
+	)
+
+	add := func(info completionstore.ZoneClassInfo, tier uint8, completions uint32, r tempushttp.CompletionResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		found[zoneClass{MapID: info.MapID, ZoneType: info.ZoneType, ZoneIndex: info.ZoneIndex, Class: info.Class}] = completionstore.PlayerClassZoneResult{
+			MapID:       info.MapID,
+			ZoneType:    info.ZoneType,
+			ZoneIndex:   info.ZoneIndex,
+			PlayerID:    playerID,
+			Class:       info.Class,
+			CustomName:  info.CustomName,
+			MapName:     info.MapName,
+			Tier:        tier,
+			Updated:     updated,
+			Rank:        uint32(r.Rank),
+			Duration:    time.Duration(float64(time.Second) * r.Duration),
+			Date:        time.Unix(int64(r.Date), 0),
+			Completions: completions,
+		}
+
+		steamIDs[r.SteamID] = playerID
+	}
+
+	for _, class := range []tempushttp.ClassType{tempushttp.ClassTypeSoldier, tempushttp.ClassTypeDemoman} {
+		for response, err := range f.client.PlayerRecordPages(ctx, playerID, class, f.zonePageSize) {
+			if err != nil {
+				f.logger.WarnContext(ctx, "get player records failed", "class", class, "error", err)
+				failures++
+
+				break
+			}
+
+			for _, record := range response.Records {
+				info, ok := rated[zoneClass{
+					MapID:     record.ZoneInfo.MapID,
+					ZoneType:  tempushttp.ZoneType(record.ZoneInfo.Type),
+					ZoneIndex: uint8(record.ZoneInfo.Zoneindex),
+					Class:     class,
+				}]
+				if !ok {
+					continue
+				}
+
+				tier := record.TierInfo.Soldier
+				if class == tempushttp.ClassTypeDemoman {
+					tier = record.TierInfo.Demoman
+				}
+
+				add(info, uint8(tier), info.Completions, tempushttp.CompletionResult{
+					SteamID:  response.PlayerInfo.SteamID,
+					Rank:     int(record.RecordInfo.Rank),
+					Duration: record.RecordInfo.Duration,
+					Date:     record.RecordInfo.Date,
+				})
+			}
+		}
+	}
+
+	var missed []completionstore.ZoneClassInfo
+
+	for _, r := range stored {
+		k := zoneClass{MapID: r.MapID, ZoneType: r.ZoneType, ZoneIndex: r.ZoneIndex, Class: r.Class}
+
+		if _, ok := found[k]; ok {
+			continue
+		}
+
+		if info, ok := rated[k]; ok {
+			missed = append(missed, info)
+		}
+	}
+
+	if len(missed) > 0 {
+		f.logger.InfoContext(ctx, "looking up zones missing from player records", "zone_classes", len(missed))
+	}
+
+	var g errgroup.Group
+	g.SetLimit(f.concurrency)
+
+	for _, info := range missed {
+		g.Go(func() error {
+			data := tempushttprpc.GetPlayerZoneClassCompletionData{
+				MapName:   info.MapName,
+				ZoneType:  info.ZoneType,
+				ZoneIndex: info.ZoneIndex,
+				PlayerID:  playerID,
+				Class:     info.Class,
+			}
+
+			response, err := f.client.GetPlayerZoneClassCompletion(ctx, data)
+			if errors.Is(err, tempushttprpc.ErrNotFound) {
+				// the zone was removed since the map list was fetched
+				return nil
+			}
+
+			if err != nil {
+				f.logger.WarnContext(ctx, "get player zone class completion failed", zoneArgs(completionstore.Zone{MapID: info.MapID, MapName: info.MapName, ZoneType: info.ZoneType, ZoneIndex: info.ZoneIndex}, "class", info.Class, "error", err)...)
+
+				mu.Lock()
+				failures++
+				mu.Unlock()
+
+				return nil
+			}
+
+			// a player without a run gets an empty result
+			if response.Result.Rank == 0 {
+				return nil
+			}
+
+			completions := response.CompletionInfo.Soldier
+			tier := response.TierInfo.Soldier
+
+			if info.Class == tempushttp.ClassTypeDemoman {
+				completions = response.CompletionInfo.Demoman
+				tier = response.TierInfo.Demoman
+			}
+
+			add(info, uint8(tier), uint32(completions), response.Result)
+
+			return nil
+		})
+	}
+
+	g.Wait()
+
+	f.logger.InfoContext(ctx, "found player results", "results", len(found), "failures", failures)
+
+	if len(found) == 0 {
+		if failures > 0 {
+			return fmt.Errorf("backfill player: all %d lookups failed", failures)
+		}
+
+		return nil
+	}
+
+	results := make([]completionstore.PlayerClassZoneResult, 0, len(found))
+
+	for _, r := range found {
+		results = append(results, r)
+	}
+
+	// the same diff a zone refresh makes, against the player's stored results
+	events := completionevents.Diff(infos, nil, stored, results, updated)
+
+	c := completionstore.ZoneCommit{
+		Results:  results,
+		History:  completionevents.Changed(stored, results),
+		Events:   events,
+		SteamIDs: steamIDs,
+	}
+
+	if err := f.store.CommitZone(ctx, c); err != nil {
+		return fmt.Errorf("commit player results: %w", err)
+	}
+
+	if len(events) > 0 {
+		f.logger.InfoContext(ctx, "recorded events", "events", len(events))
+	}
+
+	if _, err := f.transformRawPlayerCompletionsNew(ctx); err != nil {
+		return fmt.Errorf("transform raw player completions: %w", err)
+	}
+
+	return nil
+}
+
+// playerResults returns a player's stored results on rated zones.
+func (f *Fetcher) playerResults(ctx context.Context, playerID uint64) ([]completionstore.PlayerClassZoneResult, error) {
+	zones, err := f.store.GetPlayerZones(ctx, playerID)
+	if err != nil {
+		return nil, fmt.Errorf("get player zones: %w", err)
+	}
+
+	seen := make(map[uint64]struct{})
+	playerMaps := make([]completionstore.StalePlayerMap, 0, len(zones))
+
+	for _, z := range zones {
+		if _, ok := seen[z.MapID]; ok {
+			continue
+		}
+
+		seen[z.MapID] = struct{}{}
+		playerMaps = append(playerMaps, completionstore.StalePlayerMap{
+			PlayerMap: completionstore.PlayerMap{PlayerID: playerID, MapID: z.MapID},
+		})
+	}
+
+	mapResults, err := f.store.GetPlayerMapResults(ctx, playerMaps)
+	if err != nil {
+		return nil, fmt.Errorf("get player map results: %w", err)
+	}
+
+	var results []completionstore.PlayerClassZoneResult
+
+	for _, rs := range mapResults {
+		results = append(results, rs...)
+	}
+
+	return results, nil
+}
+
+func (f *Fetcher) transformRawPlayerCompletionsNew(ctx context.Context) (bool, error) {
+	stalePlayerMaps, err := f.store.GetStalePlayerMaps(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get stale player maps: %w", err)
+	}
+
+	f.logger.InfoContext(ctx, "found stale player maps", "player_maps", len(stalePlayerMaps))
+
+	if len(stalePlayerMaps) == 0 {
+		return false, nil
+	}
+
+	results, err := f.store.GetPlayerMapResults(ctx, stalePlayerMaps)
+	if err != nil {
+		return false, fmt.Errorf("get player map results: %w", err)
+	}
+
+	calculator := completionstats.MapStatCalculator{
+		PlayerMapResults:  results,
+		MapClassStatsInfo: f.mapStats.Stats(),
+	}
+
+	stats := calculator.Calculate()
+
+	// players whose results were all retired have nothing left on the map
+	for _, pm := range stalePlayerMaps {
+		if _, ok := stats[pm.PlayerMap]; !ok {
+			stats[pm.PlayerMap] = completionstore.PlayerMapStats{MapID: pm.MapID}
+		}
+	}
+
+	if err := f.store.InsertPlayerMapStats(ctx, stats); err != nil {
+		return false, fmt.Errorf("insert player map stats: %w", err)
+	}
+
+	if err := f.store.SetPlayerMapsProcessed(ctx, stalePlayerMaps); err != nil {
+		return false, fmt.Errorf("set player maps processed: %w", err)
+	}
+
+	return true, nil
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) > 0 && args[0] == "migrate" {
+		return runMigrate(args[1:], stdout, stderr)
+	}
+
+	flags := NewFlagSet("fetcher")
+
+	var rqliteaddr string
+	var storeaddr string
+	var initialize bool
+	var apirps float64
+	var apiconcurrency int
+	var apistrict bool
+	var apicachedir string
+	var mapsinterval time.Duration
+	var apiaddr string
+	var apitrace bool
+	var metricsaddr string
+	var adminaddr string
+	var zonepagesize uint
+	var zonebatch int
+	var trackplayers string
+	var joblease time.Duration
+	var writechunksize int
+	var logformat string
+	var loglevel string
+
+	flags.StringVar(&rqliteaddr, "rqlite-address", "", "")
+	flags.StringVar(&storeaddr, "store", "", "")
+	flags.BoolVar(&initialize, "initialize", false, "")
+	flags.Float64Var(&apirps, "api-rps", 5, "")
+	flags.IntVar(&apiconcurrency, "api-concurrency", 8, "")
+	flags.BoolVar(&apistrict, "api-strict", false, "")
+	flags.StringVar(&apiaddr, "api-address", "", "")
+	flags.BoolVar(&apitrace, "api-trace", false, "")
+	flags.StringVar(&metricsaddr, "metrics-address", "", "")
+	flags.StringVar(&adminaddr, "admin-address", "", "")
+	flags.StringVar(&apicachedir, "api-cache-dir", "", "")
+	flags.DurationVar(&mapsinterval, "maps-interval", time.Hour, "")
+	flags.UintVar(&zonepagesize, "zone-page-size", 500, "")
+	flags.IntVar(&zonebatch, "zone-batch-size", 5, "")
+	flags.StringVar(&trackplayers, "track-players", "", "")
+	flags.DurationVar(&joblease, "job-lease", 30*time.Minute, "")
+	flags.IntVar(&writechunksize, "rqlite-write-chunk-size", rqlitecompletionstore.DefaultWriteChunkSize, "")
+	flags.StringVar(&logformat, "log-format", "text", "")
+	flags.StringVar(&loglevel, "log-level", "info", "")
+
+	ok, err := Parse(flags, args, stderr, "")
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if !ok {
+		return nil
+	}
+
+	if storeaddr == "" {
+		storeaddr = rqliteaddr
+	}
+
+	if storeaddr == "" {
+		return fmt.Errorf("-store or -rqlite-address must be set")
+	}
+
+	if zonepagesize < 1 {
+		return fmt.Errorf("-zone-page-size must be at least 1")
+	}
+
+	if zonebatch < 1 {
+		return fmt.Errorf("-zone-batch-size must be at least 1")
+	}
+
+	trackedPlayers, err := parsePlayerIDs(trackplayers)
+	if err != nil {
+		return fmt.Errorf("parse -track-players: %w", err)
+	}
+
+	if apiconcurrency < 1 {
+		return fmt.Errorf("-api-concurrency must be at least 1")
+	}
+
+	if writechunksize < 1 {
+		return fmt.Errorf("-rqlite-write-chunk-size must be at least 1")
+	}
+
+	logger, err := logutil.New(stdout, logformat, loglevel)
+	if err != nil {
+		return fmt.Errorf("new logger: %w", err)
+	}
+
+	ctx := context.Background()
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM)
+	defer cancel()
+
+	decodeMode := tempushttprpc.DecodeLenient
+	if apistrict {
+		decodeMode = tempushttprpc.DecodeStrict
+	}
+
+	httpc := http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	var cache tempushttprpc.Cache = tempushttprpc.NewMemoryCache()
+
+	if apicachedir != "" {
+		cache, err = tempushttprpc.NewDiskCache(apicachedir)
+		if err != nil {
+			return fmt.Errorf("new disk cache: %w", err)
+		}
+	}
+
+	metrics := tempusmetrics.New()
+
+	opts := []tempushttprpc.Option{
+		tempushttprpc.WithRateLimit(apirps, apiconcurrency),
+		tempushttprpc.WithMaxConcurrency(apiconcurrency),
+		tempushttprpc.WithDecodeMode(decodeMode),
+		tempushttprpc.WithUnknownFieldsFunc(func(endpoint string, paths []string) {
+			logger.Warn("unknown fields in response", "endpoint", endpoint, "fields", strings.Join(paths, ", "))
+		}),
+		tempushttprpc.WithCache(cache),
+		tempushttprpc.WithObserver(metrics.Observe),
+	}
+
+	if apitrace {
+		opts = append(opts, tempushttprpc.WithObserver(tempushttprpc.LogObserver(logger)))
+	}
+
+	client := tempushttprpc.NewClient(httpc, apiaddr, opts...)
+
+	if metricsaddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+
+		server := httpserveutil.NewServer(metricsaddr, mux, nil, logger)
+
+		go func() {
+			if err := server.Run(ctx); err != nil {
+				logger.Error("metrics server", "error", err)
+			}
+		}()
+
+		defer server.Shutdown()
+	}
+
+	store, jobs, err := openStore(storeaddr, writechunksize, logger)
+	if err != nil {
+		return fmt.Errorf("open completion store: %w", err)
+	}
+
+	if initialize {
+		logger.Warn("-initialize is deprecated, migrations are applied on startup")
+	}
+
+	migrations, err := completionstore.Migrate(ctx, store, time.Now())
+	for _, m := range migrations {
+		logger.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	list, err := store.GetMaps(ctx)
+	if err != nil {
+		return fmt.Errorf("get maps: %w", err)
+	}
+
+	zoneClassInfo, err := store.GetAllZoneClassInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("get all zone class info: %w", err)
+	}
+
+	schedule, err := store.GetZoneSchedule(ctx, trackedPlayers)
+	if err != nil {
+		return fmt.Errorf("get zone schedule: %w", err)
+	}
+
+	scheduler := zonescheduler.New(zonescheduler.DefaultPolicy)
+
+	now := time.Now()
+
+	for _, z := range schedule {
+		scheduler.Update(z, now)
+	}
+
+	tracked := make(map[uint64]struct{}, len(trackedPlayers))
+	for _, playerID := range trackedPlayers {
+		tracked[playerID] = struct{}{}
+	}
+
+	f := &Fetcher{
+		client:    client,
+		store:     store,
+		maps:      list,
+		mapStats:  completionstats.NewMapStatsAggregator(zoneClassInfo),
+		scheduler: scheduler,
+		logger:    logger,
+
+		trackedPlayers: tracked,
+
+		concurrency:  apiconcurrency,
+		mapsInterval: mapsinterval,
+		zonePageSize: uint32(zonepagesize),
+		zoneBatch:    zonebatch,
+
+		wake: make(chan struct{}, 1),
+
+		jobs:     jobs,
+		jobLease: joblease,
+	}
+
+	if adminaddr != "" {
+		mux := http.NewServeMux()
+		httpserveutil.Register(mux, logger, f)
+
+		server := httpserveutil.NewServer(adminaddr, mux, nil, logger)
+
+		go func() {
+			if err := server.Run(ctx); err != nil {
+				logger.Error("admin server", "error", err)
+			}
+		}()
+
+		defer server.Shutdown()
+	}
+
+	done := ctx.Done()
+
+	var retries uint8
 
 	timer := time.NewTimer(0)
 	sleep := 60 * time.Second
 
-	for i := 0; ; i++ {
+	// an iteration interrupted by a shutdown stores what it has already
+	// fetched before returning, so the next start picks up from there
+	for ctx.Err() == nil {
 		select {
 		case <-done:
-			fmt.Fprintln(stdout, "Received exit signal, shutting down")
-			return nil
+			continue
 		case <-timer.C:
-			fmt.Fprintf(stdout, "running iteration %d\n", i)
+		case <-f.wake:
+			timer.Stop()
+		}
 
-			ok, err := f.Run(ctx)
-			if err != nil {
-				fmt.Fprintf(stdout, "error during iteration: %s\n", err)
-				retries++
-				timer.Reset(sleep * time.Duration(retries+1))
-				continue
-			}
+		// the timer is left stopped, resuming wakes the loop
+		if f.paused() {
+			logger.Info("paused")
+			continue
+		}
+
+		i := f.startIteration()
+
+		ictx := logutil.With(ctx, "iteration", i)
+		start := time.Now()
+
+		logger.InfoContext(ictx, "running iteration")
+
+		ok, err := f.Run(ictx)
+		f.finishIteration(err)
+
+		if err != nil {
+			logger.ErrorContext(ictx, "iteration failed", "error", err, "latency", time.Since(start))
+			retries++
+			timer.Reset(sleep * time.Duration(retries+1))
+			continue
+		}
+
+		retries = 0
+
+		logger.InfoContext(ictx, "finished iteration", "latency", time.Since(start))
+
+		if ok {
+			timer.Reset(0)
+		} else {
+			timer.Reset(sleep)
+		}
+	}
+
+	logger.Info("received exit signal, shutting down")
+
+	return nil
+}
+
+// notify wakes the main loop if it is waiting for the next iteration.
+func (f *Fetcher) notify() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (f *Fetcher) paused() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.status.Paused
+}
+
+func (f *Fetcher) startIteration() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.status.Iteration++
+	f.status.Running = true
+	f.status.Started = time.Now()
+
+	return f.status.Iteration
+}
+
+func (f *Fetcher) finishIteration(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.status.Running = false
+	f.status.Finished = time.Now()
+	f.status.MapsUpdated = f.maps.Updated
+
+	if err != nil {
+		f.status.LastError = err.Error()
+		f.status.LastErrorTime = f.status.Finished
+	}
+}
+
+func (f *Fetcher) Status() Status {
+	f.mu.Lock()
+	status := f.status
+	f.mu.Unlock()
+
+	status.Zones = f.scheduler.Len()
+	status.DueZones = f.scheduler.Pending(time.Now())
+
+	return status
+}
+
+func (f *Fetcher) Routes(logger *slog.Logger) map[string]http.Handler {
+	return map[string]http.Handler{
+		"GET /status":           httpserveutil.Handle(logger, f.serveStatus),
+		"POST /pause":           httpserveutil.Handle(logger, f.servePause),
+		"POST /resume":          httpserveutil.Handle(logger, f.serveResume),
+		"POST /update-maps":     httpserveutil.Handle(logger, f.serveUpdateMaps),
+		"POST /refresh/map":     httpserveutil.Handle(logger, f.serveRefreshMap),
+		"POST /refresh/zone":    httpserveutil.Handle(logger, f.serveRefreshZone),
+		"POST /refresh/player":  httpserveutil.Handle(logger, f.serveRefreshPlayer),
+		"POST /backfill/player": httpserveutil.Handle(logger, f.serveBackfillPlayer),
+	}
+}
+
+func (f *Fetcher) serveStatus(w http.ResponseWriter, r *http.Request) error {
+	return httpserveutil.WriteJSON(w, http.StatusOK, f.Status())
+}
+
+func (f *Fetcher) servePause(w http.ResponseWriter, r *http.Request) error {
+	f.mu.Lock()
+	f.status.Paused = true
+	f.mu.Unlock()
+
+	f.logger.InfoContext(r.Context(), "pausing after the current iteration")
+
+	return httpserveutil.WriteJSON(w, http.StatusOK, f.Status())
+}
+
+func (f *Fetcher) serveResume(w http.ResponseWriter, r *http.Request) error {
+	f.mu.Lock()
+	f.status.Paused = false
+	f.mu.Unlock()
 
-			retries = 0
+	f.logger.InfoContext(r.Context(), "resuming")
 
-			fmt.Fprintf(stdout, "finished iteration %d\n", i)
+	f.notify()
 
-			if ok {
-				timer.Reset(0)
-			} else {
-				timer.Reset(sleep)
+	return httpserveutil.WriteJSON(w, http.StatusOK, f.Status())
+}
+
+// serveUpdateMaps makes the next iteration update the map list, which starts
+// straight away unless the fetcher is paused.
+func (f *Fetcher) serveUpdateMaps(w http.ResponseWriter, r *http.Request) error {
+	f.mu.Lock()
+	f.forceMaps = true
+	f.mu.Unlock()
+
+	f.notify()
+
+	return httpserveutil.WriteJSON(w, http.StatusAccepted, f.Status())
+}
+
+func (f *Fetcher) serveRefreshMap(w http.ResponseWriter, r *http.Request) error {
+	mapID, err := strconv.ParseUint(r.URL.Query().Get("mapid"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed mapID: %w", err)
+	}
+
+	n := f.scheduler.BoostMap(mapID)
+	if n == 0 {
+		return httpserveutil.NotFound(w, "map %d has no scheduled zones", mapID)
+	}
+
+	f.notify()
+
+	return httpserveutil.WriteJSON(w, http.StatusAccepted, refreshResponse{Zones: n})
+}
+
+func (f *Fetcher) serveRefreshZone(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+
+	mapID, err := strconv.ParseUint(q.Get("mapid"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed mapID: %w", err)
+	}
+
+	zoneType := tempushttp.ZoneType(q.Get("zone-type"))
+
+	switch zoneType {
+	case tempushttp.ZoneTypeMap, tempushttp.ZoneTypeCourse, tempushttp.ZoneTypeBonus, tempushttp.ZoneTypeTrick:
+	default:
+		return httpserveutil.BadRequest(w, "zone type '%s' is not supported", zoneType)
+	}
+
+	zoneIndex, err := strconv.ParseUint(q.Get("zone-index"), 10, 8)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed zone index: %w", err)
+	}
+
+	zone := completionstore.Zone{
+		MapID:     mapID,
+		ZoneType:  zoneType,
+		ZoneIndex: uint8(zoneIndex),
+	}
+
+	if !f.scheduler.Boost(zone) {
+		return httpserveutil.NotFound(w, "zone %d %s %d is not scheduled", mapID, zoneType, zoneIndex)
+	}
+
+	f.notify()
+
+	return httpserveutil.WriteJSON(w, http.StatusAccepted, refreshResponse{Zones: 1})
+}
+
+// serveRefreshPlayer makes every zone the player has a result on due.
+func (f *Fetcher) serveRefreshPlayer(w http.ResponseWriter, r *http.Request) error {
+	playerID, err := strconv.ParseUint(r.URL.Query().Get("playerid"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed playerID: %w", err)
+	}
+
+	zones, err := f.store.GetPlayerZones(r.Context(), playerID)
+	if err != nil {
+		return httpserveutil.InternalError(w, "get player zones: %w", err)
+	}
+
+	var n int
+
+	for _, z := range zones {
+		if f.scheduler.Boost(z) {
+			n++
+		}
+	}
+
+	if n == 0 {
+		return httpserveutil.NotFound(w, "player %d has no scheduled zones", playerID)
+	}
+
+	f.notify()
+
+	return httpserveutil.WriteJSON(w, http.StatusAccepted, refreshResponse{Zones: n})
+}
+
+// serveBackfillPlayer queues a backfill of the player's results, which runs
+// at the start of the next iteration.
+func (f *Fetcher) serveBackfillPlayer(w http.ResponseWriter, r *http.Request) error {
+	playerID, err := strconv.ParseUint(r.URL.Query().Get("playerid"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed playerID: %w", err)
+	}
+
+	job, err := f.jobs.Enqueue(r.Context(), jobqueue.KindRefreshPlayer, playerID, time.Now())
+	if err != nil {
+		return httpserveutil.InternalError(w, "enqueue job: %w", err)
+	}
+
+	f.notify()
+
+	return httpserveutil.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// parsePlayerIDs parses a comma separated list of Tempus player IDs.
+func parsePlayerIDs(s string) ([]uint64, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(s, ",")
+	ids := make([]uint64, 0, len(fields))
+
+	for _, field := range fields {
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse player id: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// runMigrate shows the store's migrations, applying the pending ones unless
+// -dry-run or -status is set.
+func runMigrate(args []string, stdout, stderr io.Writer) error {
+	flags := NewFlagSet("fetcher migrate")
+
+	var rqliteaddr string
+	var storeaddr string
+	var dryrun bool
+	var status bool
+
+	flags.StringVar(&rqliteaddr, "rqlite-address", "", "")
+	flags.StringVar(&storeaddr, "store", "", "")
+	flags.BoolVar(&dryrun, "dry-run", false, "")
+	flags.BoolVar(&status, "status", false, "")
+
+	ok, err := Parse(flags, args, stderr, "")
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if !ok {
+		return nil
+	}
+
+	if storeaddr == "" {
+		storeaddr = rqliteaddr
+	}
+
+	if storeaddr == "" {
+		return fmt.Errorf("-store or -rqlite-address must be set")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	store, _, err := openStore(storeaddr, rqlitecompletionstore.DefaultWriteChunkSize, logger)
+	if err != nil {
+		return fmt.Errorf("open completion store: %w", err)
+	}
+
+	ctx := context.Background()
+
+	migrations, err := completionstore.GetMigrationStatus(ctx, store)
+	if err != nil {
+		return fmt.Errorf("get migration status: %w", err)
+	}
+
+	for _, m := range migrations {
+		switch {
+		case !m.Applied.IsZero():
+			fmt.Fprintf(stdout, "%04d %s applied %s\n", m.Version, m.Name, m.Applied.UTC().Format(time.RFC3339))
+		case status:
+			fmt.Fprintf(stdout, "%04d %s pending\n", m.Version, m.Name)
+		case dryrun:
+			fmt.Fprintf(stdout, "%04d %s would apply\n\n%s\n", m.Version, m.Name, strings.TrimSpace(m.Query))
+		default:
+			if err := store.ApplyMigration(ctx, m.Migration, time.Now()); err != nil {
+				return fmt.Errorf("apply migration %d %s: %w", m.Version, m.Name, err)
 			}
+
+			fmt.Fprintf(stdout, "%04d %s applied now\n", m.Version, m.Name)
 		}
 	}
+
+	return nil
 }
 
 func NewFlagSet(prog string) *flag.FlagSet {
@@ -0,0 +1,137 @@
+// Package mapreconcile works out what changed between two detailed map lists.
+package mapreconcile
+
+import (
+	"sort"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/tempushttp"
+)
+
+type Rename struct {
+	MapID   uint64
+	OldName string
+	NewName string
+}
+
+type Changes struct {
+	// Zones are every zone in the new list.
+	Zones map[completionstore.Zone]struct{}
+
+	AddedMaps    []uint64
+	RemovedZones []completionstore.Zone
+	RemovedMaps  []uint64
+	Renames      []Rename
+}
+
+// Reconcile compares the previous map list with the next. Removed zones keep
+// the map name they had in the previous list.
+func Reconcile(prev, next tempushttp.GetDetailedMapListResponse) Changes {
+	changes := Changes{
+		Zones: Zones(next),
+	}
+
+	type zoneKey struct {
+		MapID     uint64
+		ZoneType  tempushttp.ZoneType
+		ZoneIndex uint8
+	}
+
+	current := make(map[zoneKey]struct{}, len(changes.Zones))
+
+	for z := range changes.Zones {
+		current[zoneKey{MapID: z.MapID, ZoneType: z.ZoneType, ZoneIndex: z.ZoneIndex}] = struct{}{}
+	}
+
+	names := make(map[uint64]string, len(next))
+
+	for _, m := range next {
+		names[uint64(m.ID)] = m.Name
+	}
+
+	previous := make(map[uint64]struct{}, len(prev))
+
+	for _, m := range prev {
+		previous[uint64(m.ID)] = struct{}{}
+	}
+
+	for _, m := range next {
+		if _, ok := previous[uint64(m.ID)]; !ok {
+			changes.AddedMaps = append(changes.AddedMaps, uint64(m.ID))
+		}
+	}
+
+	for _, m := range prev {
+		mapID := uint64(m.ID)
+
+		name, ok := names[mapID]
+
+		switch {
+		case !ok:
+			changes.RemovedMaps = append(changes.RemovedMaps, mapID)
+		case name != m.Name:
+			changes.Renames = append(changes.Renames, Rename{
+				MapID:   mapID,
+				OldName: m.Name,
+				NewName: name,
+			})
+		}
+	}
+
+	for z := range Zones(prev) {
+		if _, ok := current[zoneKey{MapID: z.MapID, ZoneType: z.ZoneType, ZoneIndex: z.ZoneIndex}]; ok {
+			continue
+		}
+
+		changes.RemovedZones = append(changes.RemovedZones, z)
+	}
+
+	sort.Slice(changes.RemovedZones, func(i, j int) bool {
+		a, b := changes.RemovedZones[i], changes.RemovedZones[j]
+
+		if a.MapID != b.MapID {
+			return a.MapID < b.MapID
+		}
+
+		if a.ZoneType != b.ZoneType {
+			return a.ZoneType < b.ZoneType
+		}
+
+		return a.ZoneIndex < b.ZoneIndex
+	})
+
+	return changes
+}
+
+// Zones lists every zone a map list describes, from its zone counts.
+func Zones(list tempushttp.GetDetailedMapListResponse) map[completionstore.Zone]struct{} {
+	const estzones = 3000
+
+	zones := make(map[completionstore.Zone]struct{}, estzones)
+
+	for _, r := range list {
+		counts := []struct {
+			zoneType tempushttp.ZoneType
+			n        int
+		}{
+			{zoneType: tempushttp.ZoneTypeBonus, n: r.ZoneCounts.Bonus},
+			{zoneType: tempushttp.ZoneTypeMap, n: r.ZoneCounts.Map},
+			{zoneType: tempushttp.ZoneTypeCourse, n: r.ZoneCounts.Course},
+			{zoneType: tempushttp.ZoneTypeTrick, n: r.ZoneCounts.Trick},
+		}
+
+		for _, c := range counts {
+			for i := 0; i < c.n; i++ {
+				zone := completionstore.Zone{
+					MapID:     uint64(r.ID),
+					MapName:   r.Name,
+					ZoneType:  c.zoneType,
+					ZoneIndex: uint8(i + 1),
+				}
+
+				zones[zone] = struct{}{}
+			}
+		}
+	}
+
+	return zones
+}
@@ -0,0 +1,56 @@
+package mapreconcile_test
+
+import (
+	"reflect"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/mapreconcile"
+	"tempus-completion/tempushttp"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	prev := tempushttp.GetDetailedMapListResponse{
+		{ID: 1, Name: "jump_cow", ZoneCounts: tempushttp.DetailedMapListZoneCounts{Map: 1, Bonus: 2}},
+		{ID: 2, Name: "jump_sync_a2", ZoneCounts: tempushttp.DetailedMapListZoneCounts{Map: 1, Course: 2}},
+		{ID: 3, Name: "jump_old", ZoneCounts: tempushttp.DetailedMapListZoneCounts{Map: 1}},
+	}
+
+	next := tempushttp.GetDetailedMapListResponse{
+		{ID: 1, Name: "jump_cow", ZoneCounts: tempushttp.DetailedMapListZoneCounts{Map: 1, Bonus: 1}},
+		{ID: 2, Name: "jump_sync_final", ZoneCounts: tempushttp.DetailedMapListZoneCounts{Map: 1, Course: 2, Trick: 1}},
+		{ID: 4, Name: "jump_new", ZoneCounts: tempushttp.DetailedMapListZoneCounts{Map: 1}},
+	}
+
+	changes := mapreconcile.Reconcile(prev, next)
+
+	if len(changes.Zones) != 7 {
+		t.Fatalf("expected 7 zones, got %d", len(changes.Zones))
+	}
+
+	if _, ok := changes.Zones[completionstore.Zone{MapID: 2, MapName: "jump_sync_final", ZoneType: tempushttp.ZoneTypeTrick, ZoneIndex: 1}]; !ok {
+		t.Fatalf("expected zones to use the new map names")
+	}
+
+	removedZones := []completionstore.Zone{
+		{MapID: 1, MapName: "jump_cow", ZoneType: tempushttp.ZoneTypeBonus, ZoneIndex: 2},
+		{MapID: 3, MapName: "jump_old", ZoneType: tempushttp.ZoneTypeMap, ZoneIndex: 1},
+	}
+
+	if !reflect.DeepEqual(changes.RemovedZones, removedZones) {
+		t.Fatalf("expected removed zones %+v, got %+v", removedZones, changes.RemovedZones)
+	}
+
+	if !reflect.DeepEqual(changes.AddedMaps, []uint64{4}) {
+		t.Fatalf("expected map 4 to be added, got %v", changes.AddedMaps)
+	}
+
+	if !reflect.DeepEqual(changes.RemovedMaps, []uint64{3}) {
+		t.Fatalf("expected map 3 to be removed, got %v", changes.RemovedMaps)
+	}
+
+	renames := []mapreconcile.Rename{{MapID: 2, OldName: "jump_sync_a2", NewName: "jump_sync_final"}}
+
+	if !reflect.DeepEqual(changes.Renames, renames) {
+		t.Fatalf("expected renames %+v, got %+v", renames, changes.Renames)
+	}
+}
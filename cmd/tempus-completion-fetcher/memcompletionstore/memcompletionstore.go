@@ -0,0 +1,889 @@
+// Package memcompletionstore keeps the completion store in memory, with the
+// semantics of the SQL stores, for tests.
+package memcompletionstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/jobqueue"
+	"tempus-completion/tempushttp"
+	"time"
+)
+
+type infoKey struct {
+	zone  completionstore.Zone
+	class tempushttp.ClassType
+}
+
+type resultKey struct {
+	playerID uint64
+	zone     completionstore.Zone
+	class    tempushttp.ClassType
+}
+
+type historyKey struct {
+	resultKey
+	duration time.Duration
+	date     time.Time
+}
+
+type zoneRow struct {
+	customName string
+	updated    time.Time
+	fetched    time.Time
+	retired    bool
+}
+
+type mapStatsRow struct {
+	info    completionstore.MapStatsInfo
+	retired bool
+}
+
+type infoRow struct {
+	info    completionstore.ZoneClassInfo
+	retired bool
+}
+
+type resultRow struct {
+	result  completionstore.PlayerClassZoneResult
+	retired bool
+}
+
+type playerMapRow struct {
+	latestUpdate          time.Time
+	latestProcessedUpdate time.Time
+	stats                 completionstore.PlayerMapStats
+}
+
+// DB is a completion store held in memory. Map names are kept by map ID and
+// custom names by zone, and filled in on whatever is returned, as the SQL
+// stores join them.
+type DB struct {
+	mu sync.Mutex
+
+	maps       []byte
+	mapNames   map[uint64]string
+	mapsAt     time.Time
+	steamIDs   map[string]uint64
+	zones      map[completionstore.Zone]zoneRow
+	mapStats   map[uint64]mapStatsRow
+	info       map[infoKey]infoRow
+	results    map[resultKey]resultRow
+	playerMaps map[completionstore.PlayerMap]playerMapRow
+	history    map[historyKey]completionstore.ResultHistory
+	events     []completionstore.Event
+
+	jobs    *jobqueue.Memory
+	created time.Time
+}
+
+func New() *DB {
+	return &DB{
+		mapNames:   make(map[uint64]string),
+		steamIDs:   make(map[string]uint64),
+		zones:      make(map[completionstore.Zone]zoneRow),
+		mapStats:   make(map[uint64]mapStatsRow),
+		info:       make(map[infoKey]infoRow),
+		results:    make(map[resultKey]resultRow),
+		playerMaps: make(map[completionstore.PlayerMap]playerMapRow),
+		history:    make(map[historyKey]completionstore.ResultHistory),
+		jobs:       jobqueue.NewMemory(),
+		created:    time.Now(),
+	}
+}
+
+// milli drops what the SQL stores do not keep of a time.
+func milli(t time.Time) time.Time {
+	return time.UnixMilli(t.UnixMilli())
+}
+
+func milliOrZero(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+
+	return milli(t)
+}
+
+func zoneKey(mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8) completionstore.Zone {
+	return completionstore.Zone{MapID: mapID, ZoneType: zoneType, ZoneIndex: zoneIndex}
+}
+
+// AppliedMigrations reports every migration as applied, there is no schema
+// to change.
+// named fills in the names of a result's map and zone.
+func (db *DB) named(r completionstore.PlayerClassZoneResult) completionstore.PlayerClassZoneResult {
+	r.MapName = db.mapNames[r.MapID]
+	r.CustomName = db.zones[zoneKey(r.MapID, r.ZoneType, r.ZoneIndex)].customName
+
+	return r
+}
+
+func (db *DB) namedInfo(info completionstore.ZoneClassInfo) completionstore.ZoneClassInfo {
+	info.MapName = db.mapNames[info.MapID]
+	info.CustomName = db.zones[zoneKey(info.MapID, info.ZoneType, info.ZoneIndex)].customName
+
+	return info
+}
+
+func (db *DB) AppliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	migrations, err := completionstore.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]time.Time, len(migrations))
+	for _, m := range migrations {
+		applied[m.Version] = db.created
+	}
+
+	return applied, nil
+}
+
+func (db *DB) ApplyMigration(ctx context.Context, m completionstore.Migration, t time.Time) error {
+	return nil
+}
+
+func (db *DB) Jobs() *jobqueue.Memory {
+	return db.jobs
+}
+
+// Events returns every inserted event, oldest first.
+func (db *DB) Events() []completionstore.Event {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return slices.Clone(db.events)
+}
+
+// CommitZone stores everything fetched for a zone, marking it fetched unless
+// Fetched is zero.
+func (db *DB) CommitZone(ctx context.Context, c completionstore.ZoneCommit) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !c.Fetched.IsZero() {
+		db.setZonesFetched([]completionstore.Zone{c.Zone}, c.Fetched)
+	}
+
+	db.insertPlayerClassZoneResults(c.Results)
+	db.insertZoneClassInfo(c.Info)
+	db.insertResultHistory(c.History)
+	db.insertEvents(c.Events)
+	db.insertSteamIDs(c.SteamIDs)
+
+	return nil
+}
+
+// GetZoneSchedule returns every zone with what the refresh scheduler needs to
+// know about it. Tracked players' latest completions are only looked up for
+// the given players.
+func (db *DB) GetZoneSchedule(ctx context.Context, trackedPlayers []uint64) ([]completionstore.ZoneSchedule, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	zones := make(map[completionstore.Zone]*completionstore.ZoneSchedule, len(db.zones))
+
+	for z, row := range db.zones {
+		if row.retired {
+			continue
+		}
+
+		s := &completionstore.ZoneSchedule{Zone: z, Fetched: row.fetched}
+		s.MapName = db.mapNames[z.MapID]
+
+		zones[z] = s
+	}
+
+	for k, row := range db.info {
+		if s, ok := zones[k.zone]; ok {
+			s.Completions += row.info.Completions
+		}
+	}
+
+	for k, row := range db.results {
+		s, ok := zones[k.zone]
+		if !ok {
+			continue
+		}
+
+		date := row.result.Date
+
+		if s.FirstResult.IsZero() || date.Before(s.FirstResult) {
+			s.FirstResult = date
+		}
+
+		if date.After(s.LastResult) {
+			s.LastResult = date
+		}
+
+		if slices.Contains(trackedPlayers, k.playerID) && date.After(s.LastTrackedResult) {
+			s.LastTrackedResult = date
+		}
+	}
+
+	schedule := make([]completionstore.ZoneSchedule, 0, len(zones))
+
+	for _, s := range zones {
+		schedule = append(schedule, *s)
+	}
+
+	return schedule, nil
+}
+
+func (db *DB) GetAllZoneClassInfo(ctx context.Context) ([]completionstore.ZoneClassInfo, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	infos := make([]completionstore.ZoneClassInfo, 0, len(db.info))
+
+	for _, row := range db.info {
+		if row.info.Tier == 0 || row.retired {
+			continue
+		}
+
+		infos = append(infos, db.namedInfo(row.info))
+	}
+
+	return infos, nil
+}
+
+// GetZoneClassInfo returns the stored info of the given zones, including
+// zones with a tier of zero.
+func (db *DB) GetZoneClassInfo(ctx context.Context, zones []completionstore.Zone) ([]completionstore.ZoneClassInfo, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	keys := make(map[completionstore.Zone]struct{}, len(zones))
+	for _, z := range zones {
+		keys[zoneKey(z.MapID, z.ZoneType, z.ZoneIndex)] = struct{}{}
+	}
+
+	infos := make([]completionstore.ZoneClassInfo, 0, len(zones)*2)
+
+	for k, row := range db.info {
+		if _, ok := keys[k.zone]; ok {
+			infos = append(infos, db.namedInfo(row.info))
+		}
+	}
+
+	return infos, nil
+}
+
+func (db *DB) SetZonesFetched(ctx context.Context, zones []completionstore.Zone, t time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.setZonesFetched(zones, t)
+
+	return nil
+}
+
+func (db *DB) setZonesFetched(zones []completionstore.Zone, t time.Time) {
+	for _, z := range zones {
+		k := zoneKey(z.MapID, z.ZoneType, z.ZoneIndex)
+
+		if row, ok := db.zones[k]; ok {
+			row.fetched = milliOrZero(t)
+			db.zones[k] = row
+		}
+	}
+}
+
+func (db *DB) InsertPlayerClassZoneResults(ctx context.Context, results []completionstore.PlayerClassZoneResult) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insertPlayerClassZoneResults(results)
+
+	return nil
+}
+
+// insertPlayerClassZoneResults upserts the results and marks the stats of
+// their players on their maps stale.
+func (db *DB) insertPlayerClassZoneResults(results []completionstore.PlayerClassZoneResult) {
+	latestUpdates := make(map[completionstore.PlayerMap]time.Time)
+
+	for _, r := range results {
+		r.Updated = milli(r.Updated)
+		r.Date = milli(r.Date)
+
+		k := resultKey{playerID: r.PlayerID, zone: zoneKey(r.MapID, r.ZoneType, r.ZoneIndex), class: r.Class}
+		db.results[k] = resultRow{result: r}
+
+		latestUpdates[completionstore.PlayerMap{PlayerID: r.PlayerID, MapID: r.MapID}] = r.Updated
+	}
+
+	for pm, t := range latestUpdates {
+		row, ok := db.playerMaps[pm]
+		if !ok {
+			row = playerMapRow{latestProcessedUpdate: time.UnixMilli(0)}
+		}
+
+		row.latestUpdate = t
+		db.playerMaps[pm] = row
+	}
+}
+
+// GetZoneResults returns every stored result on the given zones.
+func (db *DB) GetZoneResults(ctx context.Context, zones []completionstore.Zone) ([]completionstore.PlayerClassZoneResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	keys := make(map[completionstore.Zone]struct{}, len(zones))
+	for _, z := range zones {
+		keys[zoneKey(z.MapID, z.ZoneType, z.ZoneIndex)] = struct{}{}
+	}
+
+	results := make([]completionstore.PlayerClassZoneResult, 0, len(zones)*100)
+
+	for k, row := range db.results {
+		if _, ok := keys[k.zone]; ok {
+			results = append(results, db.stored(row.result))
+		}
+	}
+
+	return results, nil
+}
+
+// stored returns a result as the SQL stores return it, named and without
+// when it was updated.
+func (db *DB) stored(r completionstore.PlayerClassZoneResult) completionstore.PlayerClassZoneResult {
+	r = db.named(r)
+	r.Updated = time.Time{}
+
+	return r
+}
+
+func (db *DB) InsertEvents(ctx context.Context, events []completionstore.Event) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insertEvents(events)
+
+	return nil
+}
+
+func (db *DB) insertEvents(events []completionstore.Event) {
+	for _, e := range events {
+		e.Created = milli(e.Created)
+		e.Date = milliOrZero(e.Date)
+
+		db.events = append(db.events, e)
+	}
+}
+
+// InsertResultHistory keeps every distinct duration and date seen for a
+// player's results. Runs already in the history are left as first observed.
+func (db *DB) InsertResultHistory(ctx context.Context, results []completionstore.PlayerClassZoneResult) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insertResultHistory(results)
+
+	return nil
+}
+
+func (db *DB) insertResultHistory(results []completionstore.PlayerClassZoneResult) {
+	for _, r := range results {
+		k := historyKey{
+			resultKey: resultKey{playerID: r.PlayerID, zone: zoneKey(r.MapID, r.ZoneType, r.ZoneIndex), class: r.Class},
+			duration:  r.Duration,
+			date:      milli(r.Date),
+		}
+
+		if _, ok := db.history[k]; ok {
+			continue
+		}
+
+		db.history[k] = completionstore.ResultHistory{
+			Class:    r.Class,
+			Rank:     r.Rank,
+			Duration: r.Duration,
+			Date:     k.date,
+			Observed: milli(r.Updated),
+		}
+	}
+}
+
+// GetPlayerZoneHistory returns a player's runs on a zone for a class, oldest
+// first.
+func (db *DB) GetPlayerZoneHistory(ctx context.Context, playerID, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, class tempushttp.ClassType) ([]completionstore.ResultHistory, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	want := resultKey{playerID: playerID, zone: zoneKey(mapID, zoneType, zoneIndex), class: class}
+
+	history := make([]completionstore.ResultHistory, 0, 8)
+
+	for k, h := range db.history {
+		if k.resultKey == want {
+			history = append(history, h)
+		}
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		if !history[i].Date.Equal(history[j].Date) {
+			return history[i].Date.Before(history[j].Date)
+		}
+
+		return history[i].Duration > history[j].Duration
+	})
+
+	return history, nil
+}
+
+// InsertZones adds new zones and updates the names of their maps, keeping
+// when they were last fetched. Zones that had been retired are restored.
+func (db *DB) InsertZones(ctx context.Context, zones map[completionstore.Zone]struct{}) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	updated := milli(time.Now())
+
+	for z := range zones {
+		k := zoneKey(z.MapID, z.ZoneType, z.ZoneIndex)
+
+		row := db.zones[k]
+		row.updated = updated
+		row.retired = false
+
+		db.zones[k] = row
+		db.mapNames[z.MapID] = z.MapName
+	}
+
+	return nil
+}
+
+// RetireZones hides zones that are no longer in the map list, along with
+// their info and results, and marks the stats of every player on their maps
+// for recomputation.
+func (db *DB) RetireZones(ctx context.Context, zones []completionstore.Zone, t time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	retired := make(map[completionstore.Zone]struct{}, len(zones))
+	mapIDs := make(map[uint64]struct{})
+
+	for _, z := range zones {
+		k := zoneKey(z.MapID, z.ZoneType, z.ZoneIndex)
+
+		if row, ok := db.zones[k]; ok {
+			row.retired = true
+			db.zones[k] = row
+		}
+
+		retired[k] = struct{}{}
+		mapIDs[z.MapID] = struct{}{}
+	}
+
+	for k, row := range db.info {
+		if _, ok := retired[k.zone]; ok {
+			row.retired = true
+			db.info[k] = row
+		}
+	}
+
+	for k, row := range db.results {
+		if _, ok := retired[k.zone]; ok {
+			row.retired = true
+			db.results[k] = row
+		}
+	}
+
+	db.stalePlayerMaps(mapIDs, t)
+
+	return nil
+}
+
+// RetireMaps hides the stats of maps that are no longer in the map list.
+func (db *DB) RetireMaps(ctx context.Context, mapIDs []uint64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, mapID := range mapIDs {
+		if row, ok := db.mapStats[mapID]; ok {
+			row.retired = true
+			db.mapStats[mapID] = row
+		}
+	}
+
+	return nil
+}
+
+// RenameMaps sets the given maps' names, by map ID, and marks the stats of
+// every player on them for recomputation. Events and history keep the name
+// the map had at the time.
+func (db *DB) RenameMaps(ctx context.Context, names map[uint64]string, t time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	mapIDs := make(map[uint64]struct{}, len(names))
+
+	for mapID, name := range names {
+		db.mapNames[mapID] = name
+		mapIDs[mapID] = struct{}{}
+	}
+
+	db.stalePlayerMaps(mapIDs, t)
+
+	return nil
+}
+
+// stalePlayerMaps bumps the latest update of every player's stats on the given
+// maps, so that GetStalePlayerMaps returns them again.
+func (db *DB) stalePlayerMaps(mapIDs map[uint64]struct{}, t time.Time) {
+	for pm, row := range db.playerMaps {
+		if _, ok := mapIDs[pm.MapID]; ok {
+			row.latestUpdate = milli(t)
+			db.playerMaps[pm] = row
+		}
+	}
+}
+
+func (db *DB) InsertMapStats(ctx context.Context, stats map[uint64]completionstore.MapStatsInfo) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for mapID, info := range stats {
+		db.mapStats[mapID] = mapStatsRow{info: info}
+	}
+
+	return nil
+}
+
+// GetMapStats returns the stats of a map that has not been retired.
+func (db *DB) GetMapStats(mapID uint64) (completionstore.MapStatsInfo, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	row, ok := db.mapStats[mapID]
+	if !ok || row.retired {
+		return completionstore.MapStatsInfo{}, false
+	}
+
+	info := row.info
+	info.MapName = db.mapNames[mapID]
+
+	return info, true
+}
+
+func (db *DB) SetPlayerMapsProcessed(ctx context.Context, maps []completionstore.StalePlayerMap) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, m := range maps {
+		if row, ok := db.playerMaps[m.PlayerMap]; ok {
+			row.latestProcessedUpdate = milli(m.LatestUpdate)
+			db.playerMaps[m.PlayerMap] = row
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) InsertPlayerMapStats(ctx context.Context, stats map[completionstore.PlayerMap]completionstore.PlayerMapStats) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for pm, pmstats := range stats {
+		if row, ok := db.playerMaps[pm]; ok {
+			row.stats = pmstats
+			db.playerMaps[pm] = row
+		}
+	}
+
+	return nil
+}
+
+// GetPlayerMapStats returns the stats of a player on a map.
+func (db *DB) GetPlayerMapStats(pm completionstore.PlayerMap) (completionstore.PlayerMapStats, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	row, ok := db.playerMaps[pm]
+
+	return row.stats, ok
+}
+
+func (db *DB) GetStalePlayerMaps(ctx context.Context) ([]completionstore.StalePlayerMap, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	const limit = 10000
+
+	playerMaps := make([]completionstore.StalePlayerMap, 0, 64)
+
+	for pm, row := range db.playerMaps {
+		if row.latestUpdate.Equal(row.latestProcessedUpdate) {
+			continue
+		}
+
+		playerMaps = append(playerMaps, completionstore.StalePlayerMap{PlayerMap: pm, LatestUpdate: row.latestUpdate})
+
+		if len(playerMaps) == limit {
+			break
+		}
+	}
+
+	return playerMaps, nil
+}
+
+func (db *DB) GetPlayerMapResults(ctx context.Context, playerMaps []completionstore.StalePlayerMap) (map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	want := make(map[completionstore.PlayerMap]struct{}, len(playerMaps))
+	for _, pm := range playerMaps {
+		want[pm.PlayerMap] = struct{}{}
+	}
+
+	maps := make(map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, len(playerMaps))
+
+	for k, row := range db.results {
+		pm := completionstore.PlayerMap{PlayerID: k.playerID, MapID: k.zone.MapID}
+
+		if _, ok := want[pm]; !ok || row.retired || row.result.Tier == 0 {
+			continue
+		}
+
+		maps[pm] = append(maps[pm], db.stored(row.result))
+	}
+
+	return maps, nil
+}
+
+// GetPlayerZones returns every zone a player has a result on.
+func (db *DB) GetPlayerZones(ctx context.Context, playerID uint64) ([]completionstore.Zone, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	seen := make(map[completionstore.Zone]struct{})
+
+	for k, row := range db.results {
+		if k.playerID != playerID || row.retired {
+			continue
+		}
+
+		z := k.zone
+		z.MapName = db.mapNames[z.MapID]
+
+		seen[z] = struct{}{}
+	}
+
+	zones := make([]completionstore.Zone, 0, len(seen))
+
+	for z := range seen {
+		zones = append(zones, z)
+	}
+
+	return zones, nil
+}
+
+// playerResults returns a player's results that are not retired and pass the
+// filters, newest first.
+func (db *DB) playerResults(playerID uint64, keep func(completionstore.PlayerClassZoneResult) bool) []completionstore.PlayerClassZoneResult {
+	results := make([]completionstore.PlayerClassZoneResult, 0, 64)
+
+	for k, row := range db.results {
+		if k.playerID != playerID || row.retired || row.result.ZoneType == tempushttp.ZoneTypeTrick {
+			continue
+		}
+
+		if keep(row.result) {
+			results = append(results, db.stored(row.result))
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Date.After(results[j].Date)
+	})
+
+	return results
+}
+
+func (db *DB) GetPlayerResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	results := db.playerResults(playerID, func(r completionstore.PlayerClassZoneResult) bool {
+		return matches(r.ZoneType, r.Tier, r.Class, zoneTypes, tiers, classes)
+	})
+
+	return results, len(results) > 0, nil
+}
+
+func (db *DB) GetPlayerRecentResults(ctx context.Context, playerID uint64) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	results := db.playerResults(playerID, func(completionstore.PlayerClassZoneResult) bool {
+		return true
+	})
+
+	if len(results) > 10 {
+		results = results[:10]
+	}
+
+	return results, len(results) > 0, nil
+}
+
+func matches(zoneType tempushttp.ZoneType, tier uint8, class tempushttp.ClassType, zoneTypes []string, tiers, classes []uint8) bool {
+	return slices.Contains(zoneTypes, string(zoneType)) && slices.Contains(tiers, tier) && slices.Contains(classes, uint8(class))
+}
+
+// joined returns info with the player's result on it, if any, as a LEFT JOIN
+// of zone_class_info with player_class_zone_results does.
+func (db *DB) joined(playerID uint64, k infoKey, info completionstore.ZoneClassInfo) completionstore.PlayerClassZoneResult {
+	r := completionstore.PlayerClassZoneResult{
+		MapID:       info.MapID,
+		ZoneType:    info.ZoneType,
+		ZoneIndex:   info.ZoneIndex,
+		PlayerID:    playerID,
+		Class:       info.Class,
+		CustomName:  db.zones[k.zone].customName,
+		MapName:     db.mapNames[k.zone.MapID],
+		Tier:        info.Tier,
+		Date:        time.UnixMilli(0),
+		Completions: info.Completions,
+	}
+
+	// the join does not look at whether the result is retired
+	if row, ok := db.results[resultKey{playerID: playerID, zone: k.zone, class: k.class}]; ok {
+		r.Rank = row.result.Rank
+		r.Duration = row.result.Duration
+		r.Date = row.result.Date
+	}
+
+	return r
+}
+
+func (db *DB) GetPlayerMapClassResults(ctx context.Context, playerID, mapID uint64, class tempushttp.ClassType) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	results := make([]completionstore.PlayerClassZoneResult, 0, 8)
+
+	for k, row := range db.info {
+		if k.zone.MapID != mapID || k.class != class || k.zone.ZoneType == tempushttp.ZoneTypeTrick || row.retired {
+			continue
+		}
+
+		results = append(results, db.joined(playerID, k, row.info))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Date.After(results[j].Date)
+	})
+
+	return results, len(results) > 0, nil
+}
+
+func (db *DB) GetPlayerClassZoneResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	results := make([]completionstore.PlayerClassZoneResult, 0, len(db.info))
+
+	for k, row := range db.info {
+		if row.retired || !matches(row.info.ZoneType, row.info.Tier, row.info.Class, zoneTypes, tiers, classes) {
+			continue
+		}
+
+		results = append(results, db.joined(playerID, k, row.info))
+	}
+
+	return results, len(results) > 0, nil
+}
+
+func (db *DB) InsertZoneClassInfo(ctx context.Context, info []completionstore.ZoneClassInfo) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insertZoneClassInfo(info)
+
+	return nil
+}
+
+// insertZoneClassInfo upserts the info and sets the custom names of its
+// zones.
+func (db *DB) insertZoneClassInfo(info []completionstore.ZoneClassInfo) {
+	for _, zi := range info {
+		k := zoneKey(zi.MapID, zi.ZoneType, zi.ZoneIndex)
+
+		db.info[infoKey{zone: k, class: zi.Class}] = infoRow{info: zi}
+
+		if row, ok := db.zones[k]; ok {
+			row.customName = zi.CustomName
+			db.zones[k] = row
+		}
+	}
+}
+
+func (db *DB) InsertMaps(ctx context.Context, list *completionstore.MapList) error {
+	b, err := json.Marshal(list.Response)
+	if err != nil {
+		return fmt.Errorf("marshal response: %w", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.maps = b
+	db.mapsAt = milli(list.Updated)
+
+	return nil
+}
+
+func (db *DB) GetMaps(ctx context.Context) (*completionstore.MapList, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.maps == nil {
+		return &completionstore.MapList{}, nil
+	}
+
+	var response tempushttp.GetDetailedMapListResponse
+
+	if err := json.Unmarshal(db.maps, &response); err != nil {
+		return nil, fmt.Errorf("unmarshal data: %w", err)
+	}
+
+	list := &completionstore.MapList{
+		Updated:  db.mapsAt,
+		Response: response,
+	}
+
+	return list, nil
+}
+
+func (db *DB) InsertSteamIDs(ctx context.Context, steamIDs map[string]uint64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insertSteamIDs(steamIDs)
+
+	return nil
+}
+
+func (db *DB) insertSteamIDs(steamIDs map[string]uint64) {
+	for steamID, playerID := range steamIDs {
+		if _, ok := db.steamIDs[steamID]; !ok {
+			db.steamIDs[steamID] = playerID
+		}
+	}
+}
+
+func (db *DB) GetPlayerBySteamID(ctx context.Context, steamID string) (uint64, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	playerID, ok := db.steamIDs[steamID]
+
+	return playerID, ok, nil
+}
@@ -0,0 +1,13 @@
+package memcompletionstore_test
+
+import (
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstoretest"
+	"tempus-completion/cmd/tempus-completion-fetcher/memcompletionstore"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	completionstoretest.Run(t, func(t *testing.T) completionstoretest.Store {
+		return memcompletionstore.New()
+	})
+}
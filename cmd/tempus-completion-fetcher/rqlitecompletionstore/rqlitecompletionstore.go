@@ -2,10 +2,13 @@ package rqlitecompletionstore
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log/slog"
+	"slices"
 	"strings"
 	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/sqlstore"
+	"tempus-completion/jobqueue"
 	"tempus-completion/tempushttp"
 	"time"
 
@@ -13,10 +16,34 @@ import (
 )
 
 type DB struct {
-	conn *gorqlite.Connection
+	conn      *gorqlite.Connection
+	logger    *slog.Logger
+	chunkSize int
 }
 
-func New(addr string) (*DB, error) {
+// DefaultWriteChunkSize is how many statements go in one request by default.
+// Inserts carry up to 200 rows per statement.
+const DefaultWriteChunkSize = 100
+
+type Option func(*DB)
+
+// WithLogger logs every query at debug level, with the fields carried by
+// its context.
+func WithLogger(logger *slog.Logger) Option {
+	return func(db *DB) {
+		db.logger = logger
+	}
+}
+
+// WithWriteChunkSize splits writes into requests, each its own transaction,
+// of up to n statements. Migrations are always sent in one request.
+func WithWriteChunkSize(n int) Option {
+	return func(db *DB) {
+		db.chunkSize = n
+	}
+}
+
+func New(addr string, opts ...Option) (*DB, error) {
 	conn, err := gorqlite.Open(addr)
 	if err != nil {
 		return nil, fmt.Errorf("open connection: %w", err)
@@ -31,1321 +58,722 @@ func New(addr string) (*DB, error) {
 	}
 
 	db := &DB{
-		conn: conn,
+		conn:      conn,
+		logger:    slog.Default(),
+		chunkSize: DefaultWriteChunkSize,
 	}
 
-	return db, nil
-}
-
-func (db *DB) GetStaleZones(ctx context.Context, threshold time.Time) ([]completionstore.Zone, error) {
-	const q = `
-SELECT
-	map_id,
-	zone_type,
-	zone_index,
-	map_name
-FROM
-	zones
-WHERE
-	fetched < ?
-LIMIT 5;
-`
-
-	param := gorqlite.ParameterizedStatement{
-		Query:     q,
-		Arguments: []any{threshold.UnixMilli()},
+	for _, opt := range opts {
+		opt(db)
 	}
 
-	results, err := db.conn.QueryOneParameterizedContext(ctx, param)
-	if err != nil {
-		return nil, fmt.Errorf("do query: %w: %w", err, results.Err)
+	if db.chunkSize < 1 {
+		return nil, fmt.Errorf("write chunk size must be at least 1")
 	}
 
-	zones := make([]completionstore.Zone, 0, 5)
-
-	var (
-		mapID     int
-		zoneIndex int
-		zoneType  string
-		mapName   string
-	)
-
-	for results.Next() {
-
-		if err := results.Scan(&mapID, &zoneType, &zoneIndex, &mapName); err != nil {
-			return nil, fmt.Errorf("scan results: %w", err)
-		}
-
-		z := completionstore.Zone{
-			MapID:     uint64(mapID),
-			MapName:   mapName,
-			ZoneType:  tempushttp.ZoneType(zoneType),
-			ZoneIndex: uint8(zoneIndex),
-		}
+	return db, nil
+}
 
-		zones = append(zones, z)
+func (db *DB) logQuery(ctx context.Context, params []gorqlite.ParameterizedStatement, start time.Time, err error) {
+	if !db.logger.Enabled(ctx, slog.LevelDebug) || len(params) == 0 {
+		return
 	}
 
-	return zones, nil
-}
+	query := strings.Join(strings.Fields(params[0].Query), " ")
+	if len(query) > 80 {
+		query = query[:80]
+	}
 
-func (db *DB) GetAllZoneClassInfo(ctx context.Context) ([]completionstore.ZoneClassInfo, error) {
-	const q = `
-SELECT
-	map_id,
-	zone_type,
-	zone_index,
-	class,
-	map_name,
-	custom_name,
-	tier,
-	completions
-FROM
-	zone_class_info
-WHERE
-	tier != 0;
-`
-
-	param := gorqlite.ParameterizedStatement{
-		Query:     q,
-		Arguments: []any{},
+	attrs := []slog.Attr{
+		slog.String("query", query),
+		slog.Int("statements", len(params)),
+		slog.Duration("latency", time.Since(start)),
 	}
 
-	results, err := db.conn.QueryOneParameterizedContext(ctx, param)
 	if err != nil {
-		return nil, fmt.Errorf("do query: %w: %w", err, results.Err)
+		attrs = append(attrs, slog.String("error", err.Error()))
 	}
 
-	zones := make([]completionstore.ZoneClassInfo, 0, 4100)
-
-	var (
-		mapID       int
-		zoneType    string
-		zoneIndex   int
-		class       int
-		mapName     string
-		customName  string
-		tier        int
-		completions int
-	)
-
-	for results.Next() {
+	db.logger.LogAttrs(ctx, slog.LevelDebug, "store query", attrs...)
+}
 
-		if err := results.Scan(&mapID, &zoneType, &zoneIndex, &class, &mapName, &customName, &tier, &completions); err != nil {
-			return nil, fmt.Errorf("scan results: %w", err)
-		}
+func (db *DB) queryOne(ctx context.Context, param gorqlite.ParameterizedStatement) (gorqlite.QueryResult, error) {
+	start := time.Now()
+	result, err := db.conn.QueryOneParameterizedContext(ctx, param)
+	db.logQuery(ctx, []gorqlite.ParameterizedStatement{param}, start, err)
 
-		info := completionstore.ZoneClassInfo{
-			MapID:       uint64(mapID),
-			ZoneType:    tempushttp.ZoneType(zoneType),
-			ZoneIndex:   uint8(zoneIndex),
-			Class:       tempushttp.ClassType(class),
-			MapName:     mapName,
-			CustomName:  customName,
-			Tier:        uint8(tier),
-			Completions: uint32(completions),
-		}
+	return result, err
+}
 
-		zones = append(zones, info)
-	}
+func (db *DB) queryAll(ctx context.Context, params []gorqlite.ParameterizedStatement) ([]gorqlite.QueryResult, error) {
+	start := time.Now()
+	results, err := db.conn.QueryParameterizedContext(ctx, params)
+	db.logQuery(ctx, params, start, err)
 
-	return zones, nil
+	return results, err
 }
 
-func (db *DB) SetZonesFetched(ctx context.Context, zones []completionstore.Zone, t time.Time) error {
-	params := make([]gorqlite.ParameterizedStatement, 0, len(zones))
-
-	const q = "UPDATE zones SET fetched = ? WHERE map_id = ? AND zone_type = ? AND zone_index = ?"
+func (db *DB) writeOne(ctx context.Context, param gorqlite.ParameterizedStatement) (gorqlite.WriteResult, error) {
+	start := time.Now()
+	result, err := db.conn.WriteOneParameterizedContext(ctx, param)
+	db.logQuery(ctx, []gorqlite.ParameterizedStatement{param}, start, err)
 
-	for _, z := range zones {
-		p := gorqlite.ParameterizedStatement{
-			Query:     q,
-			Arguments: []any{t.UnixMilli(), z.MapID, z.ZoneType, z.ZoneIndex},
-		}
+	return result, err
+}
 
-		params = append(params, p)
-	}
+func (db *DB) writeAll(ctx context.Context, params []gorqlite.ParameterizedStatement) ([]gorqlite.WriteResult, error) {
+	start := time.Now()
+	results, err := db.conn.WriteParameterizedContext(ctx, params)
+	db.logQuery(ctx, params, start, err)
 
-	dbresults, err := db.conn.WriteParameterizedContext(ctx, params)
+	return results, err
+}
 
-	for _, r := range dbresults {
-		if r.Err != nil {
-			return fmt.Errorf("result error: %w: %w", err, r.Err)
+// write runs the statements in order, in transactions of up to chunkSize
+// statements, and stops at the first chunk that fails. Earlier chunks stay
+// written.
+func (db *DB) write(ctx context.Context, statements []sqlstore.Statement) error {
+	for chunk := range slices.Chunk(toParams(statements), db.chunkSize) {
+		results, err := db.writeAll(ctx, chunk)
+		if err := checkWrite(results, len(chunk), err); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (db *DB) InsertPlayerClassZoneResults(ctx context.Context, results []completionstore.PlayerClassZoneResult) error {
-	params := make([]gorqlite.ParameterizedStatement, 0, len(results))
-
-	const q1 = `
-INSERT INTO
-	player_class_zone_results (
-		player_id,
-		map_id,
-		zone_type,
-		zone_index,
-		class,
-		custom_name,
-		map_name,
-		tier,
-		updated,
-		rank,
-		duration,
-		date,
-		completions
-	)
-VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT
-	(player_id, map_id, zone_type, zone_index, class)
-DO UPDATE SET
-	custom_name = excluded.custom_name,
-	map_name = excluded.map_name,
-	tier = excluded.tier,
-	updated = excluded.updated,
-	rank = excluded.rank,
-	duration = excluded.duration,
-	date = excluded.date,
-	completions = excluded.completions;
-`
-
-	latestUpdates := make(map[completionstore.PlayerMap]time.Time)
-
+// checkWrite returns the first error of a request of n statements.
+func checkWrite(results []gorqlite.WriteResult, n int, err error) error {
 	for _, r := range results {
-		p := gorqlite.ParameterizedStatement{
-			Query: q1,
-			Arguments: []any{
-				r.PlayerID,
-				r.MapID,
-				r.ZoneType,
-				r.ZoneIndex,
-				r.Class,
-				r.CustomName,
-				r.MapName,
-				r.Tier,
-				r.Updated.UnixMilli(),
-				r.Rank,
-				r.Duration,
-				r.Date.UnixMilli(),
-				r.Completions,
-			},
-		}
-
-		params = append(params, p)
-
-		pm := completionstore.PlayerMap{
-			PlayerID: r.PlayerID,
-			MapID:    r.MapID,
+		if r.Err != nil {
+			return fmt.Errorf("result error: %w", r.Err)
 		}
-
-		latestUpdates[pm] = r.Updated
 	}
 
-	const q2 = `
-INSERT INTO
-	player_map_stats (
-		player_id,
-		map_id,
-		latest_update,
-		latest_processed_update,
-		data
-	)
-VALUES
-	(?, ?, ?, ?, ?)
-ON CONFLICT
-	(player_id, map_id)
-DO UPDATE SET
-	latest_update = excluded.latest_update
-`
-
-	for pm, t := range latestUpdates {
-		p := gorqlite.ParameterizedStatement{
-			Query:     q2,
-			Arguments: []any{pm.PlayerID, pm.MapID, t.UnixMilli(), 0, "{}"},
-		}
-
-		params = append(params, p)
+	if err != nil {
+		return fmt.Errorf("do query: %w", err)
 	}
 
-	dbresults, err := db.conn.WriteParameterizedContext(ctx, params)
-
-	for _, r := range dbresults {
-		if r.Err != nil {
-			return fmt.Errorf("result error: %w: %w", err, r.Err)
-		}
+	if len(results) != n {
+		return fmt.Errorf("got %d results for %d statements", len(results), n)
 	}
 
 	return nil
 }
 
-func (db *DB) InsertZones(ctx context.Context, zones map[completionstore.Zone]struct{}) error {
-	const q2 = `
-INSERT INTO zones (map_id, zone_type, zone_index, map_name, updated, fetched)
-VALUES (?, ?, ?, ?, ?, ?)
-ON CONFLICT (map_id, zone_type, zone_index) DO NOTHING;
-`
-
-	params := make([]gorqlite.ParameterizedStatement, 0, len(zones))
-
-	const q1 = "DELETE FROM zones;"
+// toParams converts statements to gorqlite's.
+func toParams(statements []sqlstore.Statement) []gorqlite.ParameterizedStatement {
+	params := make([]gorqlite.ParameterizedStatement, 0, len(statements))
 
-	zonesDelete := gorqlite.ParameterizedStatement{
-		Query:     q1,
-		Arguments: []any{},
+	for _, s := range statements {
+		params = append(params, toParam(s))
 	}
 
-	params = append(params, zonesDelete)
-
-	updated := time.Now()
+	return params
+}
 
-	for zone := range zones {
-		param := gorqlite.ParameterizedStatement{
-			Query:     q2,
-			Arguments: []any{zone.MapID, zone.ZoneType, zone.ZoneIndex, zone.MapName, updated.UnixMilli(), 0},
-		}
+func toParam(s sqlstore.Statement) gorqlite.ParameterizedStatement {
+	args := s.Args
+	if args == nil {
+		args = []any{}
+	}
 
-		params = append(params, param)
+	return gorqlite.ParameterizedStatement{
+		Query:     s.Query,
+		Arguments: args,
 	}
+}
 
-	results, err := db.conn.WriteParameterizedContext(ctx, params)
+// each calls f for every row the statement returns.
+func (db *DB) each(ctx context.Context, s sqlstore.Statement, f func(sqlstore.Scanner) error) error {
+	results, err := db.queryOne(ctx, toParam(s))
+	if err != nil {
+		return fmt.Errorf("do query: %w: %w", err, results.Err)
+	}
 
-	for _, r := range results {
-		if r.Err != nil {
-			return fmt.Errorf("result error: %w: %w", err, r.Err)
+	for results.Next() {
+		if err := f(&results); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (db *DB) InsertMapStats(ctx context.Context, stats map[uint64]completionstore.MapStatsInfo) error {
-	const q = `
-INSERT INTO
-	map_stats (
-		map_id,
-		map_name,
-		data
-	)
-VALUES
-	(?, ?, ?)
-ON CONFLICT
-	(map_id)
-DO UPDATE SET
-	map_name = excluded.map_name,
-	data = excluded.data;
-`
-
-	params := make([]gorqlite.ParameterizedStatement, 0, len(stats))
-
-	for mapID, info := range stats {
-		b, err := json.Marshal(info.Stats)
-		if err != nil {
-			return fmt.Errorf("marshal stats: %w", err)
-		}
-
-		param := gorqlite.ParameterizedStatement{
-			Query:     q,
-			Arguments: []any{mapID, info.MapName, string(b)},
-		}
-
-		params = append(params, param)
+// eachAll calls f for every row the statements return, sending them in one
+// request.
+func (db *DB) eachAll(ctx context.Context, statements []sqlstore.Statement, f func(sqlstore.Scanner) error) error {
+	dbresults, err := db.queryAll(ctx, toParams(statements))
+	if err != nil {
+		return fmt.Errorf("do query: %w", err)
 	}
 
-	results, err := db.conn.WriteParameterizedContext(ctx, params)
-
-	for _, r := range results {
+	for _, r := range dbresults {
 		if r.Err != nil {
-			return fmt.Errorf("result error: %w: %w", err, r.Err)
+			return fmt.Errorf("result error: %w", r.Err)
+		}
+
+		for r.Next() {
+			if err := f(&r); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (db *DB) SetPlayerMapsProcessed(ctx context.Context, maps []completionstore.StalePlayerMap) error {
-	params := make([]gorqlite.ParameterizedStatement, 0, len(maps))
+// exec runs a single write.
+func (db *DB) exec(ctx context.Context, s sqlstore.Statement) (gorqlite.WriteResult, error) {
+	result, err := db.writeOne(ctx, toParam(s))
+	if err != nil {
+		return result, fmt.Errorf("do query: %w: %w", err, result.Err)
+	}
 
-	const q = "UPDATE player_map_stats SET latest_processed_update = ? WHERE player_id = ? AND map_id = ?;"
+	return result, nil
+}
 
-	for _, m := range maps {
-		p := gorqlite.ParameterizedStatement{
-			Query:     q,
-			Arguments: []any{m.LatestUpdate.UnixMilli(), m.PlayerID, m.MapID},
-		}
+// queryResults returns the results the statements select.
+func (db *DB) queryResults(ctx context.Context, statements ...sqlstore.Statement) ([]completionstore.PlayerClassZoneResult, error) {
+	results := make([]completionstore.PlayerClassZoneResult, 0, 64)
 
-		params = append(params, p)
-	}
+	err := db.eachAll(ctx, statements, func(rows sqlstore.Scanner) error {
+		r, err := sqlstore.ScanResult(rows)
+		if err != nil {
+			return err
+		}
 
-	dbresults, err := db.conn.WriteParameterizedContext(ctx, params)
+		results = append(results, r)
 
-	for _, r := range dbresults {
-		if r.Err != nil {
-			return fmt.Errorf("result error: %w: %w", err, r.Err)
-		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return results, nil
 }
 
-func (db *DB) InsertPlayerMapStats(ctx context.Context, stats map[completionstore.PlayerMap]completionstore.PlayerMapStats) error {
+// queryInfo returns the zone class info the statements select.
+func (db *DB) queryInfo(ctx context.Context, statements ...sqlstore.Statement) ([]completionstore.ZoneClassInfo, error) {
+	infos := make([]completionstore.ZoneClassInfo, 0, 64)
 
-	params := make([]gorqlite.ParameterizedStatement, 0, len(stats))
-
-	const q1 = `
-UPDATE
-	player_map_stats
-SET
-	data = ?
-WHERE
-	player_id = ? AND map_id = ?;
-`
-	for pm, pmstats := range stats {
-		b, err := json.Marshal(pmstats)
+	err := db.eachAll(ctx, statements, func(rows sqlstore.Scanner) error {
+		info, err := sqlstore.ScanInfo(rows)
 		if err != nil {
-			return fmt.Errorf("marshal map stats: %w", err)
+			return err
 		}
 
-		p := gorqlite.ParameterizedStatement{
-			Query:     q1,
-			Arguments: []any{string(b), pm.PlayerID, pm.MapID},
-		}
+		infos = append(infos, info)
 
-		params = append(params, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	results, _ := db.conn.WriteParameterizedContext(ctx, params)
-
-	for _, r := range results {
-		if r.Err != nil {
-			return fmt.Errorf("result error: %w", r.Err)
-		}
-	}
+	return infos, nil
+}
 
-	return nil
+// CommitZone stores everything fetched for a zone, marking it fetched unless
+// Fetched is zero, in a single transaction unless it is larger than a chunk.
+func (db *DB) CommitZone(ctx context.Context, c completionstore.ZoneCommit) error {
+	return db.write(ctx, sqlstore.CommitZone(c))
 }
 
-func (db *DB) GetPlayerResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
+// GetZoneSchedule returns every zone with what the refresh scheduler needs to
+// know about it. Tracked players' latest completions are only looked up for
+// the given players.
+func (db *DB) GetZoneSchedule(ctx context.Context, trackedPlayers []uint64) ([]completionstore.ZoneSchedule, error) {
+	zones := make([]completionstore.ZoneSchedule, 0, 3000)
+	indexes := make(map[completionstore.Zone]int, 3000)
 
-	const qstart = `
-SELECT
-	player_class_zone_results.map_id,
-	player_class_zone_results.zone_type,
-	player_class_zone_results.zone_index,
-	player_class_zone_results.class,
-	player_class_zone_results.map_name,
-	player_class_zone_results.custom_name,
-	player_class_zone_results.tier,
-	player_class_zone_results.rank,
-	player_class_zone_results.duration,
-	player_class_zone_results.date,
-	player_class_zone_results.completions
-FROM
-	player_class_zone_results
-WHERE
-	player_class_zone_results.player_id = ? AND
-	player_class_zone_results.zone_type != 'trick' AND
-`
-
-	const qend = `
- ORDER BY player_class_zone_results.date DESC;
-	`
-	args := make([]any, 0, 1+len(zoneTypes)+len(tiers)+len(classes))
-	args = append(args, playerID)
-
-	inClauses := []inClause{
-		{
-			n:     len(zoneTypes),
-			field: "player_class_zone_results.zone_type",
-		},
-		{
-			n:     len(tiers),
-			field: "player_class_zone_results.tier",
-		},
-		{
-			n:     len(classes),
-			field: "player_class_zone_results.class",
-		},
-	}
+	err := db.each(ctx, sqlstore.ZoneSchedule(), func(rows sqlstore.Scanner) error {
+		z, err := sqlstore.ScanZoneSchedule(rows)
+		if err != nil {
+			return err
+		}
 
-	inClause := buildInClauses(inClauses)
+		indexes[completionstore.Zone{MapID: z.MapID, ZoneType: z.ZoneType, ZoneIndex: z.ZoneIndex}] = len(zones)
+		zones = append(zones, z)
 
-	for _, zt := range zoneTypes {
-		args = append(args, zt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	for _, t := range tiers {
-		args = append(args, t)
+	if len(trackedPlayers) == 0 {
+		return zones, nil
 	}
 
-	for _, c := range classes {
-		args = append(args, c)
-	}
+	err = db.each(ctx, sqlstore.TrackedResults(trackedPlayers), func(rows sqlstore.Scanner) error {
+		z, lastDate, err := sqlstore.ScanTrackedResult(rows)
+		if err != nil {
+			return err
+		}
 
-	param := gorqlite.ParameterizedStatement{
-		Query:     qstart + inClause + qend,
-		Arguments: args,
-	}
+		if i, ok := indexes[z]; ok {
+			zones[i].LastTrackedResult = lastDate
+		}
 
-	dbresults, err := db.conn.QueryOneParameterizedContext(ctx, param)
+		return nil
+	})
 	if err != nil {
-		return nil, false, fmt.Errorf("do query: %w: %w", err, dbresults.Err)
-	}
-
-	n := dbresults.NumRows()
-
-	if n == 0 {
-		return nil, false, nil
+		return nil, err
 	}
 
-	results := make([]completionstore.PlayerClassZoneResult, 0, n)
-
-	var (
-		mapID       int
-		zoneType    string
-		zoneIndex   int
-		class       int
-		mapName     string
-		customName  string
-		tier        int
-		rank        int
-		duration    int
-		date        int
-		completions int
-	)
+	return zones, nil
+}
 
-	for dbresults.Next() {
-		rank = 0
-		duration = 0
-		date = 0
-
-		if err := dbresults.Scan(
-			&mapID,
-			&zoneType,
-			&zoneIndex,
-			&class,
-			&mapName,
-			&customName,
-			&tier,
-			&rank,
-			&duration,
-			&date,
-			&completions,
-		); err != nil {
-			return nil, false, fmt.Errorf("scan results: %w", err)
-		}
+func (db *DB) GetAllZoneClassInfo(ctx context.Context) ([]completionstore.ZoneClassInfo, error) {
+	return db.queryInfo(ctx, sqlstore.AllZoneClassInfo())
+}
 
-		result := completionstore.PlayerClassZoneResult{
-			MapID:       uint64(mapID),
-			ZoneType:    tempushttp.ZoneType(zoneType),
-			ZoneIndex:   uint8(zoneIndex),
-			PlayerID:    uint64(playerID),
-			Class:       tempushttp.ClassType(class),
-			CustomName:  customName,
-			MapName:     mapName,
-			Tier:        uint8(tier),
-			Rank:        uint32(rank),
-			Duration:    time.Duration(duration),
-			Date:        time.UnixMilli(int64(date)),
-			Completions: uint32(completions),
-		}
+// GetZoneClassInfo returns the stored info of the given zones, including
+// zones with a tier of zero.
+func (db *DB) GetZoneClassInfo(ctx context.Context, zones []completionstore.Zone) ([]completionstore.ZoneClassInfo, error) {
+	statements := make([]sqlstore.Statement, 0, len(zones))
 
-		results = append(results, result)
+	for _, z := range zones {
+		statements = append(statements, sqlstore.ZoneClassInfo(z))
 	}
 
-	return results, true, nil
+	return db.queryInfo(ctx, statements...)
 }
 
-func (db *DB) GetPlayerMapClassResults(ctx context.Context, playerID, mapID uint64, class tempushttp.ClassType) ([]completionstore.PlayerClassZoneResult, bool, error) {
+func (db *DB) SetZonesFetched(ctx context.Context, zones []completionstore.Zone, t time.Time) error {
+	return db.write(ctx, sqlstore.SetZonesFetched(zones, t))
+}
 
-	const query = `
-SELECT
-	zone_class_info.zone_type,
-	zone_class_info.zone_index,
-	zone_class_info.map_name,
-	zone_class_info.custom_name,
-	zone_class_info.tier,
-	player_class_zone_results.rank,
-	player_class_zone_results.duration,
-	player_class_zone_results.date,
-	zone_class_info.completions
-FROM
-	zone_class_info
-LEFT JOIN
-	player_class_zone_results
-ON
-	zone_class_info.map_id = player_class_zone_results.map_id AND
-	zone_class_info.zone_type = player_class_zone_results.zone_type AND
-	zone_class_info.zone_index = player_class_zone_results.zone_index AND
-	zone_class_info.class = player_class_zone_results.class AND
-	player_class_zone_results.player_id = ?
-WHERE
-	zone_class_info.map_id = ? AND
-	zone_class_info.class = ? AND
-	zone_class_info.zone_type != 'trick'
-ORDER BY
-	player_class_zone_results.date DESC;
-`
-
-	param := gorqlite.ParameterizedStatement{
-		Query:     query,
-		Arguments: []any{playerID, mapID, class},
-	}
+func (db *DB) InsertPlayerClassZoneResults(ctx context.Context, results []completionstore.PlayerClassZoneResult) error {
+	return db.write(ctx, sqlstore.InsertPlayerClassZoneResults(results))
+}
 
-	dbresults, err := db.conn.QueryOneParameterizedContext(ctx, param)
-	if err != nil {
-		return nil, false, fmt.Errorf("do query: %w: %w", err, dbresults.Err)
+// GetZoneResults returns every stored result on the given zones.
+func (db *DB) GetZoneResults(ctx context.Context, zones []completionstore.Zone) ([]completionstore.PlayerClassZoneResult, error) {
+	statements := make([]sqlstore.Statement, 0, len(zones))
+
+	for _, z := range zones {
+		statements = append(statements, sqlstore.ZoneResults(z))
 	}
 
-	n := dbresults.NumRows()
+	return db.queryResults(ctx, statements...)
+}
 
-	if n == 0 {
-		return nil, false, nil
-	}
+func (db *DB) InsertEvents(ctx context.Context, events []completionstore.Event) error {
+	return db.write(ctx, sqlstore.InsertEvents(events))
+}
 
-	results := make([]completionstore.PlayerClassZoneResult, 0, n)
+// InsertResultHistory keeps every distinct duration and date seen for a
+// player's results. Runs already in the history are left as first observed.
+func (db *DB) InsertResultHistory(ctx context.Context, results []completionstore.PlayerClassZoneResult) error {
+	return db.write(ctx, sqlstore.InsertResultHistory(results))
+}
 
-	var (
-		zoneType    string
-		zoneIndex   int
-		mapName     string
-		customName  string
-		tier        int
-		rank        int
-		duration    int
-		date        int
-		completions int
-	)
+// GetPlayerZoneHistory returns a player's runs on a zone for a class, oldest
+// first.
+func (db *DB) GetPlayerZoneHistory(ctx context.Context, playerID, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, class tempushttp.ClassType) ([]completionstore.ResultHistory, error) {
+	history := make([]completionstore.ResultHistory, 0, 8)
 
-	for dbresults.Next() {
-		rank = 0
-		duration = 0
-		date = 0
-
-		if err := dbresults.Scan(
-			&zoneType,
-			&zoneIndex,
-			&mapName,
-			&customName,
-			&tier,
-			&rank,
-			&duration,
-			&date,
-			&completions,
-		); err != nil {
-			return nil, false, fmt.Errorf("scan results: %w", err)
+	err := db.each(ctx, sqlstore.PlayerZoneHistory(playerID, mapID, zoneType, zoneIndex, class), func(rows sqlstore.Scanner) error {
+		h, err := sqlstore.ScanHistory(rows, class)
+		if err != nil {
+			return err
 		}
 
-		result := completionstore.PlayerClassZoneResult{
-			MapID:       mapID,
-			ZoneType:    tempushttp.ZoneType(zoneType),
-			ZoneIndex:   uint8(zoneIndex),
-			PlayerID:    playerID,
-			Class:       class,
-			CustomName:  customName,
-			MapName:     mapName,
-			Tier:        uint8(tier),
-			Rank:        uint32(rank),
-			Duration:    time.Duration(duration),
-			Date:        time.UnixMilli(int64(date)),
-			Completions: uint32(completions),
-		}
+		history = append(history, h)
 
-		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return results, true, nil
+	return history, nil
 }
 
-// TODO: consolidate with GetPlayerResults
-func (db *DB) GetPlayerRecentResults(ctx context.Context, playerID uint64) ([]completionstore.PlayerClassZoneResult, bool, error) {
-	const query = `
-SELECT
-	player_class_zone_results.map_id,
-	player_class_zone_results.zone_type,
-	player_class_zone_results.zone_index,
-	player_class_zone_results.class,
-	player_class_zone_results.map_name,
-	player_class_zone_results.custom_name,
-	player_class_zone_results.tier,
-	player_class_zone_results.rank,
-	player_class_zone_results.duration,
-	player_class_zone_results.date,
-	player_class_zone_results.completions
-FROM
-	player_class_zone_results
-WHERE
-	player_class_zone_results.player_id = ? AND
-	player_class_zone_results.zone_type != 'trick'
-ORDER BY
-	date desc
-LIMIT 10;
-`
-
-	param := gorqlite.ParameterizedStatement{
-		Query:     query,
-		Arguments: []any{playerID},
-	}
+// InsertZones adds new zones and updates the names of their maps, keeping
+// when they were last fetched. Zones that had been retired are restored.
+func (db *DB) InsertZones(ctx context.Context, zones map[completionstore.Zone]struct{}) error {
+	return db.write(ctx, sqlstore.InsertZones(zones, time.Now()))
+}
 
-	dbresults, err := db.conn.QueryOneParameterizedContext(ctx, param)
-	if err != nil {
-		return nil, false, fmt.Errorf("do query: %w: %w", err, dbresults.Err)
-	}
+// RetireZones hides zones that are no longer in the map list, along with
+// their info and results, and marks the stats of every player on their maps
+// for recomputation.
+func (db *DB) RetireZones(ctx context.Context, zones []completionstore.Zone, t time.Time) error {
+	return db.write(ctx, sqlstore.RetireZones(zones, t))
+}
 
-	n := dbresults.NumRows()
+// RetireMaps hides the stats of maps that are no longer in the map list.
+func (db *DB) RetireMaps(ctx context.Context, mapIDs []uint64) error {
+	return db.write(ctx, sqlstore.RetireMaps(mapIDs))
+}
+
+// RenameMaps sets the given maps' names, by map ID, and marks the stats of
+// every player on them for recomputation. Events and history keep the name
+// the map had at the time.
+func (db *DB) RenameMaps(ctx context.Context, names map[uint64]string, t time.Time) error {
+	return db.write(ctx, sqlstore.RenameMaps(names, t))
+}
 
-	if n == 0 {
-		return nil, false, nil
+func (db *DB) InsertMapStats(ctx context.Context, stats map[uint64]completionstore.MapStatsInfo) error {
+	statements, err := sqlstore.InsertMapStats(stats)
+	if err != nil {
+		return err
 	}
 
-	results := make([]completionstore.PlayerClassZoneResult, 0, n)
+	return db.write(ctx, statements)
+}
 
-	var (
-		mapID       int
-		zoneType    string
-		zoneIndex   int
-		class       int
-		mapName     string
-		customName  string
-		tier        int
-		rank        int
-		duration    int
-		date        int
-		completions int
-	)
+func (db *DB) SetPlayerMapsProcessed(ctx context.Context, maps []completionstore.StalePlayerMap) error {
+	return db.write(ctx, sqlstore.SetPlayerMapsProcessed(maps))
+}
 
-	for dbresults.Next() {
-		rank = 0
-		duration = 0
-		date = 0
-
-		if err := dbresults.Scan(
-			&mapID,
-			&zoneType,
-			&zoneIndex,
-			&class,
-			&mapName,
-			&customName,
-			&tier,
-			&rank,
-			&duration,
-			&date,
-			&completions,
-		); err != nil {
-			return nil, false, fmt.Errorf("scan results: %w", err)
-		}
+func (db *DB) InsertPlayerMapStats(ctx context.Context, stats map[completionstore.PlayerMap]completionstore.PlayerMapStats) error {
+	statements, err := sqlstore.InsertPlayerMapStats(stats)
+	if err != nil {
+		return err
+	}
 
-		result := completionstore.PlayerClassZoneResult{
-			MapID:       uint64(mapID),
-			ZoneType:    tempushttp.ZoneType(zoneType),
-			ZoneIndex:   uint8(zoneIndex),
-			PlayerID:    uint64(playerID),
-			Class:       tempushttp.ClassType(class),
-			CustomName:  customName,
-			MapName:     mapName,
-			Tier:        uint8(tier),
-			Rank:        uint32(rank),
-			Duration:    time.Duration(duration),
-			Date:        time.UnixMilli(int64(date)),
-			Completions: uint32(completions),
-		}
+	return db.write(ctx, statements)
+}
 
-		results = append(results, result)
+func (db *DB) GetPlayerResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerResults(playerID, zoneTypes, tiers, classes))
+	if err != nil {
+		return nil, false, err
 	}
 
-	return results, true, nil
+	return results, len(results) > 0, nil
 }
 
-func (db *DB) InsertZoneClassInfo(ctx context.Context, info []completionstore.ZoneClassInfo) error {
-	params := make([]gorqlite.ParameterizedStatement, 0, len(info))
-
-	const q = `
-INSERT INTO
-	zone_class_info (
-		map_id,
-		zone_type,
-		zone_index,
-		class,
-		map_name,
-		custom_name,
-		tier,
-		completions
-	)
-VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT
-	(map_id, zone_type, zone_index, class)
-DO UPDATE SET
-	map_name = excluded.map_name,
-	custom_name = excluded.custom_name,
-	tier = excluded.tier,
-	completions = excluded.completions;
-`
-	for _, zi := range info {
-		p := gorqlite.ParameterizedStatement{
-			Query:     q,
-			Arguments: []any{zi.MapID, zi.ZoneType, zi.ZoneIndex, zi.Class, zi.MapName, zi.CustomName, zi.Tier, zi.Completions},
-		}
-
-		params = append(params, p)
+func (db *DB) GetPlayerMapClassResults(ctx context.Context, playerID, mapID uint64, class tempushttp.ClassType) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerMapClassResults(playerID, mapID, class))
+	if err != nil {
+		return nil, false, err
 	}
 
-	results, _ := db.conn.WriteParameterizedContext(ctx, params)
+	return results, len(results) > 0, nil
+}
 
-	for _, r := range results {
-		if r.Err != nil {
-			return fmt.Errorf("result error: %w", r.Err)
-		}
+func (db *DB) GetPlayerRecentResults(ctx context.Context, playerID uint64) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerRecentResults(playerID))
+	if err != nil {
+		return nil, false, err
 	}
 
-	return nil
+	return results, len(results) > 0, nil
 }
 
-type inClause struct {
-	n     int
-	field string
+func (db *DB) InsertZoneClassInfo(ctx context.Context, info []completionstore.ZoneClassInfo) error {
+	return db.write(ctx, sqlstore.InsertZoneClassInfo(info))
 }
 
-func buildInClauses(clauses []inClause) string {
-	var s strings.Builder
-	n := len(clauses) - 1
-	for i, c := range clauses {
-		s.Write([]byte(c.field))
-		s.WriteString(" IN (")
-		for j := 0; j < c.n; j++ {
-			if j == 0 {
-				s.Write([]byte("?"))
-			} else {
-				s.Write([]byte(",?"))
-			}
-		}
-
-		if i == n {
-			s.WriteString(")")
-		} else {
-			s.WriteString(") AND ")
-		}
+func (db *DB) GetPlayerClassZoneResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerClassZoneResults(playerID, zoneTypes, tiers, classes))
+	if err != nil {
+		return nil, false, err
 	}
 
-	return s.String()
+	return results, len(results) > 0, nil
 }
 
-func (db *DB) GetPlayerClassZoneResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
-	// TODO: probably don't need custom name, tier, duration, date, rank; just need to know if it was completed for the completions page
-	const qStart = `
-SELECT
-	zone_class_info.map_id,
-	zone_class_info.zone_type,
-	zone_class_info.zone_index,
-	zone_class_info.class,
-	zone_class_info.custom_name,
-	zone_class_info.map_name,
-	zone_class_info.tier,
-	zone_class_info.completions,
-	player_class_zone_results.rank,
-	player_class_zone_results.duration,
-	player_class_zone_results.date
-FROM
-	zone_class_info
-LEFT JOIN
-	player_class_zone_results
-ON
-	zone_class_info.map_id = player_class_zone_results.map_id AND
-	zone_class_info.zone_type = player_class_zone_results.zone_type AND
-	zone_class_info.zone_index = player_class_zone_results.zone_index AND
-	zone_class_info.class = player_class_zone_results.class AND
-	player_class_zone_results.player_id = ?
-WHERE
-`
-
-	args := make([]any, 0, 1+len(zoneTypes)+len(tiers)+len(classes))
-	args = append(args, playerID)
-
-	inClauses := []inClause{
-		{
-			n:     len(zoneTypes),
-			field: "zone_class_info.zone_type",
-		},
-		{
-			n:     len(tiers),
-			field: "zone_class_info.tier",
-		},
-		{
-			n:     len(classes),
-			field: "zone_class_info.class",
-		},
+func (db *DB) InsertMaps(ctx context.Context, list *completionstore.MapList) error {
+	s, err := sqlstore.InsertMaps(list)
+	if err != nil {
+		return err
 	}
 
-	whereClause := buildInClauses(inClauses)
-
-	for _, zt := range zoneTypes {
-		args = append(args, zt)
+	if _, err := db.exec(ctx, s); err != nil {
+		return err
 	}
 
-	for _, t := range tiers {
-		args = append(args, t)
-	}
+	return nil
+}
 
-	for _, c := range classes {
-		args = append(args, c)
-	}
+func (db *DB) GetMaps(ctx context.Context) (*completionstore.MapList, error) {
+	list := &completionstore.MapList{}
 
-	param := gorqlite.ParameterizedStatement{
-		Query:     qStart + whereClause + ";",
-		Arguments: args,
-	}
+	err := db.each(ctx, sqlstore.Maps(), func(rows sqlstore.Scanner) error {
+		var err error
 
-	dbresults, err := db.conn.QueryOneParameterizedContext(ctx, param)
+		list, err = sqlstore.ScanMaps(rows)
+
+		return err
+	})
 	if err != nil {
-		return nil, false, fmt.Errorf("do query: %w: %w", err, dbresults.Err)
+		return nil, err
 	}
 
-	if dbresults.NumRows() == 0 {
-		return nil, false, nil
+	return list, nil
+}
+
+func (db *DB) GetPlayerMapResults(ctx context.Context, playerMaps []completionstore.StalePlayerMap) (map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, error) {
+	statements := make([]sqlstore.Statement, 0, len(playerMaps))
+
+	for _, pm := range playerMaps {
+		statements = append(statements, sqlstore.PlayerMapResults(pm.PlayerMap))
 	}
 
-	results := make([]completionstore.PlayerClassZoneResult, 0, dbresults.NumRows())
+	results, err := db.queryResults(ctx, statements...)
+	if err != nil {
+		return nil, err
+	}
 
-	var (
-		mapID       int
-		zoneType    string
-		zoneIndex   int
-		class       int
-		customName  string
-		mapName     string
-		tier        int
-		completions int
-		rank        int
-		duration    int
-		date        int
-	)
+	maps := make(map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, len(playerMaps))
 
-	for dbresults.Next() {
-		rank = 0
-		duration = 0
-		date = 0
-
-		if err := dbresults.Scan(
-			&mapID,
-			&zoneType,
-			&zoneIndex,
-			&class,
-			&customName,
-			&mapName,
-			&tier,
-			&completions,
-			&rank,
-			&duration,
-			&date,
-		); err != nil {
-			return nil, false, fmt.Errorf("scan results: %w", err)
+	for _, r := range results {
+		// TODO: figure out better place for this
+		if r.Tier == 0 {
+			continue
 		}
 
-		result := completionstore.PlayerClassZoneResult{
-			MapID:       uint64(mapID),
-			ZoneType:    tempushttp.ZoneType(zoneType),
-			ZoneIndex:   uint8(zoneIndex),
-			PlayerID:    uint64(playerID),
-			Class:       tempushttp.ClassType(class),
-			CustomName:  customName,
-			MapName:     mapName,
-			Tier:        uint8(tier),
-			Rank:        uint32(rank),
-			Duration:    time.Duration(duration),
-			Date:        time.UnixMilli(int64(date)),
-			Completions: uint32(completions),
+		pm := completionstore.PlayerMap{
+			PlayerID: r.PlayerID,
+			MapID:    r.MapID,
 		}
 
-		results = append(results, result)
+		maps[pm] = append(maps[pm], r)
 	}
 
-	return results, true, nil
+	return maps, nil
 }
 
-func (db *DB) InsertMaps(ctx context.Context, list *completionstore.MapList) error {
-	const q = `
-INSERT INTO kv (key, value, updated)
-VALUES (?, ?, ?)
-ON CONFLICT (key) DO UPDATE SET
-updated = excluded.updated,
-value = excluded.value;
-`
-
-	updated := list.Updated.UnixMilli()
+// GetPlayerZones returns every zone a player has a result on.
+func (db *DB) GetPlayerZones(ctx context.Context, playerID uint64) ([]completionstore.Zone, error) {
+	zones := make([]completionstore.Zone, 0, 64)
 
-	b, err := json.Marshal(list.Response)
-	if err != nil {
-		return fmt.Errorf("marshal response: %w", err)
-	}
+	err := db.each(ctx, sqlstore.PlayerZones(playerID), func(rows sqlstore.Scanner) error {
+		z, err := sqlstore.ScanZone(rows)
+		if err != nil {
+			return err
+		}
 
-	param := gorqlite.ParameterizedStatement{
-		Query:     q,
-		Arguments: []any{mapskey, string(b), updated},
-	}
+		zones = append(zones, z)
 
-	results, err := db.conn.WriteOneParameterizedContext(ctx, param)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("do query: %w: %s", err, results.Err)
+		return nil, err
 	}
 
-	return nil
+	return zones, nil
 }
 
-const mapskey = "map"
+func (db *DB) InsertSteamIDs(ctx context.Context, steamIDs map[string]uint64) error {
+	return db.write(ctx, sqlstore.InsertSteamIDs(steamIDs))
+}
 
-func (db *DB) GetMaps(ctx context.Context) (*completionstore.MapList, error) {
-	const query = "SELECT value, updated FROM kv WHERE key = ?;"
-	param := gorqlite.ParameterizedStatement{
-		Query:     query,
-		Arguments: []any{mapskey},
-	}
+func (db *DB) GetStalePlayerMaps(ctx context.Context) ([]completionstore.StalePlayerMap, error) {
+	playerMaps := make([]completionstore.StalePlayerMap, 0, 64)
 
-	results, err := db.conn.QueryOneParameterizedContext(ctx, param)
-	if err != nil {
-		return nil, fmt.Errorf("do query: %w", err)
-	}
+	err := db.each(ctx, sqlstore.StalePlayerMaps(), func(rows sqlstore.Scanner) error {
+		pm, err := sqlstore.ScanStalePlayerMap(rows)
+		if err != nil {
+			return err
+		}
+
+		playerMaps = append(playerMaps, pm)
 
-	if results.NumRows() == 0 {
-		return &completionstore.MapList{}, nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	data := make([]byte, 0, 1000000)
-	var updated int64
+	return playerMaps, nil
+}
 
-	for results.Next() {
-		if err := results.Scan(&data, &updated); err != nil {
-			return nil, fmt.Errorf("scan results: %w", err)
-		}
-	}
+func (db *DB) GetPlayerBySteamID(ctx context.Context, steamID string) (uint64, bool, error) {
+	var (
+		playerID uint64
+		found    bool
+	)
 
-	var response tempushttp.GetDetailedMapListResponse
+	err := db.each(ctx, sqlstore.PlayerBySteamID(steamID), func(rows sqlstore.Scanner) error {
+		var err error
 
-	if err := json.Unmarshal(data, &response); err != nil {
-		return nil, fmt.Errorf("unmarshal data: %w", err)
-	}
+		playerID, err = sqlstore.ScanUint(rows)
+		found = err == nil
 
-	list := &completionstore.MapList{
-		Updated:  time.UnixMilli(updated),
-		Response: response,
+		return err
+	})
+	if err != nil {
+		return 0, false, err
 	}
 
-	return list, nil
+	return playerID, found, nil
 }
 
-func (db *DB) GetPlayerMapResults(ctx context.Context, playerMaps []completionstore.StalePlayerMap) (map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, error) {
-	const q = `
-SELECT
-	player_id,
-	map_id,
-	zone_type,
-	zone_index,
-	class,
-	custom_name,
-	map_name,
-	tier,
-	rank,
-	duration,
-	date,
-	completions
-FROM
-	player_class_zone_results
-WHERE
-	player_id = ? AND map_id = ?;
-`
-
-	params := make([]gorqlite.ParameterizedStatement, 0, len(playerMaps))
-
-	for _, pm := range playerMaps {
-		param := gorqlite.ParameterizedStatement{
-			Query:     q,
-			Arguments: []any{pm.PlayerID, pm.MapID},
-		}
+// JobQueue is a jobqueue.Queue kept in the jobs table.
+type JobQueue struct {
+	db *DB
+}
 
-		params = append(params, param)
-	}
+var _ jobqueue.Queue = (*JobQueue)(nil)
 
-	dbresults, err := db.conn.QueryParameterizedContext(ctx, params)
-	if err != nil {
-		return nil, fmt.Errorf("do query: %w", err)
-	}
+func (db *DB) Jobs() *JobQueue {
+	return &JobQueue{db: db}
+}
 
+// getJob returns the first job the statement selects, reporting false if
+// there is none.
+func (q *JobQueue) getJob(ctx context.Context, s sqlstore.Statement) (jobqueue.Job, bool, error) {
 	var (
-		playerID    int
-		mapID       int
-		zoneType    string
-		zoneIndex   int
-		class       int
-		customName  string
-		mapName     string
-		tier        int
-		rank        int
-		duration    int
-		date        int
-		completions int
+		job   jobqueue.Job
+		found bool
 	)
 
-	maps := make(map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, len(playerMaps))
-
-	for _, r := range dbresults {
-		if r.Err != nil {
-			return nil, fmt.Errorf("result error: %w", r.Err)
+	err := q.db.each(ctx, s, func(rows sqlstore.Scanner) error {
+		if found {
+			return nil
 		}
 
-		for r.Next() {
-			if err := r.Scan(&playerID, &mapID, &zoneType, &zoneIndex, &class, &customName, &mapName, &tier, &rank, &duration, &date, &completions); err != nil {
-				return nil, fmt.Errorf("scan results: %w", err)
-			}
+		var err error
 
-			// TODO: figure out better place for this
-			if tier == 0 {
-				continue
-			}
+		job, err = sqlstore.ScanJob(rows)
+		found = err == nil
 
-			pm := completionstore.PlayerMap{
-				PlayerID: uint64(playerID),
-				MapID:    uint64(mapID),
-			}
+		return err
+	})
+	if err != nil {
+		return jobqueue.Job{}, false, err
+	}
 
-			result := completionstore.PlayerClassZoneResult{
-				MapID:       pm.MapID,
-				ZoneType:    tempushttp.ZoneType(zoneType),
-				ZoneIndex:   uint8(zoneIndex),
-				PlayerID:    pm.PlayerID,
-				Class:       tempushttp.ClassType(class),
-				CustomName:  customName,
-				MapName:     mapName,
-				Tier:        uint8(tier),
-				Rank:        uint32(rank),
-				Duration:    time.Duration(duration),
-				Date:        time.UnixMilli(int64(date)),
-				Completions: uint32(completions),
-			}
+	return job, found, nil
+}
 
-			results, ok := maps[pm]
-			if !ok {
-				const estsize = 6
+func (q *JobQueue) Enqueue(ctx context.Context, kind jobqueue.Kind, target uint64, now time.Time) (jobqueue.Job, error) {
+	if _, err := q.db.exec(ctx, sqlstore.EnqueueJob(kind, target, now)); err != nil {
+		return jobqueue.Job{}, err
+	}
 
-				results = make([]completionstore.PlayerClassZoneResult, 0, estsize)
-			}
+	job, ok, err := q.getJob(ctx, sqlstore.ActiveJob(kind, target))
+	if err != nil {
+		return jobqueue.Job{}, err
+	}
 
-			results = append(results, result)
-			maps[pm] = results
-		}
+	if !ok {
+		return jobqueue.Job{}, jobqueue.ErrNotFound
 	}
 
-	return maps, nil
+	return job, nil
 }
 
-func (db *DB) InsertSteamIDs(ctx context.Context, steamIDs map[string]uint64) error {
-	// steam IDs probably never change association?
-	const query = `
-INSERT INTO
-	steam_ids (
-		steam_id,
-		player_id
-	)
-VALUES
-	(?, ?)
-ON CONFLICT
-	(steam_id)
-DO NOTHING;`
-
-	params := make([]gorqlite.ParameterizedStatement, 0, len(steamIDs))
-
-	for steamID, playerID := range steamIDs {
-		param := gorqlite.ParameterizedStatement{
-			Query:     query,
-			Arguments: []any{steamID, playerID},
-		}
+// Claim takes the next job only if no other worker claimed it in the
+// meantime, otherwise it reports that there is none.
+func (q *JobQueue) Claim(ctx context.Context, now time.Time, lease time.Duration) (jobqueue.Job, bool, error) {
+	if _, err := q.db.exec(ctx, sqlstore.ExpireJobs(now)); err != nil {
+		return jobqueue.Job{}, false, err
+	}
 
-		params = append(params, param)
+	job, ok, err := q.getJob(ctx, sqlstore.NextJob(now))
+	if err != nil || !ok {
+		return jobqueue.Job{}, false, err
 	}
 
-	dbresults, err := db.conn.WriteParameterizedContext(ctx, params)
+	claimed := job
+	claimed.State = jobqueue.StateRunning
+	claimed.Attempts++
+	claimed.Available = now.Add(lease)
 
-	for _, r := range dbresults {
-		if r.Err != nil {
-			return fmt.Errorf("result error: %w: %w", err, r.Err)
-		}
+	result, err := q.db.exec(ctx, sqlstore.ClaimJob(job, claimed))
+	if err != nil {
+		return jobqueue.Job{}, false, err
 	}
 
-	return nil
+	if result.RowsAffected == 0 {
+		return jobqueue.Job{}, false, nil
+	}
+
+	return claimed, true, nil
 }
 
-func (db *DB) GetStalePlayerMaps(ctx context.Context) ([]completionstore.StalePlayerMap, error) {
-	const query = `
-SELECT
-	player_id,
-	map_id,
-	latest_update
-FROM
-	player_map_stats
-WHERE
-	latest_update != latest_processed_update
-LIMIT 10000;
-`
-	param := gorqlite.ParameterizedStatement{
-		Query:     query,
-		Arguments: []any{},
+func (q *JobQueue) Complete(ctx context.Context, job jobqueue.Job, now time.Time, jobErr error) error {
+	if _, err := q.db.exec(ctx, sqlstore.CompleteJob(job, jobqueue.Finish(job, now, jobErr))); err != nil {
+		return err
 	}
 
-	results, err := db.conn.QueryOneParameterizedContext(ctx, param)
+	return nil
+}
+
+func (q *JobQueue) Get(ctx context.Context, id uint64) (jobqueue.Job, error) {
+	job, ok, err := q.getJob(ctx, sqlstore.Job(id))
 	if err != nil {
-		return nil, fmt.Errorf("do query: %w: %w", err, results.Err)
+		return jobqueue.Job{}, err
 	}
 
-	var (
-		playerID     int
-		mapID        int
-		latestUpdate int
-	)
+	if !ok {
+		return jobqueue.Job{}, jobqueue.ErrNotFound
+	}
 
-	playerMaps := make([]completionstore.StalePlayerMap, 0, results.NumRows())
+	return job, nil
+}
 
-	for results.Next() {
-		if err := results.Scan(&playerID, &mapID, &latestUpdate); err != nil {
-			return nil, fmt.Errorf("scan results: %w", err)
-		}
+func (q *JobQueue) Latest(ctx context.Context, kind jobqueue.Kind, target uint64) (jobqueue.Job, bool, error) {
+	return q.getJob(ctx, sqlstore.LatestJob(kind, target))
+}
 
-		pm := completionstore.StalePlayerMap{
-			PlayerMap: completionstore.PlayerMap{
-				PlayerID: uint64(playerID),
-				MapID:    uint64(mapID),
-			},
-			LatestUpdate: time.UnixMilli(int64(latestUpdate)),
-		}
+func (q *JobQueue) Pending(ctx context.Context) (int, error) {
+	var n uint64
 
-		playerMaps = append(playerMaps, pm)
+	err := q.db.each(ctx, sqlstore.PendingJobs(), func(rows sqlstore.Scanner) error {
+		var err error
+
+		n, err = sqlstore.ScanUint(rows)
+
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return playerMaps, nil
+	return int(n), nil
 }
 
-func (db *DB) GetPlayerBySteamID(ctx context.Context, steamID string) (uint64, bool, error) {
-	const q = `
-SELECT
-	player_id
-FROM
-	steam_ids
-WHERE
-	steam_id = ?;
-`
-	param := gorqlite.ParameterizedStatement{
-		Query:     q,
-		Arguments: []any{steamID},
-	}
+func (db *DB) AppliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	var exists bool
 
-	result, err := db.conn.QueryOneParameterizedContext(ctx, param)
+	err := db.each(ctx, sqlstore.MigrationsTableExists(), func(rows sqlstore.Scanner) error {
+		exists = true
+		return nil
+	})
 	if err != nil {
-		return 0, false, fmt.Errorf("do query: %w: %w", err, result.Err)
-	}
-
-	if result.NumRows() == 0 {
-		return 0, false, nil
+		return nil, err
 	}
 
-	var playerID int
+	applied := make(map[int]time.Time)
 
-	for result.Next() {
-		if err := result.Scan(&playerID); err != nil {
-			return 0, false, fmt.Errorf("scan results: %w", err)
-		}
+	if !exists {
+		return applied, nil
 	}
 
-	return uint64(playerID), true, nil
-}
+	err = db.each(ctx, sqlstore.AppliedMigrations(), func(rows sqlstore.Scanner) error {
+		version, t, err := sqlstore.ScanAppliedMigration(rows)
+		if err != nil {
+			return err
+		}
 
-func (db *DB) CreateSchema(ctx context.Context) error {
-	const query = `
-CREATE TABLE kv (
-	key     TEXT     NOT NULL,
-	updated INTEGER  NOT NULL,
-	value   TEXT     NOT NULL,
-	PRIMARY KEY (key)
-);
-
-CREATE INDEX kv_updated_index
-ON kv (updated);
-
-CREATE TABLE steam_ids (
-	steam_id     TEXT    NOT NULL,
-	player_id    INTEGER NOT NULL,
-	PRIMARY KEY (steam_id)
-);
-
-CREATE TABLE zones (
-	map_id     INTEGER NOT NULL,
-	zone_type  TEXT    NOT NULL,
-	zone_index INTEGER NOT NULL,
-	map_name   TEXT    NOT NULL,
-	updated    INTEGER NOT NULL,
-	fetched    INTEGER NOT NULL,
-	PRIMARY KEY (map_id, zone_type, zone_index)
-);
-
-CREATE TABLE map_stats (
-	map_id        INTEGER NOT NULL,
-	map_name      TEXT    NOT NULL,
-	data          TEXT    NOT NULL,
-	PRIMARY KEY (map_id)
-);
-
-CREATE TABLE zone_class_info (
-	map_id        INTEGER NOT NULL,
-	zone_type     TEXT    NOT NULL,
-	zone_index    INTEGER NOT NULL,
-	class         INTEGER NOT NULL,
-	map_name      TEXT    NOT NULL,
-	custom_name   TEXT    NOT NULL,
-	tier          INTEGER NOT NULL,
-	completions   INTEGER NOT NULL,
-	PRIMARY KEY (map_id, zone_type, zone_index, class)
-);
-
-CREATE TABLE player_class_zone_results (
-	player_id   INTEGER NOT NULL,
-	map_id      INTEGER NOT NULL,
-	zone_type   TEXT    NOT NULL,
-	zone_index  INTEGER NOT NULL,
-	class       INTEGER NOT NULL,
-	custom_name TEXT    NOT NULL,
-	map_name    TEXT    NOT NULL,
-	tier        INTEGER NOT NULL,
-	updated     INTEGER NOT NULL,
-	rank        INTEGER NOT NULL,
-	duration    INTEGER NOT NULL,
-	date        INTEGER NOT NULL,
-	completions INTEGER NOT NULL,
-	PRIMARY KEY (player_id, map_id, zone_type, zone_index, class)
-);
-
-CREATE TABLE player_map_stats (
-	player_id                   INTEGER NOT NULL,
-	map_id                      INTEGER NOT NULL,
-	latest_update               INTEGER NOT NULL,
-	latest_processed_update     INTEGER NOT NULL,
-	data                        TEXT    NOT NULL,
-	PRIMARY KEY (player_id, map_id)
-);
-
-CREATE INDEX player_map_stats_times_index
-ON player_map_stats (latest_update, latest_processed_update, player_id, map_id);
-`
-	param := gorqlite.ParameterizedStatement{
-		Query:     query,
-		Arguments: []any{},
-	}
+		applied[version] = t
 
-	result, err := db.conn.WriteOneParameterizedContext(ctx, param)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("do query: %w", err)
+		return nil, err
 	}
 
-	if result.Err != nil {
-		return fmt.Errorf("result error: %w", err)
-	}
+	return applied, nil
+}
 
-	return nil
+// ApplyMigration sends the migration and its record in one request, whatever
+// the write chunk size, so that rqlite runs them in one transaction.
+func (db *DB) ApplyMigration(ctx context.Context, m completionstore.Migration, t time.Time) error {
+	statements := toParams(sqlstore.ApplyMigration(m, t))
+
+	results, err := db.writeAll(ctx, statements)
+
+	return checkWrite(results, len(statements), err)
 }
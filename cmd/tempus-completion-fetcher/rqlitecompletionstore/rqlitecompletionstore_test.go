@@ -0,0 +1,126 @@
+package rqlitecompletionstore_test
+
+import (
+	"context"
+	"os"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstoretest"
+	"tempus-completion/cmd/tempus-completion-fetcher/rqlitecompletionstore"
+	"tempus-completion/jobqueue"
+	"testing"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+var tables = []string{
+	"kv",
+	"steam_ids",
+	"zones",
+	"map_stats",
+	"zone_class_info",
+	"player_class_zone_results",
+	"player_map_stats",
+	"player_class_zone_history",
+	"events",
+	"jobs",
+	"schema_migrations",
+	"maps",
+	"migrate_test",
+}
+
+// open connects to the rqlite at TEST_RQLITE_ADDRESS, dropping every table in
+// it first, and migrates it.
+func open(t *testing.T, opts ...rqlitecompletionstore.Option) *rqlitecompletionstore.DB {
+	addr := os.Getenv("TEST_RQLITE_ADDRESS")
+	if addr == "" {
+		t.Skip("TEST_RQLITE_ADDRESS is not set")
+	}
+
+	conn, err := gorqlite.Open(addr)
+	if err != nil {
+		t.Fatalf("open connection: %s", err)
+	}
+
+	defer conn.Close()
+
+	drop := make([]string, 0, len(tables))
+	for _, table := range tables {
+		drop = append(drop, "DROP TABLE IF EXISTS "+table+";")
+	}
+
+	if _, err := conn.Write(drop); err != nil {
+		t.Fatalf("drop tables: %s", err)
+	}
+
+	db, err := rqlitecompletionstore.New(addr, opts...)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	if _, err := completionstore.Migrate(context.Background(), db, time.Now()); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	if os.Getenv("TEST_RQLITE_ADDRESS") == "" {
+		t.Skip("TEST_RQLITE_ADDRESS is not set")
+	}
+
+	completionstoretest.Run(t, func(t *testing.T) completionstoretest.Store {
+		return open(t)
+	})
+}
+
+func TestJobsExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC).UnixMilli())
+
+	q := open(t).Jobs()
+
+	job, err := q.Enqueue(ctx, jobqueue.KindRefreshPlayer, 59983, now)
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	for attempt := 1; attempt <= jobqueue.MaxAttempts; attempt++ {
+		claimed, ok, err := q.Claim(ctx, now, time.Minute)
+		if err != nil || !ok || claimed.Attempts != attempt {
+			t.Fatalf("expected attempt %d, got %+v %v %v", attempt, claimed, ok, err)
+		}
+
+		now = claimed.Available
+	}
+
+	if _, ok, err := q.Claim(ctx, now, time.Minute); err != nil || ok {
+		t.Fatalf("expected the job not to be claimed after %d attempts, got %v %v", jobqueue.MaxAttempts, ok, err)
+	}
+
+	job, _ = q.Get(ctx, job.ID)
+	if job.State != jobqueue.StateFailed || job.Error != jobqueue.ErrLeaseExpired.Error() {
+		t.Fatalf("expected the job to fail, got %+v", job)
+	}
+}
+
+func TestApplyMigrationOneTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	db := open(t, rqlitecompletionstore.WithWriteChunkSize(1))
+
+	// version 1 is already recorded, so recording it again fails and the
+	// table must not be created either
+	m := completionstore.Migration{Version: 1, Name: "again", Query: "CREATE TABLE migrate_test (id INTEGER);"}
+
+	if err := db.ApplyMigration(ctx, m, time.Now()); err == nil {
+		t.Fatalf("expected recording the migration twice to fail")
+	}
+
+	m.Version = 100
+
+	if err := db.ApplyMigration(ctx, m, time.Now()); err != nil {
+		t.Fatalf("expected the rolled back migration to apply cleanly, got %s", err)
+	}
+}
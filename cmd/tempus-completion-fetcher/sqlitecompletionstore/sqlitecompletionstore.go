@@ -0,0 +1,701 @@
+// Package sqlitecompletionstore keeps the completion store in a local SQLite
+// file, with the same schema and queries as rqlitecompletionstore.
+package sqlitecompletionstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/sqlstore"
+	"tempus-completion/jobqueue"
+	"tempus-completion/tempushttp"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type DB struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+type Option func(*DB)
+
+// WithLogger logs every query at debug level, with the fields carried by
+// its context.
+func WithLogger(logger *slog.Logger) Option {
+	return func(db *DB) {
+		db.logger = logger
+	}
+}
+
+// New opens the database at path, creating the file if it does not exist.
+// The fetcher and statsd may have the same file open.
+func New(path string, opts ...Option) (*DB, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	// sqlite allows a single writer, queueing here rather than on the lock
+	// keeps the busy timeout for other processes
+	conn.SetMaxOpenConns(1)
+
+	db := &DB{
+		db:     conn,
+		logger: slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	return db, nil
+}
+
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+func (db *DB) logQuery(ctx context.Context, query string, statements int, start time.Time, err error) {
+	if !db.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > 80 {
+		query = query[:80]
+	}
+
+	attrs := []slog.Attr{
+		slog.String("query", query),
+		slog.Int("statements", statements),
+		slog.Duration("latency", time.Since(start)),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	db.logger.LogAttrs(ctx, slog.LevelDebug, "store query", attrs...)
+}
+
+// each calls f for every row the statement returns.
+func (db *DB) each(ctx context.Context, s sqlstore.Statement, f func(sqlstore.Scanner) error) (err error) {
+	start := time.Now()
+
+	defer func() {
+		db.logQuery(ctx, s.Query, 1, start, err)
+	}()
+
+	rows, err := db.db.QueryContext(ctx, s.Query, s.Args...)
+	if err != nil {
+		return fmt.Errorf("do query: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read rows: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) exec(ctx context.Context, s sqlstore.Statement) (sql.Result, error) {
+	start := time.Now()
+	result, err := db.db.ExecContext(ctx, s.Query, s.Args...)
+	db.logQuery(ctx, s.Query, 1, start, err)
+
+	if err != nil {
+		return nil, fmt.Errorf("do query: %w", err)
+	}
+
+	return result, nil
+}
+
+// write runs the statements as one transaction.
+func (db *DB) write(ctx context.Context, statements []sqlstore.Statement) (err error) {
+	if len(statements) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	defer func() {
+		db.logQuery(ctx, statements[0].Query, len(statements), start, err)
+	}()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	for _, s := range statements {
+		if _, err := tx.ExecContext(ctx, s.Query, s.Args...); err != nil {
+			return fmt.Errorf("do query: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// queryResults returns the results the statement selects.
+func (db *DB) queryResults(ctx context.Context, s sqlstore.Statement) ([]completionstore.PlayerClassZoneResult, error) {
+	results := make([]completionstore.PlayerClassZoneResult, 0, 64)
+
+	err := db.each(ctx, s, func(rows sqlstore.Scanner) error {
+		r, err := sqlstore.ScanResult(rows)
+		if err != nil {
+			return err
+		}
+
+		results = append(results, r)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// queryInfo returns the zone class info the statement selects.
+func (db *DB) queryInfo(ctx context.Context, s sqlstore.Statement) ([]completionstore.ZoneClassInfo, error) {
+	infos := make([]completionstore.ZoneClassInfo, 0, 64)
+
+	err := db.each(ctx, s, func(rows sqlstore.Scanner) error {
+		info, err := sqlstore.ScanInfo(rows)
+		if err != nil {
+			return err
+		}
+
+		infos = append(infos, info)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+func (db *DB) AppliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	var exists bool
+
+	err := db.each(ctx, sqlstore.MigrationsTableExists(), func(rows sqlstore.Scanner) error {
+		exists = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]time.Time)
+
+	if !exists {
+		return applied, nil
+	}
+
+	err = db.each(ctx, sqlstore.AppliedMigrations(), func(rows sqlstore.Scanner) error {
+		version, t, err := sqlstore.ScanAppliedMigration(rows)
+		if err != nil {
+			return err
+		}
+
+		applied[version] = t
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (db *DB) ApplyMigration(ctx context.Context, m completionstore.Migration, t time.Time) error {
+	return db.write(ctx, sqlstore.ApplyMigration(m, t))
+}
+
+// CommitZone stores everything fetched for a zone, marking it fetched unless
+// Fetched is zero, in a single transaction.
+func (db *DB) CommitZone(ctx context.Context, c completionstore.ZoneCommit) error {
+	return db.write(ctx, sqlstore.CommitZone(c))
+}
+
+// GetZoneSchedule returns every zone with what the refresh scheduler needs to
+// know about it. Tracked players' latest completions are only looked up for
+// the given players.
+func (db *DB) GetZoneSchedule(ctx context.Context, trackedPlayers []uint64) ([]completionstore.ZoneSchedule, error) {
+	zones := make([]completionstore.ZoneSchedule, 0, 3000)
+	indexes := make(map[completionstore.Zone]int, 3000)
+
+	err := db.each(ctx, sqlstore.ZoneSchedule(), func(rows sqlstore.Scanner) error {
+		z, err := sqlstore.ScanZoneSchedule(rows)
+		if err != nil {
+			return err
+		}
+
+		indexes[completionstore.Zone{MapID: z.MapID, ZoneType: z.ZoneType, ZoneIndex: z.ZoneIndex}] = len(zones)
+		zones = append(zones, z)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(trackedPlayers) == 0 {
+		return zones, nil
+	}
+
+	err = db.each(ctx, sqlstore.TrackedResults(trackedPlayers), func(rows sqlstore.Scanner) error {
+		z, lastDate, err := sqlstore.ScanTrackedResult(rows)
+		if err != nil {
+			return err
+		}
+
+		if i, ok := indexes[z]; ok {
+			zones[i].LastTrackedResult = lastDate
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+func (db *DB) GetAllZoneClassInfo(ctx context.Context) ([]completionstore.ZoneClassInfo, error) {
+	return db.queryInfo(ctx, sqlstore.AllZoneClassInfo())
+}
+
+// GetZoneClassInfo returns the stored info of the given zones, including
+// zones with a tier of zero.
+func (db *DB) GetZoneClassInfo(ctx context.Context, zones []completionstore.Zone) ([]completionstore.ZoneClassInfo, error) {
+	infos := make([]completionstore.ZoneClassInfo, 0, len(zones)*2)
+
+	for _, z := range zones {
+		zi, err := db.queryInfo(ctx, sqlstore.ZoneClassInfo(z))
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, zi...)
+	}
+
+	return infos, nil
+}
+
+func (db *DB) SetZonesFetched(ctx context.Context, zones []completionstore.Zone, t time.Time) error {
+	return db.write(ctx, sqlstore.SetZonesFetched(zones, t))
+}
+
+func (db *DB) InsertPlayerClassZoneResults(ctx context.Context, results []completionstore.PlayerClassZoneResult) error {
+	return db.write(ctx, sqlstore.InsertPlayerClassZoneResults(results))
+}
+
+// GetZoneResults returns every stored result on the given zones.
+func (db *DB) GetZoneResults(ctx context.Context, zones []completionstore.Zone) ([]completionstore.PlayerClassZoneResult, error) {
+	results := make([]completionstore.PlayerClassZoneResult, 0, len(zones)*1000)
+
+	for _, z := range zones {
+		zr, err := db.queryResults(ctx, sqlstore.ZoneResults(z))
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, zr...)
+	}
+
+	return results, nil
+}
+
+func (db *DB) InsertEvents(ctx context.Context, events []completionstore.Event) error {
+	return db.write(ctx, sqlstore.InsertEvents(events))
+}
+
+// InsertResultHistory keeps every distinct duration and date seen for a
+// player's results. Runs already in the history are left as first observed.
+func (db *DB) InsertResultHistory(ctx context.Context, results []completionstore.PlayerClassZoneResult) error {
+	return db.write(ctx, sqlstore.InsertResultHistory(results))
+}
+
+// GetPlayerZoneHistory returns a player's runs on a zone for a class, oldest
+// first.
+func (db *DB) GetPlayerZoneHistory(ctx context.Context, playerID, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, class tempushttp.ClassType) ([]completionstore.ResultHistory, error) {
+	history := make([]completionstore.ResultHistory, 0, 8)
+
+	err := db.each(ctx, sqlstore.PlayerZoneHistory(playerID, mapID, zoneType, zoneIndex, class), func(rows sqlstore.Scanner) error {
+		h, err := sqlstore.ScanHistory(rows, class)
+		if err != nil {
+			return err
+		}
+
+		history = append(history, h)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// InsertZones adds new zones and updates the names of their maps, keeping
+// when they were last fetched. Zones that had been retired are restored.
+func (db *DB) InsertZones(ctx context.Context, zones map[completionstore.Zone]struct{}) error {
+	return db.write(ctx, sqlstore.InsertZones(zones, time.Now()))
+}
+
+// RetireZones hides zones that are no longer in the map list, along with
+// their info and results, and marks the stats of every player on their maps
+// for recomputation.
+func (db *DB) RetireZones(ctx context.Context, zones []completionstore.Zone, t time.Time) error {
+	return db.write(ctx, sqlstore.RetireZones(zones, t))
+}
+
+// RetireMaps hides the stats of maps that are no longer in the map list.
+func (db *DB) RetireMaps(ctx context.Context, mapIDs []uint64) error {
+	return db.write(ctx, sqlstore.RetireMaps(mapIDs))
+}
+
+// RenameMaps sets the given maps' names, by map ID, and marks the stats of
+// every player on them for recomputation. Events and history keep the name
+// the map had at the time.
+func (db *DB) RenameMaps(ctx context.Context, names map[uint64]string, t time.Time) error {
+	return db.write(ctx, sqlstore.RenameMaps(names, t))
+}
+
+func (db *DB) InsertMapStats(ctx context.Context, stats map[uint64]completionstore.MapStatsInfo) error {
+	statements, err := sqlstore.InsertMapStats(stats)
+	if err != nil {
+		return err
+	}
+
+	return db.write(ctx, statements)
+}
+
+func (db *DB) SetPlayerMapsProcessed(ctx context.Context, maps []completionstore.StalePlayerMap) error {
+	return db.write(ctx, sqlstore.SetPlayerMapsProcessed(maps))
+}
+
+func (db *DB) InsertPlayerMapStats(ctx context.Context, stats map[completionstore.PlayerMap]completionstore.PlayerMapStats) error {
+	statements, err := sqlstore.InsertPlayerMapStats(stats)
+	if err != nil {
+		return err
+	}
+
+	return db.write(ctx, statements)
+}
+
+func (db *DB) GetPlayerResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerResults(playerID, zoneTypes, tiers, classes))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return results, len(results) > 0, nil
+}
+
+func (db *DB) GetPlayerMapClassResults(ctx context.Context, playerID, mapID uint64, class tempushttp.ClassType) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerMapClassResults(playerID, mapID, class))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return results, len(results) > 0, nil
+}
+
+func (db *DB) GetPlayerRecentResults(ctx context.Context, playerID uint64) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerRecentResults(playerID))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return results, len(results) > 0, nil
+}
+
+func (db *DB) InsertZoneClassInfo(ctx context.Context, info []completionstore.ZoneClassInfo) error {
+	return db.write(ctx, sqlstore.InsertZoneClassInfo(info))
+}
+
+func (db *DB) GetPlayerClassZoneResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error) {
+	results, err := db.queryResults(ctx, sqlstore.PlayerClassZoneResults(playerID, zoneTypes, tiers, classes))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return results, len(results) > 0, nil
+}
+
+func (db *DB) InsertMaps(ctx context.Context, list *completionstore.MapList) error {
+	s, err := sqlstore.InsertMaps(list)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.exec(ctx, s); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *DB) GetMaps(ctx context.Context) (*completionstore.MapList, error) {
+	list := &completionstore.MapList{}
+
+	err := db.each(ctx, sqlstore.Maps(), func(rows sqlstore.Scanner) error {
+		var err error
+
+		list, err = sqlstore.ScanMaps(rows)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (db *DB) GetPlayerMapResults(ctx context.Context, playerMaps []completionstore.StalePlayerMap) (map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, error) {
+	maps := make(map[completionstore.PlayerMap][]completionstore.PlayerClassZoneResult, len(playerMaps))
+
+	for _, pm := range playerMaps {
+		results, err := db.queryResults(ctx, sqlstore.PlayerMapResults(pm.PlayerMap))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range results {
+			if r.Tier == 0 {
+				continue
+			}
+
+			maps[pm.PlayerMap] = append(maps[pm.PlayerMap], r)
+		}
+	}
+
+	return maps, nil
+}
+
+// GetPlayerZones returns every zone a player has a result on.
+func (db *DB) GetPlayerZones(ctx context.Context, playerID uint64) ([]completionstore.Zone, error) {
+	zones := make([]completionstore.Zone, 0, 64)
+
+	err := db.each(ctx, sqlstore.PlayerZones(playerID), func(rows sqlstore.Scanner) error {
+		z, err := sqlstore.ScanZone(rows)
+		if err != nil {
+			return err
+		}
+
+		zones = append(zones, z)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+func (db *DB) InsertSteamIDs(ctx context.Context, steamIDs map[string]uint64) error {
+	return db.write(ctx, sqlstore.InsertSteamIDs(steamIDs))
+}
+
+func (db *DB) GetStalePlayerMaps(ctx context.Context) ([]completionstore.StalePlayerMap, error) {
+	playerMaps := make([]completionstore.StalePlayerMap, 0, 64)
+
+	err := db.each(ctx, sqlstore.StalePlayerMaps(), func(rows sqlstore.Scanner) error {
+		pm, err := sqlstore.ScanStalePlayerMap(rows)
+		if err != nil {
+			return err
+		}
+
+		playerMaps = append(playerMaps, pm)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return playerMaps, nil
+}
+
+func (db *DB) GetPlayerBySteamID(ctx context.Context, steamID string) (uint64, bool, error) {
+	var (
+		playerID uint64
+		found    bool
+	)
+
+	err := db.each(ctx, sqlstore.PlayerBySteamID(steamID), func(rows sqlstore.Scanner) error {
+		var err error
+
+		playerID, err = sqlstore.ScanUint(rows)
+		found = err == nil
+
+		return err
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return playerID, found, nil
+}
+
+// JobQueue is a jobqueue.Queue kept in the jobs table.
+type JobQueue struct {
+	db *DB
+}
+
+var _ jobqueue.Queue = (*JobQueue)(nil)
+
+func (db *DB) Jobs() *JobQueue {
+	return &JobQueue{db: db}
+}
+
+// getJob returns the first job the statement selects, reporting false if
+// there is none.
+func (q *JobQueue) getJob(ctx context.Context, s sqlstore.Statement) (jobqueue.Job, bool, error) {
+	var (
+		job   jobqueue.Job
+		found bool
+	)
+
+	err := q.db.each(ctx, s, func(rows sqlstore.Scanner) error {
+		if found {
+			return nil
+		}
+
+		var err error
+
+		job, err = sqlstore.ScanJob(rows)
+		found = err == nil
+
+		return err
+	})
+	if err != nil {
+		return jobqueue.Job{}, false, err
+	}
+
+	return job, found, nil
+}
+
+func (q *JobQueue) Enqueue(ctx context.Context, kind jobqueue.Kind, target uint64, now time.Time) (jobqueue.Job, error) {
+	if _, err := q.db.exec(ctx, sqlstore.EnqueueJob(kind, target, now)); err != nil {
+		return jobqueue.Job{}, err
+	}
+
+	job, ok, err := q.getJob(ctx, sqlstore.ActiveJob(kind, target))
+	if err != nil {
+		return jobqueue.Job{}, err
+	}
+
+	if !ok {
+		return jobqueue.Job{}, jobqueue.ErrNotFound
+	}
+
+	return job, nil
+}
+
+// Claim takes the next job only if no other worker claimed it in the
+// meantime, otherwise it reports that there is none.
+func (q *JobQueue) Claim(ctx context.Context, now time.Time, lease time.Duration) (jobqueue.Job, bool, error) {
+	if _, err := q.db.exec(ctx, sqlstore.ExpireJobs(now)); err != nil {
+		return jobqueue.Job{}, false, err
+	}
+
+	job, ok, err := q.getJob(ctx, sqlstore.NextJob(now))
+	if err != nil || !ok {
+		return jobqueue.Job{}, false, err
+	}
+
+	claimed := job
+	claimed.State = jobqueue.StateRunning
+	claimed.Attempts++
+	claimed.Available = now.Add(lease)
+
+	result, err := q.db.exec(ctx, sqlstore.ClaimJob(job, claimed))
+	if err != nil {
+		return jobqueue.Job{}, false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return jobqueue.Job{}, false, fmt.Errorf("rows affected: %w", err)
+	}
+
+	if n == 0 {
+		return jobqueue.Job{}, false, nil
+	}
+
+	return claimed, true, nil
+}
+
+func (q *JobQueue) Complete(ctx context.Context, job jobqueue.Job, now time.Time, jobErr error) error {
+	if _, err := q.db.exec(ctx, sqlstore.CompleteJob(job, jobqueue.Finish(job, now, jobErr))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (q *JobQueue) Get(ctx context.Context, id uint64) (jobqueue.Job, error) {
+	job, ok, err := q.getJob(ctx, sqlstore.Job(id))
+	if err != nil {
+		return jobqueue.Job{}, err
+	}
+
+	if !ok {
+		return jobqueue.Job{}, jobqueue.ErrNotFound
+	}
+
+	return job, nil
+}
+
+func (q *JobQueue) Latest(ctx context.Context, kind jobqueue.Kind, target uint64) (jobqueue.Job, bool, error) {
+	return q.getJob(ctx, sqlstore.LatestJob(kind, target))
+}
+
+func (q *JobQueue) Pending(ctx context.Context) (int, error) {
+	var n uint64
+
+	err := q.db.each(ctx, sqlstore.PendingJobs(), func(rows sqlstore.Scanner) error {
+		var err error
+
+		n, err = sqlstore.ScanUint(rows)
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
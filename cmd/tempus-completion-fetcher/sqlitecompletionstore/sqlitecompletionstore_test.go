@@ -0,0 +1,251 @@
+package sqlitecompletionstore_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstoretest"
+	"tempus-completion/cmd/tempus-completion-fetcher/sqlitecompletionstore"
+	"tempus-completion/jobqueue"
+	"tempus-completion/tempushttp"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T) *sqlitecompletionstore.DB {
+	db, err := sqlitecompletionstore.New(filepath.Join(t.TempDir(), "completion.db"))
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	if _, err := completionstore.Migrate(context.Background(), db, time.Now()); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	completionstoretest.Run(t, func(t *testing.T) completionstoretest.Store {
+		return open(t)
+	})
+}
+
+func TestJobs(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC).UnixMilli())
+
+	q := open(t).Jobs()
+
+	job, err := q.Enqueue(ctx, jobqueue.KindRefreshMap, 439, now)
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	if again, _ := q.Enqueue(ctx, jobqueue.KindRefreshMap, 439, now); again.ID != job.ID {
+		t.Fatalf("expected the pending job %d to be reused, got %d", job.ID, again.ID)
+	}
+
+	claimed, ok, err := q.Claim(ctx, now, time.Minute)
+	if err != nil || !ok || claimed.ID != job.ID || claimed.Attempts != 1 {
+		t.Fatalf("unexpected claim %+v %v %v", claimed, ok, err)
+	}
+
+	if err := q.Complete(ctx, claimed, now.Add(time.Second), nil); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+
+	if job, _ = q.Get(ctx, job.ID); job.State != jobqueue.StateDone || !job.Finished.Equal(now.Add(time.Second)) {
+		t.Fatalf("expected the job to be done, got %+v", job)
+	}
+
+	if latest, ok, err := q.Latest(ctx, jobqueue.KindRefreshMap, 439); err != nil || !ok || latest.ID != job.ID {
+		t.Fatalf("expected the latest job to be %d, got %+v %v %v", job.ID, latest, ok, err)
+	}
+
+	if n, err := q.Pending(ctx); err != nil || n != 0 {
+		t.Fatalf("expected no pending jobs, got %d %v", n, err)
+	}
+}
+
+func TestJobsExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC).UnixMilli())
+
+	q := open(t).Jobs()
+
+	job, err := q.Enqueue(ctx, jobqueue.KindRefreshPlayer, 59983, now)
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	for attempt := 1; attempt <= jobqueue.MaxAttempts; attempt++ {
+		claimed, ok, err := q.Claim(ctx, now, time.Minute)
+		if err != nil || !ok || claimed.Attempts != attempt {
+			t.Fatalf("expected attempt %d, got %+v %v %v", attempt, claimed, ok, err)
+		}
+
+		now = claimed.Available
+	}
+
+	if _, ok, err := q.Claim(ctx, now, time.Minute); err != nil || ok {
+		t.Fatalf("expected the job not to be claimed after %d attempts, got %v %v", jobqueue.MaxAttempts, ok, err)
+	}
+
+	job, _ = q.Get(ctx, job.ID)
+	if job.State != jobqueue.StateFailed || job.Error != jobqueue.ErrLeaseExpired.Error() || !job.Finished.Equal(now) {
+		t.Fatalf("expected the job to fail, got %+v", job)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC).UnixMilli())
+
+	db := open(t)
+
+	if applied, err := completionstore.Migrate(ctx, db, now); err != nil || len(applied) != 0 {
+		t.Fatalf("expected nothing to apply, got %+v %v", applied, err)
+	}
+
+	status, err := completionstore.GetMigrationStatus(ctx, db)
+	if err != nil {
+		t.Fatalf("get migration status: %s", err)
+	}
+
+	for _, s := range status {
+		if s.Applied.IsZero() {
+			t.Fatalf("expected %d %s to be applied", s.Version, s.Name)
+		}
+	}
+
+	future := completionstore.Migration{Version: len(status) + 1, Name: "future", Query: "SELECT 1;"}
+	if err := db.ApplyMigration(ctx, future, now); err != nil {
+		t.Fatalf("apply migration: %s", err)
+	}
+
+	if _, err := completionstore.Migrate(ctx, db, now); err == nil {
+		t.Fatalf("expected a store ahead of this build to fail")
+	}
+}
+
+func TestMigrateNames(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "completion.db")
+
+	db, err := sqlitecompletionstore.New(path)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	defer db.Close()
+
+	migrations, err := completionstore.Migrations()
+	if err != nil {
+		t.Fatalf("migrations: %s", err)
+	}
+
+	for _, m := range migrations[:2] {
+		if err := db.ApplyMigration(ctx, m, time.Now()); err != nil {
+			t.Fatalf("apply migration %d: %s", m.Version, err)
+		}
+	}
+
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+
+	defer conn.Close()
+
+	const q = `
+INSERT INTO zones VALUES (439, 'bonus', 1, 'jump_beef', 0, 0, 0);
+INSERT INTO zone_class_info VALUES (439, 'bonus', 1, 3, 'jump_beef', 'the bonus', 2, 1, 0);
+INSERT INTO player_class_zone_results VALUES (59983, 439, 'bonus', 1, 3, 'the bonus', 'jump_beef', 2, 0, 1, 10, 1000, 1, 0);
+`
+
+	if _, err := conn.ExecContext(ctx, q); err != nil {
+		t.Fatalf("insert rows: %s", err)
+	}
+
+	if _, err := completionstore.Migrate(ctx, db, time.Now()); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+
+	zone := completionstore.Zone{MapID: 439, ZoneType: tempushttp.ZoneTypeBonus, ZoneIndex: 1}
+
+	results, err := db.GetZoneResults(ctx, []completionstore.Zone{zone})
+	if err != nil {
+		t.Fatalf("get zone results: %s", err)
+	}
+
+	if len(results) != 1 || results[0].MapName != "jump_beef" || results[0].CustomName != "the bonus" {
+		t.Fatalf("expected the names to survive the migration, got %+v", results)
+	}
+}
+
+func TestMigrateInitialized(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "completion.db")
+
+	db, err := sqlitecompletionstore.New(path)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	defer db.Close()
+
+	migrations, err := completionstore.Migrations()
+	if err != nil {
+		t.Fatalf("migrations: %s", err)
+	}
+
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+
+	defer conn.Close()
+
+	// A database created by -initialize has the first schema but no
+	// schema_migrations.
+	if _, err := conn.ExecContext(ctx, migrations[0].Query); err != nil {
+		t.Fatalf("create schema: %s", err)
+	}
+
+	const q = `
+INSERT INTO zones VALUES (439, 'bonus', 1, 'jump_beef', 0, 0);
+INSERT INTO zone_class_info VALUES (439, 'bonus', 1, 3, 'jump_beef', 'the bonus', 2, 1);
+`
+
+	if _, err := conn.ExecContext(ctx, q); err != nil {
+		t.Fatalf("insert rows: %s", err)
+	}
+
+	if _, err := completionstore.Migrate(ctx, db, time.Now()); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+
+	info, err := db.GetAllZoneClassInfo(ctx)
+	if err != nil {
+		t.Fatalf("get all zone class info: %s", err)
+	}
+
+	if len(info) != 1 || info[0].MapName != "jump_beef" || info[0].CustomName != "the bonus" {
+		t.Fatalf("expected the zone class info to survive the migration, got %+v", info)
+	}
+
+	schedule, err := db.GetZoneSchedule(ctx, nil)
+	if err != nil {
+		t.Fatalf("get zone schedule: %s", err)
+	}
+
+	if len(schedule) != 1 || schedule[0].Zone.MapID != 439 {
+		t.Fatalf("expected the zone to be scheduled, got %+v", schedule)
+	}
+}
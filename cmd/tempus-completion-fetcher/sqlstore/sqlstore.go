@@ -0,0 +1,1324 @@
+// Package sqlstore holds the queries and row scanning shared by
+// sqlitecompletionstore and rqlitecompletionstore, which have the same
+// schema. The stores only run the statements.
+package sqlstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/jobqueue"
+	"tempus-completion/tempushttp"
+	"time"
+)
+
+// Statement is a query and its arguments.
+type Statement struct {
+	Query string
+	Args  []any
+}
+
+// Scanner reads the current row of a query. *sql.Rows and
+// *gorqlite.QueryResult are both scanners.
+//
+// Rows are only scanned into int64, string and []byte, the types both
+// drivers support, and selected columns are never NULL.
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+func unixMilliOrZero(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(ms)
+}
+
+// insertRows is how many rows go in one multi-row INSERT, far below sqlite's
+// limit on parameters for the widest table.
+const insertRows = 200
+
+// insertStatements builds multi-row INSERTs from query, whose VALUES are a
+// single %s, with up to insertRows rows each.
+func insertStatements(query string, rows [][]any) []Statement {
+	statements := make([]Statement, 0, (len(rows)+insertRows-1)/insertRows)
+
+	for chunk := range slices.Chunk(rows, insertRows) {
+		values := make([]string, 0, len(chunk))
+		args := make([]any, 0, len(chunk)*len(chunk[0]))
+
+		for _, row := range chunk {
+			values = append(values, "("+strings.TrimSuffix(strings.Repeat("?, ", len(row)), ", ")+")")
+			args = append(args, row...)
+		}
+
+		statements = append(statements, Statement{fmt.Sprintf(query, strings.Join(values, ",\n\t")), args})
+	}
+
+	return statements
+}
+
+type inClause struct {
+	n     int
+	field string
+}
+
+func buildInClauses(clauses []inClause) string {
+	parts := make([]string, 0, len(clauses))
+
+	for _, c := range clauses {
+		parts = append(parts, c.field+" IN ("+strings.TrimSuffix(strings.Repeat("?,", c.n), ",")+")")
+	}
+
+	return strings.Join(parts, " AND ")
+}
+
+// filterArgs appends the arguments of the IN clauses built for a player's
+// results pages.
+func filterArgs(args []any, zoneTypes []string, tiers, classes []uint8) []any {
+	for _, zt := range zoneTypes {
+		args = append(args, zt)
+	}
+
+	for _, t := range tiers {
+		args = append(args, t)
+	}
+
+	for _, c := range classes {
+		args = append(args, c)
+	}
+
+	return args
+}
+
+// MigrationsTableExists selects a row if the schema_migrations table exists.
+func MigrationsTableExists() Statement {
+	return Statement{Query: "SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations';"}
+}
+
+// AppliedMigrations selects the version and time of every applied migration,
+// scanned by ScanAppliedMigration.
+func AppliedMigrations() Statement {
+	return Statement{Query: "SELECT version, applied FROM schema_migrations;"}
+}
+
+func ScanAppliedMigration(s Scanner) (int, time.Time, error) {
+	var version, applied int64
+
+	if err := s.Scan(&version, &applied); err != nil {
+		return 0, time.Time{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	return int(version), time.UnixMilli(applied), nil
+}
+
+// ApplyMigration creates the migrations table if needed, applies m and
+// records it. The statements are to be run in one transaction.
+func ApplyMigration(m completionstore.Migration, t time.Time) []Statement {
+	const q = "INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?);"
+
+	return []Statement{
+		{Query: completionstore.MigrationsTable},
+		{Query: m.Query},
+		{Query: q, Args: []any{m.Version, m.Name, t.UnixMilli()}},
+	}
+}
+
+// CommitZone returns the statements storing everything fetched for a zone,
+// marking it fetched unless Fetched is zero. The zone is marked last, so a
+// commit that fails partway is fetched again, and events go before the
+// results they were diffed from, so that they are repeated rather than lost.
+func CommitZone(c completionstore.ZoneCommit) []Statement {
+	statements := InsertEvents(c.Events)
+	statements = append(statements, InsertResultHistory(c.History)...)
+	statements = append(statements, InsertPlayerClassZoneResults(c.Results)...)
+	statements = append(statements, InsertZoneClassInfo(c.Info)...)
+	statements = append(statements, InsertSteamIDs(c.SteamIDs)...)
+
+	if !c.Fetched.IsZero() {
+		statements = append(statements, SetZonesFetched([]completionstore.Zone{c.Zone}, c.Fetched)...)
+	}
+
+	return statements
+}
+
+// ZoneSchedule selects every zone that is not retired, scanned by
+// ScanZoneSchedule.
+func ZoneSchedule() Statement {
+	const q = `
+SELECT
+	zones.map_id,
+	zones.zone_type,
+	zones.zone_index,
+	COALESCE(maps.name, ''),
+	zones.fetched,
+	COALESCE(info.completions, 0),
+	COALESCE(results.first_date, 0),
+	COALESCE(results.last_date, 0)
+FROM
+	zones
+LEFT JOIN
+	maps
+ON
+	maps.map_id = zones.map_id
+LEFT JOIN (
+	SELECT
+		map_id,
+		zone_type,
+		zone_index,
+		SUM(completions) AS completions
+	FROM
+		zone_class_info
+	GROUP BY
+		map_id, zone_type, zone_index
+) AS info USING (map_id, zone_type, zone_index)
+LEFT JOIN (
+	SELECT
+		map_id,
+		zone_type,
+		zone_index,
+		MIN(date) AS first_date,
+		MAX(date) AS last_date
+	FROM
+		player_class_zone_results
+	GROUP BY
+		map_id, zone_type, zone_index
+) AS results USING (map_id, zone_type, zone_index)
+WHERE
+	zones.retired = 0;
+`
+
+	return Statement{Query: q}
+}
+
+func ScanZoneSchedule(s Scanner) (completionstore.ZoneSchedule, error) {
+	var (
+		mapID       int64
+		zoneType    string
+		zoneIndex   int64
+		mapName     string
+		fetched     int64
+		completions int64
+		firstDate   int64
+		lastDate    int64
+	)
+
+	if err := s.Scan(&mapID, &zoneType, &zoneIndex, &mapName, &fetched, &completions, &firstDate, &lastDate); err != nil {
+		return completionstore.ZoneSchedule{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	z := completionstore.ZoneSchedule{
+		Zone: completionstore.Zone{
+			MapID:     uint64(mapID),
+			MapName:   mapName,
+			ZoneType:  tempushttp.ZoneType(zoneType),
+			ZoneIndex: uint8(zoneIndex),
+		},
+		Fetched:     unixMilliOrZero(fetched),
+		Completions: uint32(completions),
+		FirstResult: unixMilliOrZero(firstDate),
+		LastResult:  unixMilliOrZero(lastDate),
+	}
+
+	return z, nil
+}
+
+// TrackedResults selects the date of the given players' latest result on
+// each zone, scanned by ScanTrackedResult.
+func TrackedResults(playerIDs []uint64) Statement {
+	q := `
+SELECT
+	map_id,
+	zone_type,
+	zone_index,
+	MAX(date)
+FROM
+	player_class_zone_results
+WHERE
+	` + buildInClauses([]inClause{{n: len(playerIDs), field: "player_id"}}) + `
+GROUP BY
+	map_id, zone_type, zone_index;
+`
+
+	args := make([]any, 0, len(playerIDs))
+	for _, playerID := range playerIDs {
+		args = append(args, playerID)
+	}
+
+	return Statement{q, args}
+}
+
+// ScanTrackedResult returns a zone, without its map name, and the date of
+// the latest result on it.
+func ScanTrackedResult(s Scanner) (completionstore.Zone, time.Time, error) {
+	var (
+		mapID     int64
+		zoneType  string
+		zoneIndex int64
+		lastDate  int64
+	)
+
+	if err := s.Scan(&mapID, &zoneType, &zoneIndex, &lastDate); err != nil {
+		return completionstore.Zone{}, time.Time{}, fmt.Errorf("scan tracked results: %w", err)
+	}
+
+	z := completionstore.Zone{
+		MapID:     uint64(mapID),
+		ZoneType:  tempushttp.ZoneType(zoneType),
+		ZoneIndex: uint8(zoneIndex),
+	}
+
+	return z, unixMilliOrZero(lastDate), nil
+}
+
+// infoColumns are scanned by ScanInfo.
+const infoColumns = `
+	zone_class_info.map_id,
+	zone_class_info.zone_type,
+	zone_class_info.zone_index,
+	zone_class_info.class,
+	COALESCE(maps.name, ''),
+	COALESCE(zones.custom_name, ''),
+	zone_class_info.tier,
+	zone_class_info.completions
+`
+
+// infoNames joins the names of zone_class_info's maps and zones.
+const infoNames = `
+LEFT JOIN
+	zones
+ON
+	zones.map_id = zone_class_info.map_id AND
+	zones.zone_type = zone_class_info.zone_type AND
+	zones.zone_index = zone_class_info.zone_index
+LEFT JOIN
+	maps
+ON
+	maps.map_id = zone_class_info.map_id
+`
+
+func ScanInfo(s Scanner) (completionstore.ZoneClassInfo, error) {
+	var (
+		mapID       int64
+		zoneType    string
+		zoneIndex   int64
+		class       int64
+		mapName     string
+		customName  string
+		tier        int64
+		completions int64
+	)
+
+	if err := s.Scan(&mapID, &zoneType, &zoneIndex, &class, &mapName, &customName, &tier, &completions); err != nil {
+		return completionstore.ZoneClassInfo{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	info := completionstore.ZoneClassInfo{
+		MapID:       uint64(mapID),
+		ZoneType:    tempushttp.ZoneType(zoneType),
+		ZoneIndex:   uint8(zoneIndex),
+		Class:       tempushttp.ClassType(class),
+		MapName:     mapName,
+		CustomName:  customName,
+		Tier:        uint8(tier),
+		Completions: uint32(completions),
+	}
+
+	return info, nil
+}
+
+// AllZoneClassInfo selects the info of every rated zone that is not retired,
+// scanned by ScanInfo.
+func AllZoneClassInfo() Statement {
+	q := `
+SELECT` + infoColumns + `FROM
+	zone_class_info` + infoNames + `WHERE
+	zone_class_info.tier != 0 AND
+	zone_class_info.retired = 0;
+`
+
+	return Statement{Query: q}
+}
+
+// ZoneClassInfo selects the info of a zone, including a tier of zero,
+// scanned by ScanInfo.
+func ZoneClassInfo(z completionstore.Zone) Statement {
+	q := `
+SELECT` + infoColumns + `FROM
+	zone_class_info` + infoNames + `WHERE
+	zone_class_info.map_id = ? AND
+	zone_class_info.zone_type = ? AND
+	zone_class_info.zone_index = ?;
+`
+
+	return Statement{q, []any{z.MapID, z.ZoneType, z.ZoneIndex}}
+}
+
+func SetZonesFetched(zones []completionstore.Zone, t time.Time) []Statement {
+	const q = "UPDATE zones SET fetched = ? WHERE map_id = ? AND zone_type = ? AND zone_index = ?;"
+
+	statements := make([]Statement, 0, len(zones))
+
+	for _, z := range zones {
+		statements = append(statements, Statement{q, []any{t.UnixMilli(), z.MapID, z.ZoneType, z.ZoneIndex}})
+	}
+
+	return statements
+}
+
+// InsertPlayerClassZoneResults upserts the results and bumps the latest
+// update of their players' stats on their maps.
+func InsertPlayerClassZoneResults(results []completionstore.PlayerClassZoneResult) []Statement {
+	const q1 = `
+INSERT INTO
+	player_class_zone_results (
+		player_id,
+		map_id,
+		zone_type,
+		zone_index,
+		class,
+		tier,
+		updated,
+		rank,
+		duration,
+		date,
+		completions
+	)
+VALUES
+	%s
+ON CONFLICT
+	(player_id, map_id, zone_type, zone_index, class)
+DO UPDATE SET
+	tier = excluded.tier,
+	updated = excluded.updated,
+	rank = excluded.rank,
+	duration = excluded.duration,
+	date = excluded.date,
+	completions = excluded.completions,
+	retired = 0;
+`
+
+	const q2 = `
+INSERT INTO
+	player_map_stats (
+		player_id,
+		map_id,
+		latest_update,
+		latest_processed_update,
+		data
+	)
+VALUES
+	%s
+ON CONFLICT
+	(player_id, map_id)
+DO UPDATE SET
+	latest_update = excluded.latest_update;
+`
+
+	rows := make([][]any, 0, len(results))
+	latestUpdates := make(map[completionstore.PlayerMap]time.Time)
+
+	for _, r := range results {
+		rows = append(rows, []any{
+			r.PlayerID,
+			r.MapID,
+			r.ZoneType,
+			r.ZoneIndex,
+			r.Class,
+			r.Tier,
+			r.Updated.UnixMilli(),
+			r.Rank,
+			r.Duration,
+			r.Date.UnixMilli(),
+			r.Completions,
+		})
+
+		latestUpdates[completionstore.PlayerMap{PlayerID: r.PlayerID, MapID: r.MapID}] = r.Updated
+	}
+
+	statements := insertStatements(q1, rows)
+
+	rows = make([][]any, 0, len(latestUpdates))
+	for pm, t := range latestUpdates {
+		rows = append(rows, []any{pm.PlayerID, pm.MapID, t.UnixMilli(), 0, "{}"})
+	}
+
+	return append(statements, insertStatements(q2, rows)...)
+}
+
+// resultColumns are scanned by ScanResult.
+const resultColumns = `
+	player_class_zone_results.player_id,
+	player_class_zone_results.map_id,
+	player_class_zone_results.zone_type,
+	player_class_zone_results.zone_index,
+	player_class_zone_results.class,
+	COALESCE(zones.custom_name, ''),
+	COALESCE(maps.name, ''),
+	player_class_zone_results.tier,
+	player_class_zone_results.rank,
+	player_class_zone_results.duration,
+	player_class_zone_results.date,
+	player_class_zone_results.completions
+`
+
+// resultNames joins the names of player_class_zone_results' maps and zones.
+const resultNames = `
+LEFT JOIN
+	zones
+ON
+	zones.map_id = player_class_zone_results.map_id AND
+	zones.zone_type = player_class_zone_results.zone_type AND
+	zones.zone_index = player_class_zone_results.zone_index
+LEFT JOIN
+	maps
+ON
+	maps.map_id = player_class_zone_results.map_id
+`
+
+// joinedResultColumns are the columns of resultColumns for zone_class_info
+// joined with a player's results, whose player_id is the first argument.
+// Zones the player has no result on are selected with that player_id and a
+// zero rank, duration and date.
+const joinedResultColumns = `
+	?,
+	zone_class_info.map_id,
+	zone_class_info.zone_type,
+	zone_class_info.zone_index,
+	zone_class_info.class,
+	COALESCE(zones.custom_name, ''),
+	COALESCE(maps.name, ''),
+	zone_class_info.tier,
+	COALESCE(player_class_zone_results.rank, 0),
+	COALESCE(player_class_zone_results.duration, 0),
+	COALESCE(player_class_zone_results.date, 0),
+	zone_class_info.completions
+`
+
+// joinedResults joins zone_class_info with the results of the player given
+// as the second argument.
+const joinedResults = `
+LEFT JOIN
+	player_class_zone_results
+ON
+	zone_class_info.map_id = player_class_zone_results.map_id AND
+	zone_class_info.zone_type = player_class_zone_results.zone_type AND
+	zone_class_info.zone_index = player_class_zone_results.zone_index AND
+	zone_class_info.class = player_class_zone_results.class AND
+	player_class_zone_results.player_id = ?`
+
+func ScanResult(s Scanner) (completionstore.PlayerClassZoneResult, error) {
+	var (
+		playerID    int64
+		mapID       int64
+		zoneType    string
+		zoneIndex   int64
+		class       int64
+		customName  string
+		mapName     string
+		tier        int64
+		rank        int64
+		duration    int64
+		date        int64
+		completions int64
+	)
+
+	if err := s.Scan(&playerID, &mapID, &zoneType, &zoneIndex, &class, &customName, &mapName, &tier, &rank, &duration, &date, &completions); err != nil {
+		return completionstore.PlayerClassZoneResult{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	r := completionstore.PlayerClassZoneResult{
+		MapID:       uint64(mapID),
+		ZoneType:    tempushttp.ZoneType(zoneType),
+		ZoneIndex:   uint8(zoneIndex),
+		PlayerID:    uint64(playerID),
+		Class:       tempushttp.ClassType(class),
+		CustomName:  customName,
+		MapName:     mapName,
+		Tier:        uint8(tier),
+		Rank:        uint32(rank),
+		Duration:    time.Duration(duration),
+		Date:        time.UnixMilli(date),
+		Completions: uint32(completions),
+	}
+
+	return r, nil
+}
+
+// ZoneResults selects every result on a zone, scanned by ScanResult.
+func ZoneResults(z completionstore.Zone) Statement {
+	q := `
+SELECT` + resultColumns + `FROM
+	player_class_zone_results` + resultNames + `WHERE
+	player_class_zone_results.map_id = ? AND
+	player_class_zone_results.zone_type = ? AND
+	player_class_zone_results.zone_index = ?;
+`
+
+	return Statement{q, []any{z.MapID, z.ZoneType, z.ZoneIndex}}
+}
+
+// PlayerResults selects a player's results matching the filters, newest
+// first, scanned by ScanResult.
+func PlayerResults(playerID uint64, zoneTypes []string, tiers, classes []uint8) Statement {
+	q := `
+SELECT` + resultColumns + `FROM
+	player_class_zone_results` + resultNames + `WHERE
+	player_class_zone_results.player_id = ? AND
+	player_class_zone_results.zone_type != 'trick' AND
+	player_class_zone_results.retired = 0 AND
+	` + buildInClauses([]inClause{
+		{n: len(zoneTypes), field: "player_class_zone_results.zone_type"},
+		{n: len(tiers), field: "player_class_zone_results.tier"},
+		{n: len(classes), field: "player_class_zone_results.class"},
+	}) + `
+ORDER BY
+	player_class_zone_results.date DESC;
+`
+
+	return Statement{q, filterArgs([]any{playerID}, zoneTypes, tiers, classes)}
+}
+
+// PlayerMapClassResults selects every zone of a map for a class with the
+// player's result on it, if any, scanned by ScanResult.
+func PlayerMapClassResults(playerID, mapID uint64, class tempushttp.ClassType) Statement {
+	q := `
+SELECT` + joinedResultColumns + `FROM
+	zone_class_info` + joinedResults + infoNames + `WHERE
+	zone_class_info.map_id = ? AND
+	zone_class_info.class = ? AND
+	zone_class_info.zone_type != 'trick' AND
+	zone_class_info.retired = 0
+ORDER BY
+	player_class_zone_results.date DESC;
+`
+
+	return Statement{q, []any{playerID, playerID, mapID, class}}
+}
+
+// PlayerRecentResults selects a player's ten latest results, scanned by
+// ScanResult.
+func PlayerRecentResults(playerID uint64) Statement {
+	q := `
+SELECT` + resultColumns + `FROM
+	player_class_zone_results` + resultNames + `WHERE
+	player_class_zone_results.player_id = ? AND
+	player_class_zone_results.zone_type != 'trick' AND
+	player_class_zone_results.retired = 0
+ORDER BY
+	player_class_zone_results.date DESC
+LIMIT 10;
+`
+
+	return Statement{q, []any{playerID}}
+}
+
+// PlayerClassZoneResults selects every zone matching the filters with the
+// player's result on it, if any, scanned by ScanResult.
+func PlayerClassZoneResults(playerID uint64, zoneTypes []string, tiers, classes []uint8) Statement {
+	q := `
+SELECT` + joinedResultColumns + `FROM
+	zone_class_info` + joinedResults + infoNames + `WHERE
+	zone_class_info.retired = 0 AND
+	` + buildInClauses([]inClause{
+		{n: len(zoneTypes), field: "zone_class_info.zone_type"},
+		{n: len(tiers), field: "zone_class_info.tier"},
+		{n: len(classes), field: "zone_class_info.class"},
+	}) + `;
+`
+
+	return Statement{q, filterArgs([]any{playerID, playerID}, zoneTypes, tiers, classes)}
+}
+
+// PlayerMapResults selects a player's results on a map, scanned by
+// ScanResult.
+func PlayerMapResults(pm completionstore.PlayerMap) Statement {
+	q := `
+SELECT` + resultColumns + `FROM
+	player_class_zone_results` + resultNames + `WHERE
+	player_class_zone_results.player_id = ? AND
+	player_class_zone_results.map_id = ? AND
+	player_class_zone_results.retired = 0;
+`
+
+	return Statement{q, []any{pm.PlayerID, pm.MapID}}
+}
+
+func InsertEvents(events []completionstore.Event) []Statement {
+	const q = `
+INSERT INTO
+	events (
+		created,
+		type,
+		map_id,
+		map_name,
+		zone_type,
+		zone_index,
+		class,
+		player_id,
+		date,
+		old_rank,
+		new_rank,
+		old_duration,
+		new_duration,
+		old_tier,
+		new_tier
+	)
+VALUES
+	%s;
+`
+
+	rows := make([][]any, 0, len(events))
+
+	for _, e := range events {
+		var date int64
+		if !e.Date.IsZero() {
+			date = e.Date.UnixMilli()
+		}
+
+		rows = append(rows, []any{
+			e.Created.UnixMilli(),
+			e.Type,
+			e.MapID,
+			e.MapName,
+			e.ZoneType,
+			e.ZoneIndex,
+			e.Class,
+			e.PlayerID,
+			date,
+			e.OldRank,
+			e.NewRank,
+			e.OldDuration,
+			e.NewDuration,
+			e.OldTier,
+			e.NewTier,
+		})
+	}
+
+	return insertStatements(q, rows)
+}
+
+// InsertResultHistory keeps every distinct duration and date seen for a
+// player's results. Runs already in the history are left as first observed.
+func InsertResultHistory(results []completionstore.PlayerClassZoneResult) []Statement {
+	const q = `
+INSERT INTO
+	player_class_zone_history (
+		player_id,
+		map_id,
+		zone_type,
+		zone_index,
+		class,
+		duration,
+		date,
+		rank,
+		observed
+	)
+VALUES
+	%s
+ON CONFLICT
+	(player_id, map_id, zone_type, zone_index, class, duration, date)
+DO NOTHING;
+`
+
+	rows := make([][]any, 0, len(results))
+
+	for _, r := range results {
+		rows = append(rows, []any{r.PlayerID, r.MapID, r.ZoneType, r.ZoneIndex, r.Class, r.Duration, r.Date.UnixMilli(), r.Rank, r.Updated.UnixMilli()})
+	}
+
+	return insertStatements(q, rows)
+}
+
+// PlayerZoneHistory selects a player's runs on a zone for a class, oldest
+// first, scanned by ScanHistory.
+func PlayerZoneHistory(playerID, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, class tempushttp.ClassType) Statement {
+	const q = `
+SELECT
+	rank,
+	duration,
+	date,
+	observed
+FROM
+	player_class_zone_history
+WHERE
+	player_id = ? AND map_id = ? AND zone_type = ? AND zone_index = ? AND class = ?
+ORDER BY
+	date ASC, duration DESC;
+`
+
+	return Statement{q, []any{playerID, mapID, zoneType, zoneIndex, class}}
+}
+
+func ScanHistory(s Scanner, class tempushttp.ClassType) (completionstore.ResultHistory, error) {
+	var rank, duration, date, observed int64
+
+	if err := s.Scan(&rank, &duration, &date, &observed); err != nil {
+		return completionstore.ResultHistory{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	h := completionstore.ResultHistory{
+		Class:    class,
+		Rank:     uint32(rank),
+		Duration: time.Duration(duration),
+		Date:     time.UnixMilli(date),
+		Observed: time.UnixMilli(observed),
+	}
+
+	return h, nil
+}
+
+// InsertZones adds new zones and updates the names of their maps, keeping
+// when they were last fetched. Zones that had been retired are restored.
+func InsertZones(zones map[completionstore.Zone]struct{}, updated time.Time) []Statement {
+	const q = `
+INSERT INTO zones (map_id, zone_type, zone_index, updated, fetched, retired)
+VALUES %s
+ON CONFLICT (map_id, zone_type, zone_index) DO UPDATE SET
+	updated = excluded.updated,
+	retired = 0;
+`
+
+	rows := make([][]any, 0, len(zones))
+	names := make(map[uint64]string)
+
+	for z := range zones {
+		rows = append(rows, []any{z.MapID, z.ZoneType, z.ZoneIndex, updated.UnixMilli(), 0, 0})
+		names[z.MapID] = z.MapName
+	}
+
+	return append(insertStatements(q, rows), setMapNames(names)...)
+}
+
+// RetireZones hides zones that are no longer in the map list, along with
+// their info and results, and marks the stats of every player on their maps
+// for recomputation.
+func RetireZones(zones []completionstore.Zone, t time.Time) []Statement {
+	queries := []string{
+		"UPDATE zones SET retired = 1 WHERE map_id = ? AND zone_type = ? AND zone_index = ?;",
+		"UPDATE zone_class_info SET retired = 1 WHERE map_id = ? AND zone_type = ? AND zone_index = ?;",
+		"UPDATE player_class_zone_results SET retired = 1 WHERE map_id = ? AND zone_type = ? AND zone_index = ?;",
+	}
+
+	statements := make([]Statement, 0, len(zones)*len(queries)+len(zones))
+
+	mapIDs := make(map[uint64]struct{})
+
+	for _, z := range zones {
+		for _, q := range queries {
+			statements = append(statements, Statement{q, []any{z.MapID, z.ZoneType, z.ZoneIndex}})
+		}
+
+		mapIDs[z.MapID] = struct{}{}
+	}
+
+	return append(statements, stalePlayerMaps(mapIDs, t)...)
+}
+
+// RetireMaps hides the stats of maps that are no longer in the map list.
+func RetireMaps(mapIDs []uint64) []Statement {
+	const q = "UPDATE map_stats SET retired = 1 WHERE map_id = ?;"
+
+	statements := make([]Statement, 0, len(mapIDs))
+
+	for _, mapID := range mapIDs {
+		statements = append(statements, Statement{q, []any{mapID}})
+	}
+
+	return statements
+}
+
+// RenameMaps sets the given maps' names, by map ID, and marks the stats of
+// every player on them for recomputation.
+func RenameMaps(names map[uint64]string, t time.Time) []Statement {
+	mapIDs := make(map[uint64]struct{}, len(names))
+
+	for mapID := range names {
+		mapIDs[mapID] = struct{}{}
+	}
+
+	return append(setMapNames(names), stalePlayerMaps(mapIDs, t)...)
+}
+
+func setMapNames(names map[uint64]string) []Statement {
+	const q = `
+INSERT INTO maps (map_id, name)
+VALUES %s
+ON CONFLICT (map_id) DO UPDATE SET
+	name = excluded.name;
+`
+
+	rows := make([][]any, 0, len(names))
+
+	for mapID, name := range names {
+		rows = append(rows, []any{mapID, name})
+	}
+
+	return insertStatements(q, rows)
+}
+
+// stalePlayerMaps bumps the latest update of every player's stats on the
+// given maps, so that GetStalePlayerMaps returns them again.
+func stalePlayerMaps(mapIDs map[uint64]struct{}, t time.Time) []Statement {
+	const q = "UPDATE player_map_stats SET latest_update = ? WHERE map_id = ?;"
+
+	statements := make([]Statement, 0, len(mapIDs))
+
+	for mapID := range mapIDs {
+		statements = append(statements, Statement{q, []any{t.UnixMilli(), mapID}})
+	}
+
+	return statements
+}
+
+func InsertMapStats(stats map[uint64]completionstore.MapStatsInfo) ([]Statement, error) {
+	const q = `
+INSERT INTO
+	map_stats (
+		map_id,
+		data
+	)
+VALUES
+	%s
+ON CONFLICT
+	(map_id)
+DO UPDATE SET
+	data = excluded.data,
+	retired = 0;
+`
+
+	rows := make([][]any, 0, len(stats))
+
+	for mapID, info := range stats {
+		b, err := json.Marshal(info.Stats)
+		if err != nil {
+			return nil, fmt.Errorf("marshal stats: %w", err)
+		}
+
+		rows = append(rows, []any{mapID, string(b)})
+	}
+
+	return insertStatements(q, rows), nil
+}
+
+func SetPlayerMapsProcessed(maps []completionstore.StalePlayerMap) []Statement {
+	const q = "UPDATE player_map_stats SET latest_processed_update = ? WHERE player_id = ? AND map_id = ?;"
+
+	statements := make([]Statement, 0, len(maps))
+
+	for _, m := range maps {
+		statements = append(statements, Statement{q, []any{m.LatestUpdate.UnixMilli(), m.PlayerID, m.MapID}})
+	}
+
+	return statements
+}
+
+func InsertPlayerMapStats(stats map[completionstore.PlayerMap]completionstore.PlayerMapStats) ([]Statement, error) {
+	const q = "UPDATE player_map_stats SET data = ? WHERE player_id = ? AND map_id = ?;"
+
+	statements := make([]Statement, 0, len(stats))
+
+	for pm, pmstats := range stats {
+		b, err := json.Marshal(pmstats)
+		if err != nil {
+			return nil, fmt.Errorf("marshal map stats: %w", err)
+		}
+
+		statements = append(statements, Statement{q, []any{string(b), pm.PlayerID, pm.MapID}})
+	}
+
+	return statements, nil
+}
+
+// InsertZoneClassInfo upserts the info and sets the custom names of its
+// zones.
+func InsertZoneClassInfo(info []completionstore.ZoneClassInfo) []Statement {
+	const q1 = `
+INSERT INTO
+	zone_class_info (
+		map_id,
+		zone_type,
+		zone_index,
+		class,
+		tier,
+		completions
+	)
+VALUES
+	%s
+ON CONFLICT
+	(map_id, zone_type, zone_index, class)
+DO UPDATE SET
+	tier = excluded.tier,
+	completions = excluded.completions,
+	retired = 0;
+`
+
+	const q2 = "UPDATE zones SET custom_name = ? WHERE map_id = ? AND zone_type = ? AND zone_index = ?;"
+
+	rows := make([][]any, 0, len(info))
+	names := make(map[completionstore.Zone]string)
+
+	for _, zi := range info {
+		rows = append(rows, []any{zi.MapID, zi.ZoneType, zi.ZoneIndex, zi.Class, zi.Tier, zi.Completions})
+		names[completionstore.Zone{MapID: zi.MapID, ZoneType: zi.ZoneType, ZoneIndex: zi.ZoneIndex}] = zi.CustomName
+	}
+
+	statements := insertStatements(q1, rows)
+
+	for z, name := range names {
+		statements = append(statements, Statement{q2, []any{name, z.MapID, z.ZoneType, z.ZoneIndex}})
+	}
+
+	return statements
+}
+
+const mapskey = "map"
+
+func InsertMaps(list *completionstore.MapList) (Statement, error) {
+	const q = `
+INSERT INTO kv (key, value, updated)
+VALUES (?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET
+updated = excluded.updated,
+value = excluded.value;
+`
+
+	b, err := json.Marshal(list.Response)
+	if err != nil {
+		return Statement{}, fmt.Errorf("marshal response: %w", err)
+	}
+
+	return Statement{q, []any{mapskey, string(b), list.Updated.UnixMilli()}}, nil
+}
+
+// Maps selects the stored map list, scanned by ScanMaps.
+func Maps() Statement {
+	return Statement{"SELECT value, updated FROM kv WHERE key = ?;", []any{mapskey}}
+}
+
+func ScanMaps(s Scanner) (*completionstore.MapList, error) {
+	var (
+		data    []byte
+		updated int64
+	)
+
+	if err := s.Scan(&data, &updated); err != nil {
+		return nil, fmt.Errorf("scan results: %w", err)
+	}
+
+	var response tempushttp.GetDetailedMapListResponse
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("unmarshal data: %w", err)
+	}
+
+	list := &completionstore.MapList{
+		Updated:  time.UnixMilli(updated),
+		Response: response,
+	}
+
+	return list, nil
+}
+
+// PlayerZones selects every zone a player has a result on, scanned by
+// ScanZone.
+func PlayerZones(playerID uint64) Statement {
+	const q = `
+SELECT DISTINCT
+	player_class_zone_results.map_id,
+	player_class_zone_results.zone_type,
+	player_class_zone_results.zone_index,
+	COALESCE(maps.name, '')
+FROM
+	player_class_zone_results
+LEFT JOIN
+	maps
+ON
+	maps.map_id = player_class_zone_results.map_id
+WHERE
+	player_class_zone_results.player_id = ? AND
+	player_class_zone_results.retired = 0;
+`
+
+	return Statement{q, []any{playerID}}
+}
+
+func ScanZone(s Scanner) (completionstore.Zone, error) {
+	var (
+		mapID     int64
+		zoneType  string
+		zoneIndex int64
+		mapName   string
+	)
+
+	if err := s.Scan(&mapID, &zoneType, &zoneIndex, &mapName); err != nil {
+		return completionstore.Zone{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	z := completionstore.Zone{
+		MapID:     uint64(mapID),
+		MapName:   mapName,
+		ZoneType:  tempushttp.ZoneType(zoneType),
+		ZoneIndex: uint8(zoneIndex),
+	}
+
+	return z, nil
+}
+
+func InsertSteamIDs(steamIDs map[string]uint64) []Statement {
+	const q = `
+INSERT INTO
+	steam_ids (
+		steam_id,
+		player_id
+	)
+VALUES
+	%s
+ON CONFLICT
+	(steam_id)
+DO NOTHING;
+`
+
+	rows := make([][]any, 0, len(steamIDs))
+
+	for steamID, playerID := range steamIDs {
+		rows = append(rows, []any{steamID, playerID})
+	}
+
+	return insertStatements(q, rows)
+}
+
+// StalePlayerMaps selects player map stats updated since they were last
+// processed, scanned by ScanStalePlayerMap.
+func StalePlayerMaps() Statement {
+	const q = `
+SELECT
+	player_id,
+	map_id,
+	latest_update
+FROM
+	player_map_stats
+WHERE
+	latest_update != latest_processed_update
+LIMIT 10000;
+`
+
+	return Statement{Query: q}
+}
+
+func ScanStalePlayerMap(s Scanner) (completionstore.StalePlayerMap, error) {
+	var playerID, mapID, latestUpdate int64
+
+	if err := s.Scan(&playerID, &mapID, &latestUpdate); err != nil {
+		return completionstore.StalePlayerMap{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	pm := completionstore.StalePlayerMap{
+		PlayerMap: completionstore.PlayerMap{
+			PlayerID: uint64(playerID),
+			MapID:    uint64(mapID),
+		},
+		LatestUpdate: time.UnixMilli(latestUpdate),
+	}
+
+	return pm, nil
+}
+
+// PlayerBySteamID selects the player with a Steam ID, scanned by ScanUint.
+func PlayerBySteamID(steamID string) Statement {
+	return Statement{"SELECT player_id FROM steam_ids WHERE steam_id = ?;", []any{steamID}}
+}
+
+// ScanUint scans a single integer column, such as an ID or a count.
+func ScanUint(s Scanner) (uint64, error) {
+	var id int64
+
+	if err := s.Scan(&id); err != nil {
+		return 0, fmt.Errorf("scan results: %w", err)
+	}
+
+	return uint64(id), nil
+}
+
+// jobColumns are scanned by ScanJob.
+const jobColumns = `
+	id,
+	kind,
+	target,
+	state,
+	attempts,
+	error,
+	created,
+	available,
+	finished
+`
+
+func ScanJob(s Scanner) (jobqueue.Job, error) {
+	var (
+		id        int64
+		kind      string
+		target    int64
+		state     string
+		attempts  int64
+		jobErr    string
+		created   int64
+		available int64
+		finished  int64
+	)
+
+	if err := s.Scan(&id, &kind, &target, &state, &attempts, &jobErr, &created, &available, &finished); err != nil {
+		return jobqueue.Job{}, fmt.Errorf("scan results: %w", err)
+	}
+
+	job := jobqueue.Job{
+		ID:        uint64(id),
+		Kind:      jobqueue.Kind(kind),
+		Target:    uint64(target),
+		State:     jobqueue.State(state),
+		Attempts:  int(attempts),
+		Error:     jobErr,
+		Created:   time.UnixMilli(created),
+		Available: time.UnixMilli(available),
+		Finished:  unixMilliOrZero(finished),
+	}
+
+	return job, nil
+}
+
+// EnqueueJob adds a pending job unless one of the same kind and target is
+// already pending or running.
+func EnqueueJob(kind jobqueue.Kind, target uint64, now time.Time) Statement {
+	const q = `
+INSERT INTO jobs (kind, target, state, attempts, error, created, available, finished)
+SELECT ?, ?, 'pending', 0, '', ?, ?, 0
+WHERE NOT EXISTS (
+	SELECT 1 FROM jobs WHERE kind = ? AND target = ? AND state IN ('pending', 'running')
+);
+`
+
+	return Statement{q, []any{kind, target, now.UnixMilli(), now.UnixMilli(), kind, target}}
+}
+
+// ActiveJob selects the pending or running job of a kind and target,
+// scanned by ScanJob.
+func ActiveJob(kind jobqueue.Kind, target uint64) Statement {
+	q := `
+SELECT` + jobColumns + `FROM
+	jobs
+WHERE
+	kind = ? AND target = ? AND state IN ('pending', 'running')
+ORDER BY
+	id DESC
+LIMIT 1;
+`
+
+	return Statement{q, []any{kind, target}}
+}
+
+// ExpireJobs fails running jobs whose lease ran out on their last attempt.
+func ExpireJobs(now time.Time) Statement {
+	const q = `
+UPDATE
+	jobs
+SET
+	state = 'failed',
+	error = ?,
+	finished = ?
+WHERE
+	state = 'running' AND available <= ? AND attempts >= ?;
+`
+
+	return Statement{q, []any{jobqueue.ErrLeaseExpired.Error(), now.UnixMilli(), now.UnixMilli(), jobqueue.MaxAttempts}}
+}
+
+// NextJob selects the job to claim next, scanned by ScanJob.
+func NextJob(now time.Time) Statement {
+	q := `
+SELECT` + jobColumns + `FROM
+	jobs
+WHERE
+	state IN ('pending', 'running') AND available <= ?
+ORDER BY
+	available, id
+LIMIT 1;
+`
+
+	return Statement{q, []any{now.UnixMilli()}}
+}
+
+// ClaimJob sets job to claimed, affecting no row if another worker changed
+// job since it was selected.
+func ClaimJob(job, claimed jobqueue.Job) Statement {
+	const q = `
+UPDATE
+	jobs
+SET
+	state = 'running',
+	attempts = attempts + 1,
+	available = ?
+WHERE
+	id = ? AND state = ? AND attempts = ?;
+`
+
+	return Statement{q, []any{claimed.Available.UnixMilli(), job.ID, job.State, job.Attempts}}
+}
+
+// CompleteJob records how a running job finished, unless it was claimed
+// again since.
+func CompleteJob(job, finished jobqueue.Job) Statement {
+	const q = `
+UPDATE
+	jobs
+SET
+	state = ?,
+	error = ?,
+	available = ?,
+	finished = ?
+WHERE
+	id = ? AND state = 'running' AND attempts = ?;
+`
+
+	var finishedAt int64
+	if !finished.Finished.IsZero() {
+		finishedAt = finished.Finished.UnixMilli()
+	}
+
+	return Statement{q, []any{finished.State, finished.Error, finished.Available.UnixMilli(), finishedAt, job.ID, job.Attempts}}
+}
+
+// Job selects a job by ID, scanned by ScanJob.
+func Job(id uint64) Statement {
+	q := `
+SELECT` + jobColumns + `FROM
+	jobs
+WHERE
+	id = ?;
+`
+
+	return Statement{q, []any{id}}
+}
+
+// LatestJob selects the latest job of a kind and target, scanned by
+// ScanJob.
+func LatestJob(kind jobqueue.Kind, target uint64) Statement {
+	q := `
+SELECT` + jobColumns + `FROM
+	jobs
+WHERE
+	kind = ? AND target = ?
+ORDER BY
+	id DESC
+LIMIT 1;
+`
+
+	return Statement{q, []any{kind, target}}
+}
+
+// PendingJobs selects the number of pending or running jobs, scanned by
+// ScanUint.
+func PendingJobs() Statement {
+	return Statement{Query: "SELECT COUNT(*) FROM jobs WHERE state IN ('pending', 'running');"}
+}
@@ -0,0 +1,321 @@
+// Package zonescheduler decides which zones the fetcher refreshes next.
+//
+// Every zone gets a refresh interval from how active and popular it is, and
+// is due once that long has passed since it was last fetched. Due zones are
+// handed out most overdue first.
+package zonescheduler
+
+import (
+	"container/heap"
+	"sync"
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/tempushttp"
+	"time"
+)
+
+type Policy struct {
+	// BaseInterval is how often a zone with no other signals is refreshed.
+	BaseInterval time.Duration
+	MinInterval  time.Duration
+	MaxInterval  time.Duration
+	// RetryDelay is how long a zone that failed to fetch waits before it is
+	// tried again.
+	RetryDelay time.Duration
+}
+
+var DefaultPolicy = Policy{
+	BaseInterval: 24 * time.Hour,
+	MinInterval:  30 * time.Minute,
+	MaxInterval:  72 * time.Hour,
+	RetryDelay:   15 * time.Minute,
+}
+
+const (
+	day = 24 * time.Hour
+
+	popularCompletions = 1000
+)
+
+// Interval returns how long a zone can go between refreshes.
+func (p Policy) Interval(z completionstore.ZoneSchedule, now time.Time) time.Duration {
+	interval := p.BaseInterval
+
+	// zones people are playing right now gain completions fastest
+	if !z.LastResult.IsZero() {
+		switch since := now.Sub(z.LastResult); {
+		case since < day:
+			interval /= 4
+		case since < 7*day:
+			interval /= 2
+		case since > 180*day:
+			interval *= 3
+		}
+	}
+
+	if z.Completions >= popularCompletions {
+		interval /= 2
+	}
+
+	// the first completion stands in for when the map was released
+	if !z.FirstResult.IsZero() && now.Sub(z.FirstResult) < 30*day {
+		interval /= 4
+	}
+
+	if !z.LastTrackedResult.IsZero() && now.Sub(z.LastTrackedResult) < 7*day {
+		interval /= 4
+	}
+
+	return min(max(interval, p.MinInterval), p.MaxInterval)
+}
+
+type zoneKey struct {
+	MapID     uint64
+	ZoneType  tempushttp.ZoneType
+	ZoneIndex uint8
+}
+
+func keyOf(z completionstore.Zone) zoneKey {
+	return zoneKey{
+		MapID:     z.MapID,
+		ZoneType:  z.ZoneType,
+		ZoneIndex: z.ZoneIndex,
+	}
+}
+
+type item struct {
+	schedule completionstore.ZoneSchedule
+	due      time.Time
+	index    int
+}
+
+type queue []*item
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x any) {
+	it := x.(*item)
+	it.index = len(*q)
+	*q = append(*q, it)
+}
+
+func (q *queue) Pop() any {
+	old := *q
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return it
+}
+
+// Scheduler is a priority queue of zones ordered by when they are due. It is
+// safe for concurrent use.
+type Scheduler struct {
+	mu     sync.Mutex
+	policy Policy
+	queue  queue
+	items  map[zoneKey]*item
+}
+
+func New(policy Policy) *Scheduler {
+	return &Scheduler{
+		policy: policy,
+		items:  make(map[zoneKey]*item),
+	}
+}
+
+// Update adds a zone or replaces what is known about it.
+func (s *Scheduler) Update(z completionstore.ZoneSchedule, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.update(z, now)
+}
+
+func (s *Scheduler) update(z completionstore.ZoneSchedule, now time.Time) {
+	due := z.Fetched.Add(s.policy.Interval(z, now))
+
+	if it, ok := s.items[keyOf(z.Zone)]; ok {
+		it.schedule = z
+		it.due = due
+		heap.Fix(&s.queue, it.index)
+
+		return
+	}
+
+	it := &item{
+		schedule: z,
+		due:      due,
+	}
+
+	s.items[keyOf(z.Zone)] = it
+	heap.Push(&s.queue, it)
+}
+
+// Sync makes the scheduled zones match zones, adding new ones as never
+// fetched and dropping the rest. Zones already scheduled keep their state.
+func (s *Scheduler) Sync(zones map[completionstore.Zone]struct{}, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keep := make(map[zoneKey]struct{}, len(zones))
+
+	for z := range zones {
+		k := keyOf(z)
+		keep[k] = struct{}{}
+
+		if it, ok := s.items[k]; ok {
+			it.schedule.MapName = z.MapName
+			continue
+		}
+
+		s.update(completionstore.ZoneSchedule{Zone: z}, now)
+	}
+
+	for k, it := range s.items {
+		if _, ok := keep[k]; ok {
+			continue
+		}
+
+		heap.Remove(&s.queue, it.index)
+		delete(s.items, k)
+	}
+}
+
+// Boost moves a zone to the front of the queue, making it due immediately. It
+// reports whether the zone is scheduled.
+func (s *Scheduler) Boost(z completionstore.Zone) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[keyOf(z)]
+	if !ok {
+		return false
+	}
+
+	it.due = time.Time{}
+	heap.Fix(&s.queue, it.index)
+
+	return true
+}
+
+// BoostMap makes every zone of a map due immediately, returning how many
+// zones it has.
+func (s *Scheduler) BoostMap(mapID uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+
+	for k, it := range s.items {
+		if k.MapID != mapID {
+			continue
+		}
+
+		it.due = time.Time{}
+		heap.Fix(&s.queue, it.index)
+		n++
+	}
+
+	return n
+}
+
+// Defer makes a zone that failed to fetch due again after the policy's retry
+// delay, so that zones which keep failing do not hold the front of the queue.
+// It reports whether the zone is scheduled.
+func (s *Scheduler) Defer(z completionstore.Zone, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[keyOf(z)]
+	if !ok {
+		return false
+	}
+
+	it.due = now.Add(s.policy.RetryDelay)
+	heap.Fix(&s.queue, it.index)
+
+	return true
+}
+
+// MapZones returns the scheduled zones of a map.
+func (s *Scheduler) MapZones(mapID uint64) []completionstore.Zone {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var zones []completionstore.Zone
+
+	for k, it := range s.items {
+		if k.MapID == mapID {
+			zones = append(zones, it.schedule.Zone)
+		}
+	}
+
+	return zones
+}
+
+// Due returns up to n zones that are due at now, most overdue first. Zones
+// stay due until they are updated or deferred.
+func (s *Scheduler) Due(now time.Time, n int) []completionstore.Zone {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zones := make([]completionstore.Zone, 0, n)
+	popped := make([]*item, 0, n)
+
+	for len(zones) < n && s.queue.Len() > 0 && !s.queue[0].due.After(now) {
+		it := heap.Pop(&s.queue).(*item)
+		popped = append(popped, it)
+		zones = append(zones, it.schedule.Zone)
+	}
+
+	for _, it := range popped {
+		heap.Push(&s.queue, it)
+	}
+
+	return zones
+}
+
+// Schedule returns what is known about a zone.
+func (s *Scheduler) Schedule(z completionstore.Zone) (completionstore.ZoneSchedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[keyOf(z)]
+	if !ok {
+		return completionstore.ZoneSchedule{}, false
+	}
+
+	return it.schedule, true
+}
+
+// Pending returns the number of zones that are due at now.
+func (s *Scheduler) Pending(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+
+	for _, it := range s.queue {
+		if !it.due.After(now) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Len returns the number of scheduled zones.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queue.Len()
+}
@@ -0,0 +1,130 @@
+package zonescheduler_test
+
+import (
+	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
+	"tempus-completion/cmd/tempus-completion-fetcher/zonescheduler"
+	"tempus-completion/tempushttp"
+	"testing"
+	"time"
+)
+
+func zone(mapID uint64) completionstore.Zone {
+	return completionstore.Zone{
+		MapID:     mapID,
+		MapName:   "jump_test",
+		ZoneType:  tempushttp.ZoneTypeMap,
+		ZoneIndex: 1,
+	}
+}
+
+func TestSchedulerDue(t *testing.T) {
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	s := zonescheduler.New(zonescheduler.DefaultPolicy)
+
+	// abandoned, fetched two days ago: due in a day
+	s.Update(completionstore.ZoneSchedule{
+		Zone:        zone(1),
+		Fetched:     now.Add(-48 * time.Hour),
+		Completions: 20,
+		FirstResult: now.AddDate(-5, 0, 0),
+		LastResult:  now.AddDate(-2, 0, 0),
+	}, now)
+
+	// busy, fetched two hours ago: due in an hour
+	s.Update(completionstore.ZoneSchedule{
+		Zone:        zone(2),
+		Fetched:     now.Add(-2 * time.Hour),
+		Completions: 5000,
+		FirstResult: now.AddDate(-1, 0, 0),
+		LastResult:  now.Add(-time.Hour),
+	}, now)
+
+	// never fetched
+	s.Update(completionstore.ZoneSchedule{Zone: zone(3)}, now)
+
+	// quiet, fetched a day and a half ago: overdue
+	s.Update(completionstore.ZoneSchedule{
+		Zone:        zone(4),
+		Fetched:     now.Add(-36 * time.Hour),
+		Completions: 100,
+		FirstResult: now.AddDate(-1, 0, 0),
+		LastResult:  now.AddDate(0, -1, 0),
+	}, now)
+
+	due := s.Due(now, 10)
+
+	if len(due) != 2 || due[0].MapID != 3 || due[1].MapID != 4 {
+		t.Fatalf("expected maps 3 and 4 to be due, got %+v", due)
+	}
+
+	due = s.Due(now.Add(2*time.Hour), 10)
+
+	if len(due) != 3 || due[2].MapID != 2 {
+		t.Fatalf("expected map 2 to become due, got %+v", due)
+	}
+
+	if !s.Boost(zone(1)) {
+		t.Fatalf("expected map 1 to be scheduled")
+	}
+
+	due = s.Due(now, 1)
+
+	if len(due) != 1 || due[0].MapID != 1 {
+		t.Fatalf("expected boosted map 1 first, got %+v", due)
+	}
+
+	if zones := s.MapZones(2); len(zones) != 1 || zones[0] != zone(2) {
+		t.Fatalf("expected map 2 to have one zone, got %+v", zones)
+	}
+
+	if n := s.BoostMap(3); n != 1 {
+		t.Fatalf("expected map 3 to have 1 zone, got %d", n)
+	}
+
+	if n := s.Pending(now); n != 3 {
+		t.Fatalf("expected 3 pending zones, got %d", n)
+	}
+
+	s.Sync(map[completionstore.Zone]struct{}{zone(1): {}, zone(5): {}}, now)
+
+	if s.Len() != 2 {
+		t.Fatalf("expected 2 zones after sync, got %d", s.Len())
+	}
+
+	due = s.Due(now, 10)
+
+	if len(due) != 2 || due[0].MapID != 1 || due[1].MapID != 5 {
+		t.Fatalf("expected maps 1 and 5 to be due after sync, got %+v", due)
+	}
+}
+
+func TestSchedulerDefer(t *testing.T) {
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	s := zonescheduler.New(zonescheduler.DefaultPolicy)
+
+	s.Update(completionstore.ZoneSchedule{Zone: zone(1)}, now)
+	s.Update(completionstore.ZoneSchedule{Zone: zone(2), Fetched: now.Add(-48 * time.Hour)}, now)
+
+	// map 1 was never fetched and keeps failing
+	if due := s.Due(now, 1); len(due) != 1 || due[0].MapID != 1 {
+		t.Fatalf("expected map 1 first, got %+v", due)
+	}
+
+	if !s.Defer(zone(1), now) {
+		t.Fatalf("expected map 1 to be scheduled")
+	}
+
+	if due := s.Due(now, 1); len(due) != 1 || due[0].MapID != 2 {
+		t.Fatalf("expected map 2 once map 1 is deferred, got %+v", due)
+	}
+
+	if due := s.Due(now.Add(zonescheduler.DefaultPolicy.RetryDelay), 10); len(due) != 2 || due[0].MapID != 2 || due[1].MapID != 1 {
+		t.Fatalf("expected map 1 to be due again after the retry delay, got %+v", due)
+	}
+
+	if s.Defer(zone(3), now) {
+		t.Fatalf("expected map 3 not to be scheduled")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"tempus-completion/tempusfake"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	flags := NewFlagSet("fake")
+
+	var port string
+	var address string
+	var empty bool
+
+	flags.StringVar(&port, "port", "9877", "")
+	flags.StringVar(&address, "address", cmp.Or(os.Getenv("LISTEN_ADDRESS"), "127.0.0.1"), "")
+	flags.BoolVar(&empty, "empty", false, "")
+
+	ok, err := Parse(flags, args, stderr, "")
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if !ok {
+		return nil
+	}
+
+	world := tempusfake.NewWorld()
+
+	if !empty {
+		if err := world.Seed(); err != nil {
+			return fmt.Errorf("seed world: %w", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v0/", http.StripPrefix("/api/v0", tempusfake.NewServer(world)))
+
+	addr := fmt.Sprintf("[%s]:%s", address, port)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "Listening on tcp at %s, use -api-address http://%s/api/v0\n", listener.Addr().String(), listener.Addr().String())
+
+	server := &http.Server{
+		Handler: mux,
+	}
+
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+
+	return nil
+}
+
+func NewFlagSet(prog string) *flag.FlagSet {
+	f := flag.NewFlagSet(prog, flag.ContinueOnError)
+	f.SetOutput(io.Discard)
+	f.Usage = nil
+
+	return f
+}
+
+func Parse(flags *flag.FlagSet, args []string, stderr io.Writer, usage string) (bool, error) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(stderr, usage)
+			return false, nil
+		}
+
+		return false, fmt.Errorf("argument parsing failure: %w\n\n%s", err, usage)
+	}
+
+	return true, nil
+}
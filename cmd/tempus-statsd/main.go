@@ -11,8 +11,10 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"slices"
 	"sort"
@@ -21,12 +23,16 @@ import (
 	"tempus-completion/cmd/tempus-completion-fetcher/completionstats"
 	"tempus-completion/cmd/tempus-completion-fetcher/completionstore"
 	"tempus-completion/cmd/tempus-completion-fetcher/rqlitecompletionstore"
-	"tempus-completion/cmd/tempus-statsd/httpserveutil"
+	"tempus-completion/cmd/tempus-completion-fetcher/sqlitecompletionstore"
 	"tempus-completion/cmd/tempus-statsd/statsdhttp"
 	"tempus-completion/cmd/tempus-statsd/templateutil"
+	"tempus-completion/httpserveutil"
+	"tempus-completion/jobqueue"
+	"tempus-completion/logutil"
 	"tempus-completion/steamidutil"
 	"tempus-completion/tempushttp"
 	"tempus-completion/tempushttprpc"
+	"tempus-completion/tempusmetrics"
 	"time"
 )
 
@@ -41,16 +47,38 @@ func run(args []string, stdout, stderr io.Writer) error {
 	flags := NewFlagSet("statsd")
 
 	var rqliteaddr string
+	var storeaddr string
 	var certpath string
 	var keypath string
 	var port string
 	var address string
+	var metricsaddr string
+	var apirps float64
+	var apiconcurrency int
+	var apistrict bool
+	var apiaddr string
+	var apitrace bool
+	var logformat string
+	var loglevel string
+	var refreshinterval time.Duration
+	var maxpendingjobs int
 
 	flags.StringVar(&rqliteaddr, "rqlite-address", "", "")
+	flags.StringVar(&storeaddr, "store", "", "")
 	flags.StringVar(&certpath, "cert", "", "")
 	flags.StringVar(&keypath, "key", "", "")
 	flags.StringVar(&port, "port", "9876", "")
 	flags.StringVar(&address, "address", cmp.Or(os.Getenv("LISTEN_ADDRESS"), "0.0.0.0"), "")
+	flags.StringVar(&metricsaddr, "metrics-address", "", "")
+	flags.Float64Var(&apirps, "api-rps", 5, "")
+	flags.IntVar(&apiconcurrency, "api-concurrency", 4, "")
+	flags.BoolVar(&apistrict, "api-strict", false, "")
+	flags.StringVar(&apiaddr, "api-address", "", "")
+	flags.BoolVar(&apitrace, "api-trace", false, "")
+	flags.StringVar(&logformat, "log-format", "text", "")
+	flags.StringVar(&loglevel, "log-level", "info", "")
+	flags.DurationVar(&refreshinterval, "refresh-interval", time.Hour, "")
+	flags.IntVar(&maxpendingjobs, "max-pending-jobs", 20, "")
 
 	ok, err := ParseArgs(flags, args, stderr, "")
 	if err != nil {
@@ -61,8 +89,17 @@ func run(args []string, stdout, stderr io.Writer) error {
 		return nil
 	}
 
-	if rqliteaddr == "" {
-		return fmt.Errorf("-rqlite-address must be set")
+	if storeaddr == "" {
+		storeaddr = rqliteaddr
+	}
+
+	if storeaddr == "" {
+		return fmt.Errorf("-store or -rqlite-address must be set")
+	}
+
+	logger, err := logutil.New(stdout, logformat, loglevel)
+	if err != nil {
+		return fmt.Errorf("new logger: %w", err)
 	}
 
 	mux := http.NewServeMux()
@@ -72,22 +109,62 @@ func run(args []string, stdout, stderr io.Writer) error {
 		return fmt.Errorf("parse templates: %w", err)
 	}
 
-	store, err := rqlitecompletionstore.New(rqliteaddr)
+	store, jobs, err := openStore(storeaddr, logger)
 	if err != nil {
-		return fmt.Errorf("new completion store: %w", err)
+		return fmt.Errorf("open completion store: %w", err)
+	}
+
+	decodeMode := tempushttprpc.DecodeLenient
+	if apistrict {
+		decodeMode = tempushttprpc.DecodeStrict
 	}
 
 	httpc := http.Client{}
 
-	client := tempushttprpc.NewClient(httpc, "")
+	metrics := tempusmetrics.New()
+
+	opts := []tempushttprpc.Option{
+		tempushttprpc.WithRateLimit(apirps, apiconcurrency),
+		tempushttprpc.WithMaxConcurrency(apiconcurrency),
+		tempushttprpc.WithDecodeMode(decodeMode),
+		tempushttprpc.WithUnknownFieldsFunc(func(endpoint string, paths []string) {
+			logger.Warn("unknown fields in response", "endpoint", endpoint, "fields", strings.Join(paths, ", "))
+		}),
+		tempushttprpc.WithObserver(metrics.Observe),
+	}
+
+	if apitrace {
+		opts = append(opts, tempushttprpc.WithObserver(tempushttprpc.LogObserver(logger)))
+	}
+
+	client := tempushttprpc.NewClient(httpc, apiaddr, opts...)
+
+	if metricsaddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+
+		server := httpserveutil.NewServer(metricsaddr, mux, nil, logger)
+
+		go func() {
+			if err := server.Run(context.Background()); err != nil {
+				logger.Error("metrics server", "error", err)
+			}
+		}()
+
+		defer server.Shutdown()
+	}
 
 	h := &Handler{
 		templates: pt,
 		store:     store,
+		jobs:      jobs,
 		client:    client,
+
+		refreshInterval: refreshinterval,
+		maxPendingJobs:  maxpendingjobs,
 	}
 
-	httpserveutil.Register(mux, stdout, h)
+	httpserveutil.Register(mux, logger, h)
 
 	addr := fmt.Sprintf("[%s]:%s", address, port)
 
@@ -106,13 +183,13 @@ func run(args []string, stdout, stderr io.Writer) error {
 	}
 
 	if certpath != "" && keypath != "" {
-		fmt.Fprintf(stdout, "Listening on tcp with tls at %s\n", listener.Addr().String())
+		logger.Info("serving https", "address", listener.Addr().String())
 
 		if err := server.ServeTLS(listener, certpath, keypath); err != nil {
 			return fmt.Errorf("listen and serve tls: %w", err)
 		}
 	} else {
-		fmt.Fprintf(stdout, "Listening on tcp at %s\n", listener.Addr().String())
+		logger.Info("serving http", "address", listener.Addr().String())
 
 		if err := server.Serve(listener); err != nil {
 			return fmt.Errorf("listen and serve: %w", err)
@@ -128,12 +205,41 @@ type Store interface {
 	GetPlayerRecentResults(ctx context.Context, playerID uint64) ([]completionstore.PlayerClassZoneResult, bool, error)
 	GetPlayerBySteamID(ctx context.Context, steamID string) (uint64, bool, error)
 	GetPlayerClassZoneResults(ctx context.Context, playerID uint64, zoneTypes []string, tiers, classes []uint8) ([]completionstore.PlayerClassZoneResult, bool, error)
+	GetPlayerZoneHistory(ctx context.Context, playerID, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, class tempushttp.ClassType) ([]completionstore.ResultHistory, error)
+}
+
+// openStore opens the store at addr, either an rqlite address or
+// sqlite:///path/to/file.
+func openStore(addr string, logger *slog.Logger) (Store, jobqueue.Queue, error) {
+	if path, ok := strings.CutPrefix(addr, "sqlite://"); ok {
+		db, err := sqlitecompletionstore.New(path, sqlitecompletionstore.WithLogger(logger))
+		if err != nil {
+			return nil, nil, fmt.Errorf("new sqlite store: %w", err)
+		}
+
+		return db, db.Jobs(), nil
+	}
+
+	db, err := rqlitecompletionstore.New(addr, rqlitecompletionstore.WithLogger(logger))
+	if err != nil {
+		return nil, nil, fmt.Errorf("new rqlite store: %w", err)
+	}
+
+	return db, db.Jobs(), nil
 }
 
 type Handler struct {
 	client    *tempushttprpc.Client
 	templates PageTemplates
 	store     Store
+	jobs      jobqueue.Queue
+
+	// refreshInterval is how long a refreshed player or map is refused
+	// another refresh, and maxPendingJobs how many jobs may wait for the
+	// fetcher before new ones are refused. A refresh costs an API request
+	// per zone, so they keep visitors from spending the fetcher's budget.
+	refreshInterval time.Duration
+	maxPendingJobs  int
 }
 
 var (
@@ -209,7 +315,7 @@ func (h *Handler) serveSearchResultsPage(w http.ResponseWriter, r *http.Request)
 
 	result, err := h.client.SearchPlayersAndMaps(ctx, query)
 	if err != nil {
-		return httpserveutil.BadRequest(w, "search players and maps: %w", err)
+		return tempusError(w, "search players and maps: %w", err)
 	}
 
 	type pageData struct {
@@ -227,6 +333,19 @@ func (h *Handler) serveSearchResultsPage(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
+// tempusError maps a Tempus API error onto the closest response status, so
+// that a missing player is not reported the same way as an upstream outage.
+func tempusError(w http.ResponseWriter, format string, err error) error {
+	switch {
+	case errors.Is(err, tempushttprpc.ErrNotFound):
+		return httpserveutil.NotFound(w, format, err)
+	case errors.Is(err, tempushttprpc.ErrRateLimited), errors.Is(err, tempushttprpc.ErrServerUnavailable):
+		return httpserveutil.ServiceUnavailable(w, format, err)
+	default:
+		return httpserveutil.InternalError(w, format, err)
+	}
+}
+
 type recentPlayersCookie struct {
 	Players []recentPlayersCookiePlayer `json:"players"`
 }
@@ -300,7 +419,7 @@ func (h *Handler) servePlayerPage(w http.ResponseWriter, r *http.Request) error
 
 	stats, err := h.client.GetPlayerStats(ctx, playerID)
 	if err != nil {
-		return httpserveutil.BadRequest(w, "search players and maps: %w", err)
+		return tempusError(w, "get player stats: %w", err)
 	}
 
 	{
@@ -444,12 +563,14 @@ func (h *Handler) serveMapPage(w http.ResponseWriter, r *http.Request) error {
 
 	type pageData struct {
 		Results  []completionstore.PlayerClassZoneResult
+		MapID    uint64
 		MapName  string
 		PlayerID uint64
 		Class    string
 	}
 
 	d := pageData{
+		MapID:    mapID,
 		PlayerID: playerID,
 		Class:    class,
 		MapName:  results[0].MapName,
@@ -664,6 +785,122 @@ func (h *Handler) serveResultsPage(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+func (h *Handler) serveHistoryPage(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+
+	pid := q.Get("playerid")
+	if pid == "" {
+		return httpserveutil.BadRequest(w, "must specify playerID")
+	}
+
+	playerID, err := strconv.ParseUint(pid, 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed playerID: %w", err)
+	}
+
+	mapID, err := strconv.ParseUint(q.Get("mapid"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed mapID: %w", err)
+	}
+
+	zoneType := tempushttp.ZoneType(q.Get("zone-type"))
+
+	switch zoneType {
+	case tempushttp.ZoneTypeMap, tempushttp.ZoneTypeCourse, tempushttp.ZoneTypeBonus, tempushttp.ZoneTypeTrick:
+	default:
+		return httpserveutil.BadRequest(w, "zone type '%s' is not supported", zoneType)
+	}
+
+	zoneIndex, err := strconv.ParseUint(q.Get("zone-index"), 10, 8)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed zone index: %w", err)
+	}
+
+	class := q.Get("class")
+
+	var ct tempushttp.ClassType
+
+	switch class {
+	case "soldier":
+		ct = tempushttp.ClassTypeSoldier
+	case "demoman":
+		ct = tempushttp.ClassTypeDemoman
+	default:
+		return httpserveutil.BadRequest(w, "class '%s' is not supported", class)
+	}
+
+	history, err := h.store.GetPlayerZoneHistory(r.Context(), playerID, mapID, zoneType, uint8(zoneIndex), ct)
+	if err != nil {
+		return httpserveutil.InternalError(w, "get player zone history: %w", err)
+	}
+
+	switch q.Get("format") {
+	case "json":
+		response := statsdhttp.HistoryResponse{
+			PlayerID:  playerID,
+			MapID:     mapID,
+			ZoneType:  string(zoneType),
+			ZoneIndex: uint8(zoneIndex),
+			Class:     uint8(ct),
+			History:   make([]statsdhttp.ResultHistory, 0, len(history)),
+		}
+
+		for _, entry := range history {
+			response.History = append(response.History, statsdhttp.ResultHistory{
+				Rank:     entry.Rank,
+				Duration: int64(entry.Duration),
+				Date:     entry.Date.UnixMilli(),
+				Observed: entry.Observed.UnixMilli(),
+			})
+		}
+
+		enc := json.NewEncoder(w)
+
+		if err := enc.Encode(response); err != nil {
+			return fmt.Errorf("encode response: %w", err)
+		}
+	default:
+		type historyRow struct {
+			completionstore.ResultHistory
+			Improvement time.Duration
+		}
+
+		type pageData struct {
+			PlayerID  uint64
+			MapID     uint64
+			ZoneType  tempushttp.ZoneType
+			ZoneIndex uint8
+			Class     string
+			History   []historyRow
+		}
+
+		d := pageData{
+			PlayerID:  playerID,
+			MapID:     mapID,
+			ZoneType:  zoneType,
+			ZoneIndex: uint8(zoneIndex),
+			Class:     class,
+			History:   make([]historyRow, 0, len(history)),
+		}
+
+		for i, entry := range history {
+			row := historyRow{ResultHistory: entry}
+
+			if i > 0 {
+				row.Improvement = history[i-1].Duration - entry.Duration
+			}
+
+			d.History = append(d.History, row)
+		}
+
+		if err := h.templates.history.Execute(w, d); err != nil {
+			return fmt.Errorf("execute template: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func SortSoldierTierAscending(stats []completionstats.PlayerMapResultStats) {
 	sort.SliceStable(stats, func(i, j int) bool {
 		return stats[i].Soldier.Tiers < stats[j].Soldier.Tiers
@@ -1231,15 +1468,180 @@ func playerClassZoneResultToHTTP(result completionstore.PlayerClassZoneResult) s
 	}
 }
 
-func (h *Handler) Routes(out io.Writer) map[string]http.Handler {
+var (
+	errRefreshedRecently = errors.New("refreshed recently")
+	errTooManyJobs       = errors.New("too many pending jobs")
+)
+
+// enqueueRefresh asks the fetcher to refresh target. A refresh that is already
+// queued is returned as it is.
+func (h *Handler) enqueueRefresh(ctx context.Context, kind jobqueue.Kind, target uint64, now time.Time) (jobqueue.Job, error) {
+	latest, ok, err := h.jobs.Latest(ctx, kind, target)
+	if err != nil {
+		return jobqueue.Job{}, fmt.Errorf("get latest job: %w", err)
+	}
+
+	if ok && (latest.State == jobqueue.StatePending || latest.State == jobqueue.StateRunning) {
+		return latest, nil
+	}
+
+	if ok && now.Sub(latest.Finished) < h.refreshInterval {
+		return jobqueue.Job{}, errRefreshedRecently
+	}
+
+	pending, err := h.jobs.Pending(ctx)
+	if err != nil {
+		return jobqueue.Job{}, fmt.Errorf("count pending jobs: %w", err)
+	}
+
+	if pending >= h.maxPendingJobs {
+		return jobqueue.Job{}, errTooManyJobs
+	}
+
+	job, err := h.jobs.Enqueue(ctx, kind, target, now)
+	if err != nil {
+		return jobqueue.Job{}, fmt.Errorf("enqueue job: %w", err)
+	}
+
+	return job, nil
+}
+
+// writeRefreshError responds to a refresh that could not be queued.
+func writeRefreshError(w http.ResponseWriter, err error) error {
+	switch {
+	case errors.Is(err, errRefreshedRecently):
+		return httpserveutil.TooManyRequests(w, "%w, try again later", err)
+	case errors.Is(err, errTooManyJobs):
+		return httpserveutil.ServiceUnavailable(w, "%w, try again later", err)
+	default:
+		return httpserveutil.InternalError(w, "%w", err)
+	}
+}
+
+// sameOrigin reports whether a browser sent r from one of statsd's own pages.
+// Requests without the headers browsers add are not from a browser and are
+// let through.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return u.Host == r.Host
+}
+
+// serveRefreshPlayer asks the fetcher to refresh a player's results, then
+// sends the browser back to the player page.
+func (h *Handler) serveRefreshPlayer(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return httpserveutil.BadRequest(w, "method %s is not supported", r.Method)
+	}
+
+	if !sameOrigin(r) {
+		return httpserveutil.Forbidden(w, "cross-origin refresh requests are not allowed")
+	}
+
+	playerID, err := strconv.ParseUint(r.FormValue("playerid"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed playerID: %w", err)
+	}
+
+	job, err := h.enqueueRefresh(r.Context(), jobqueue.KindRefreshPlayer, playerID, time.Now())
+	if err != nil {
+		return writeRefreshError(w, err)
+	}
+
+	if r.FormValue("format") == "json" {
+		return httpserveutil.WriteJSON(w, http.StatusAccepted, job)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/player?playerid=%d", playerID), http.StatusSeeOther)
+
+	return nil
+}
+
+// serveRefreshMap asks the fetcher to refresh every zone of a map, then sends
+// the browser back to the map page it came from, or the index if the form did
+// not say which.
+func (h *Handler) serveRefreshMap(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return httpserveutil.BadRequest(w, "method %s is not supported", r.Method)
+	}
+
+	if !sameOrigin(r) {
+		return httpserveutil.Forbidden(w, "cross-origin refresh requests are not allowed")
+	}
+
+	mapID, err := strconv.ParseUint(r.FormValue("mapid"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed mapID: %w", err)
+	}
+
+	job, err := h.enqueueRefresh(r.Context(), jobqueue.KindRefreshMap, mapID, time.Now())
+	if err != nil {
+		return writeRefreshError(w, err)
+	}
+
+	if r.FormValue("format") == "json" {
+		return httpserveutil.WriteJSON(w, http.StatusAccepted, job)
+	}
+
+	location := "/"
+
+	playerID, err := strconv.ParseUint(r.FormValue("playerid"), 10, 64)
+	class := r.FormValue("class")
+
+	if err == nil && (class == "soldier" || class == "demoman") {
+		location = fmt.Sprintf("/map?playerid=%d&mapid=%d&class=%s", playerID, mapID, class)
+	}
+
+	http.Redirect(w, r, location, http.StatusSeeOther)
+
+	return nil
+}
+
+func (h *Handler) serveJob(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		return httpserveutil.BadRequest(w, "malformed job ID: %w", err)
+	}
+
+	job, err := h.jobs.Get(r.Context(), id)
+	if errors.Is(err, jobqueue.ErrNotFound) {
+		return httpserveutil.NotFound(w, "job %d not found", id)
+	}
+
+	if err != nil {
+		return httpserveutil.InternalError(w, "get job: %w", err)
+	}
+
+	return httpserveutil.WriteJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) Routes(logger *slog.Logger) map[string]http.Handler {
 	return map[string]http.Handler{
-		"/":               httpserveutil.Handle(out, h.serveIndexPage),
-		"/completions":    httpserveutil.Handle(out, h.serveCompletionsPage),
-		"/map":            httpserveutil.Handle(out, h.serveMapPage),
-		"/player/search":  httpserveutil.Handle(out, h.serveSearchPage),
-		"/player/results": httpserveutil.Handle(out, h.serveSearchResultsPage),
-		"/player":         httpserveutil.Handle(out, h.servePlayerPage),
-		"/results":        httpserveutil.Handle(out, h.serveResultsPage),
+		"/":               httpserveutil.Handle(logger, h.serveIndexPage),
+		"/completions":    httpserveutil.Handle(logger, h.serveCompletionsPage),
+		"/map":            httpserveutil.Handle(logger, h.serveMapPage),
+		"/player/search":  httpserveutil.Handle(logger, h.serveSearchPage),
+		"/player/results": httpserveutil.Handle(logger, h.serveSearchResultsPage),
+		"/player":         httpserveutil.Handle(logger, h.servePlayerPage),
+		"/results":        httpserveutil.Handle(logger, h.serveResultsPage),
+		"/history":        httpserveutil.Handle(logger, h.serveHistoryPage),
+		"/player/refresh": httpserveutil.Handle(logger, h.serveRefreshPlayer),
+		"/map/refresh":    httpserveutil.Handle(logger, h.serveRefreshMap),
+		"/job":            httpserveutil.Handle(logger, h.serveJob),
 	}
 }
 
@@ -1272,6 +1674,7 @@ type PageTemplates struct {
 	results       *template.Template
 	playerResults *template.Template
 	player        *template.Template
+	history       *template.Template
 }
 
 func parseTemplates() (PageTemplates, error) {
@@ -1333,6 +1736,13 @@ func parseTemplates() (PageTemplates, error) {
 			},
 			Add: func(t *template.Template) { pt.player = t },
 		},
+		{
+			Files: []string{
+				"static/templates/base.html",
+				"static/templates/pages/history.html",
+			},
+			Add: func(t *template.Template) { pt.history = t },
+		},
 	}
 
 	if err := templateutil.ParseFS(staticFS, groups); err != nil {
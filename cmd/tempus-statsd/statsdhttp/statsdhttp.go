@@ -43,3 +43,19 @@ type CompletionsResponse struct {
 type ResultsResponse struct {
 	Results []PlayerClassZoneResult `json:"results"`
 }
+
+type ResultHistory struct {
+	Rank     uint32 `json:"rank"`
+	Duration int64  `json:"duration"`
+	Date     int64  `json:"date"`
+	Observed int64  `json:"observed"`
+}
+
+type HistoryResponse struct {
+	PlayerID  uint64          `json:"player_id"`
+	MapID     uint64          `json:"map_id"`
+	ZoneType  string          `json:"zone_type"`
+	ZoneIndex uint8           `json:"zone_index"`
+	Class     uint8           `json:"class"`
+	History   []ResultHistory `json:"history"`
+}
@@ -0,0 +1,260 @@
+package httpcassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrInteractionNotFound = errors.New("interaction not found")
+
+type Mode uint8
+
+const (
+	ModeReplay Mode = iota
+	ModeRecord
+)
+
+// ModeFromEnv returns ModeRecord if HTTPCASSETTE_RECORD is set, so tests can
+// refresh their cassettes against the real API without code changes.
+func ModeFromEnv() Mode {
+	if os.Getenv("HTTPCASSETTE_RECORD") != "" {
+		return ModeRecord
+	}
+
+	return ModeReplay
+}
+
+// Interaction is a recorded response. JSON bodies are kept as JSON so that
+// cassettes stay readable and diffable.
+type Interaction struct {
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	StatusCode int             `json:"status_code"`
+	Header     http.Header     `json:"header,omitempty"`
+	JSON       json.RawMessage `json:"json,omitempty"`
+	Body       string          `json:"body,omitempty"`
+}
+
+func (i Interaction) key() string {
+	return i.Method + " " + i.Path
+}
+
+func (i Interaction) body() []byte {
+	if i.JSON != nil {
+		return i.JSON
+	}
+
+	return []byte(i.Body)
+}
+
+// Cassette is a set of interactions keyed by method and request path,
+// including the query string.
+type Cassette struct {
+	path string
+
+	mu           sync.Mutex
+	interactions map[string]Interaction
+	// used holds the keys added or looked up since the cassette was loaded.
+	used map[string]struct{}
+}
+
+// Load reads the cassette at path. A missing file is an empty cassette.
+func Load(path string) (*Cassette, error) {
+	c := &Cassette{
+		path:         path,
+		interactions: make(map[string]Interaction),
+		used:         make(map[string]struct{}),
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c, nil
+		}
+
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+
+	var interactions []Interaction
+
+	if err := json.Unmarshal(b, &interactions); err != nil {
+		return nil, fmt.Errorf("unmarshal cassette: %w", err)
+	}
+
+	for _, i := range interactions {
+		c.interactions[i.key()] = i
+	}
+
+	return c, nil
+}
+
+func (c *Cassette) Add(i Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions[i.key()] = i
+	c.used[i.key()] = struct{}{}
+}
+
+func (c *Cassette) Get(method, path string) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.interactions[method+" "+path]
+	if ok {
+		c.used[i.key()] = struct{}{}
+	}
+
+	return i, ok
+}
+
+// Save writes the cassette back to the path it was loaded from, ordered by
+// key so that re-recording only changes what changed. Interactions that were
+// neither added nor looked up since Load are dropped, so a re-recorded
+// cassette only holds what its test still requests.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+
+	interactions := make([]Interaction, 0, len(c.used))
+
+	for k := range c.used {
+		interactions = append(interactions, c.interactions[k])
+	}
+
+	c.mu.Unlock()
+
+	sort.Slice(interactions, func(i, j int) bool {
+		return interactions[i].key() < interactions[j].key()
+	})
+
+	b, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("create cassette directory: %w", err)
+	}
+
+	if err := os.WriteFile(c.path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+
+	return nil
+}
+
+// Transport is an http.RoundTripper that serves responses from a cassette,
+// or in record mode forwards requests to Next and adds the responses to it.
+type Transport struct {
+	Cassette *Cassette
+	Mode     Mode
+	Next     http.RoundTripper
+}
+
+func requestPath(req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return req.URL.Path
+	}
+
+	return req.URL.Path + "?" + req.URL.RawQuery
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := requestPath(req)
+
+	if t.Mode == ModeRecord {
+		return t.record(req, path)
+	}
+
+	i, ok := t.Cassette.Get(req.Method, path)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, path)
+	}
+
+	return response(req, i), nil
+}
+
+func (t *Transport) record(req *http.Request, path string) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	i := Interaction{
+		Method:     req.Method,
+		Path:       path,
+		StatusCode: res.StatusCode,
+		Header:     recordedHeader(res.Header),
+	}
+
+	if json.Valid(b) {
+		i.JSON = b
+	} else {
+		i.Body = string(b)
+	}
+
+	t.Cassette.Add(i)
+
+	return response(req, i), nil
+}
+
+// recordedHeader keeps the headers that affect how a client treats a
+// response, dropping volatile ones like Date.
+func recordedHeader(h http.Header) http.Header {
+	kept := make(http.Header)
+
+	for _, k := range []string{"Content-Type", "ETag", "Last-Modified", "Retry-After"} {
+		if v := h.Values(k); len(v) != 0 {
+			kept[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil
+	}
+
+	return kept
+}
+
+func response(req *http.Request, i Interaction) *http.Response {
+	b := i.body()
+
+	header := i.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.StatusCode, strings.TrimSpace(http.StatusText(i.StatusCode))),
+		StatusCode:    i.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,162 @@
+package httpcassette_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"tempus-completion/httpcassette"
+	"testing"
+)
+
+func TestTransportRecordReplay(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("ETag", `"v1"`)
+			io.WriteString(w, `{"id": 439, "name": "jump_cow"}`)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	cassette, err := httpcassette.Load(path)
+	if err != nil {
+		t.Fatalf("load cassette: %s", err)
+	}
+
+	recorder := http.Client{
+		Transport: &httpcassette.Transport{
+			Cassette: cassette,
+			Mode:     httpcassette.ModeRecord,
+		},
+	}
+
+	for _, p := range []string{"/json?limit=0", "/missing"} {
+		res, err := recorder.Get(ts.URL + p)
+		if err != nil {
+			t.Fatalf("record %s: %s", p, err)
+		}
+
+		res.Body.Close()
+	}
+
+	if err := cassette.Save(); err != nil {
+		t.Fatalf("save cassette: %s", err)
+	}
+
+	ts.Close()
+
+	cassette, err = httpcassette.Load(path)
+	if err != nil {
+		t.Fatalf("load cassette: %s", err)
+	}
+
+	replayer := http.Client{
+		Transport: &httpcassette.Transport{
+			Cassette: cassette,
+			Mode:     httpcassette.ModeReplay,
+		},
+	}
+
+	res, err := replayer.Get("http://tempus.invalid/json?limit=0")
+	if err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+
+	var body struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&body)
+	res.Body.Close()
+
+	if err != nil {
+		t.Fatalf("decode body: %s", err)
+	}
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") != `"v1"` || body.ID != 439 || body.Name != "jump_cow" {
+		t.Fatalf("replayed response malformed: %d %v %+v", res.StatusCode, res.Header, body)
+	}
+
+	res, err = replayer.Get("http://tempus.invalid/missing")
+	if err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected recorded 404, got %d", res.StatusCode)
+	}
+
+	if _, err := replayer.Get("http://tempus.invalid/json"); !errors.Is(err, httpcassette.ErrInteractionNotFound) {
+		t.Fatalf("expected interaction not found, got %v", err)
+	}
+}
+
+func TestRecordPrunesUnusedInteractions(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"path": "`+r.URL.Path+`"}`)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	record := func(paths ...string) *httpcassette.Cassette {
+		t.Helper()
+
+		cassette, err := httpcassette.Load(path)
+		if err != nil {
+			t.Fatalf("load cassette: %s", err)
+		}
+
+		recorder := http.Client{
+			Transport: &httpcassette.Transport{
+				Cassette: cassette,
+				Mode:     httpcassette.ModeRecord,
+			},
+		}
+
+		for _, p := range paths {
+			res, err := recorder.Get(ts.URL + p)
+			if err != nil {
+				t.Fatalf("record %s: %s", p, err)
+			}
+
+			res.Body.Close()
+		}
+
+		if err := cassette.Save(); err != nil {
+			t.Fatalf("save cassette: %s", err)
+		}
+
+		return cassette
+	}
+
+	record("/old", "/kept")
+	record("/kept", "/new")
+
+	cassette, err := httpcassette.Load(path)
+	if err != nil {
+		t.Fatalf("load cassette: %s", err)
+	}
+
+	for p, want := range map[string]bool{"/old": false, "/kept": true, "/new": true} {
+		if _, ok := cassette.Get(http.MethodGet, p); ok != want {
+			t.Fatalf("expected %s in the re-recorded cassette to be %t, got %t", p, want, ok)
+		}
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"tempus-completion/logutil"
 	"time"
 )
 
@@ -19,6 +20,18 @@ func NotFound(w http.ResponseWriter, format string, a ...any) error {
 	return writeError(w, http.StatusNotFound, format, a...)
 }
 
+func Forbidden(w http.ResponseWriter, format string, a ...any) error {
+	return writeError(w, http.StatusForbidden, format, a...)
+}
+
+func TooManyRequests(w http.ResponseWriter, format string, a ...any) error {
+	return writeError(w, http.StatusTooManyRequests, format, a...)
+}
+
+func ServiceUnavailable(w http.ResponseWriter, format string, a ...any) error {
+	return writeError(w, http.StatusServiceUnavailable, format, a...)
+}
+
 func writeError(w http.ResponseWriter, code int, format string, a ...any) error {
 	err := fmt.Errorf(format, a...)
 	http.Error(w, err.Error(), code)
@@ -47,8 +60,21 @@ func (rec *statusRecorder) WriteHeader(status int) {
 
 type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request) error
 
-func Handle(out io.Writer, f ErrorHandlerFunc) http.HandlerFunc {
+// Handle logs every request with its route, status and latency. Each request
+// gets an ID, taken from the request if it has one, which is added to the
+// records logged with the request's context and echoed in the response.
+func Handle(logger *slog.Logger, f ErrorHandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logutil.RequestIDHeader)
+		if id == "" {
+			id = logutil.NewRequestID()
+		}
+
+		w.Header().Set(logutil.RequestIDHeader, id)
+
+		ctx := logutil.WithRequestID(r.Context(), id)
+		r = r.WithContext(ctx)
+
 		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
 
 		start := time.Now()
@@ -60,12 +86,27 @@ func Handle(out io.Writer, f ErrorHandlerFunc) http.HandlerFunc {
 			remoteaddr = r.RemoteAddr
 		}
 
+		attrs := []slog.Attr{
+			slog.String("route", r.Pattern),
+			slog.String("method", r.Method),
+			slog.String("uri", r.RequestURI),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", elapsed),
+			slog.String("remote_addr", remoteaddr),
+		}
+
+		level := slog.LevelInfo
+
 		if err != nil {
-			fmt.Fprintf(out, "%s %s %s %s %d %s %s\n", start, remoteaddr, r.Method, r.RequestURI, rec.status, elapsed, err)
-			return
+			attrs = append(attrs, slog.String("error", err.Error()))
+			level = slog.LevelWarn
+
+			if rec.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
 		}
 
-		fmt.Fprintf(out, "%s %s %s %s %d %s\n", start, remoteaddr, r.Method, r.RequestURI, rec.status, elapsed)
+		logger.LogAttrs(ctx, level, "request", attrs...)
 	}
 }
 
@@ -82,8 +123,9 @@ func WriteJSON(w http.ResponseWriter, status int, data any) error {
 	return nil
 }
 
-func NewServer(addr string, mux http.Handler, tlsconf *tls.Config) *Server {
+func NewServer(addr string, mux http.Handler, tlsconf *tls.Config, logger *slog.Logger) *Server {
 	return &Server{
+		logger: logger,
 		Server: &http.Server{
 			Addr:              addr,
 			Handler:           mux,
@@ -99,6 +141,7 @@ func NewServer(addr string, mux http.Handler, tlsconf *tls.Config) *Server {
 
 type Server struct {
 	*http.Server
+	logger *slog.Logger
 }
 
 func (s *Server) Shutdown() error {
@@ -116,21 +159,19 @@ func (s *Server) Shutdown() error {
 }
 
 func (s *Server) Run(context.Context) error {
-	fmt.Printf("listening on tcp at %s\n", s.Addr)
-
 	listener, err := net.Listen("tcp", s.Addr)
 	if err != nil {
 		return fmt.Errorf("listen: %w", err)
 	}
 
 	if s.Server.TLSConfig != nil {
-		fmt.Printf("serving HTTPS at %s\n", listener.Addr())
+		s.logger.Info("serving https", "address", listener.Addr().String())
 
 		if err := s.Server.ServeTLS(listener, "", ""); err != http.ErrServerClosed {
 			return fmt.Errorf("serve tls: %w", err)
 		}
 	} else {
-		fmt.Printf("serving HTTP at %s\n", listener.Addr())
+		s.logger.Info("serving http", "address", listener.Addr().String())
 
 		if err := s.Server.Serve(listener); err != http.ErrServerClosed {
 			return fmt.Errorf("serve: %w", err)
@@ -141,16 +182,16 @@ func (s *Server) Run(context.Context) error {
 }
 
 type Router interface {
-	Routes(out io.Writer) map[string]http.Handler
+	Routes(logger *slog.Logger) map[string]http.Handler
 }
 
 type Mux interface {
 	Handle(path string, handler http.Handler)
 }
 
-func Register(mux Mux, out io.Writer, routers ...Router) {
+func Register(mux Mux, logger *slog.Logger, routers ...Router) {
 	for _, router := range routers {
-		routes := router.Routes(out)
+		routes := router.Routes(logger)
 
 		for path, handler := range routes {
 			mux.Handle(path, handler)
@@ -0,0 +1,254 @@
+// Package jobqueue passes work from statsd to the fetcher. Jobs are claimed
+// with a lease, so a job whose worker disappears becomes available again once
+// the lease runs out.
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	// KindRefreshPlayer refreshes a player's results on every zone.
+	KindRefreshPlayer Kind = "refresh_player"
+	// KindRefreshMap refreshes every zone of a map.
+	KindRefreshMap Kind = "refresh_map"
+)
+
+type State string
+
+const (
+	StatePending State = "pending"
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+)
+
+// MaxAttempts is how many times a job is claimed before it is failed.
+const MaxAttempts = 3
+
+var (
+	ErrNotFound = errors.New("job not found")
+	// ErrLeaseExpired is the error of a job whose last attempt ran out of
+	// lease without completing.
+	ErrLeaseExpired = errors.New("lease expired")
+)
+
+type Job struct {
+	ID       uint64 `json:"id"`
+	Kind     Kind   `json:"kind"`
+	Target   uint64 `json:"target"`
+	State    State  `json:"state"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+
+	Created time.Time `json:"created"`
+	// Available is when a pending job may be claimed, or when the lease of
+	// a running job runs out.
+	Available time.Time `json:"available"`
+	Finished  time.Time `json:"finished"`
+}
+
+type Queue interface {
+	// Enqueue adds a job, or returns the pending or running job with the
+	// same kind and target.
+	Enqueue(ctx context.Context, kind Kind, target uint64, now time.Time) (Job, error)
+	// Claim leases the job that has been available the longest, reporting
+	// false if there is none. Running jobs whose lease ran out after
+	// MaxAttempts attempts are failed instead of claimed again.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (Job, bool, error)
+	// Complete records the outcome of a claimed job. A failed job is
+	// retried later until it has been attempted MaxAttempts times. Jobs
+	// claimed again since are left alone.
+	Complete(ctx context.Context, job Job, now time.Time, jobErr error) error
+	Get(ctx context.Context, id uint64) (Job, error)
+	// Latest returns the last job enqueued with the kind and target,
+	// reporting false if there is none.
+	Latest(ctx context.Context, kind Kind, target uint64) (Job, bool, error)
+	// Pending counts the jobs that are pending or running.
+	Pending(ctx context.Context) (int, error)
+}
+
+// RetryDelay is how long a failed job waits before it is retried.
+func RetryDelay(attempts int) time.Duration {
+	return time.Duration(attempts) * time.Minute
+}
+
+// Finish applies the outcome of a job to it.
+func Finish(job Job, now time.Time, jobErr error) Job {
+	switch {
+	case jobErr == nil:
+		job.State = StateDone
+		job.Error = ""
+		job.Finished = now
+	case job.Attempts >= MaxAttempts:
+		job.State = StateFailed
+		job.Error = jobErr.Error()
+		job.Finished = now
+	default:
+		job.State = StatePending
+		job.Error = jobErr.Error()
+		job.Available = now.Add(RetryDelay(job.Attempts))
+	}
+
+	return job
+}
+
+// expired reports whether job is running on its final attempt and its lease
+// ran out.
+func expired(job Job, now time.Time) bool {
+	return job.State == StateRunning && job.Attempts >= MaxAttempts && !job.Available.After(now)
+}
+
+// Memory is a Queue that lives in memory.
+type Memory struct {
+	mu     sync.Mutex
+	jobs   map[uint64]Job
+	nextID uint64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		jobs:   make(map[uint64]Job),
+		nextID: 1,
+	}
+}
+
+func (m *Memory) Enqueue(ctx context.Context, kind Kind, target uint64, now time.Time) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.Kind == kind && job.Target == target && (job.State == StatePending || job.State == StateRunning) {
+			return job, nil
+		}
+	}
+
+	job := Job{
+		ID:        m.nextID,
+		Kind:      kind,
+		Target:    target,
+		State:     StatePending,
+		Created:   now,
+		Available: now,
+	}
+
+	m.jobs[job.ID] = job
+	m.nextID++
+
+	return job, nil
+}
+
+func (m *Memory) Claim(ctx context.Context, now time.Time, lease time.Duration) (Job, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	available := make([]Job, 0, len(m.jobs))
+
+	for _, job := range m.jobs {
+		if job.State != StatePending && job.State != StateRunning {
+			continue
+		}
+
+		if job.Available.After(now) {
+			continue
+		}
+
+		if expired(job, now) {
+			m.jobs[job.ID] = Finish(job, now, ErrLeaseExpired)
+			continue
+		}
+
+		available = append(available, job)
+	}
+
+	if len(available) == 0 {
+		return Job{}, false, nil
+	}
+
+	sort.Slice(available, func(i, j int) bool {
+		if !available[i].Available.Equal(available[j].Available) {
+			return available[i].Available.Before(available[j].Available)
+		}
+
+		return available[i].ID < available[j].ID
+	})
+
+	job := available[0]
+	job.State = StateRunning
+	job.Attempts++
+	job.Available = now.Add(lease)
+
+	m.jobs[job.ID] = job
+
+	return job, true, nil
+}
+
+func (m *Memory) Complete(ctx context.Context, job Job, now time.Time, jobErr error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.jobs[job.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if current.State != StateRunning || current.Attempts != job.Attempts {
+		return nil
+	}
+
+	m.jobs[job.ID] = Finish(current, now, jobErr)
+
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, id uint64) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	return job, nil
+}
+
+func (m *Memory) Latest(ctx context.Context, kind Kind, target uint64) (Job, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var (
+		latest Job
+		found  bool
+	)
+
+	for _, job := range m.jobs {
+		if job.Kind == kind && job.Target == target && job.ID > latest.ID {
+			latest = job
+			found = true
+		}
+	}
+
+	return latest, found, nil
+}
+
+func (m *Memory) Pending(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int
+
+	for _, job := range m.jobs {
+		if job.State == StatePending || job.State == StateRunning {
+			n++
+		}
+	}
+
+	return n, nil
+}
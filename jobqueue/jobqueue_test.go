@@ -0,0 +1,167 @@
+package jobqueue_test
+
+import (
+	"context"
+	"errors"
+	"tempus-completion/jobqueue"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	lease := 10 * time.Minute
+
+	q := jobqueue.NewMemory()
+
+	player, err := q.Enqueue(ctx, jobqueue.KindRefreshPlayer, 59983, now)
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	again, err := q.Enqueue(ctx, jobqueue.KindRefreshPlayer, 59983, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	if again.ID != player.ID {
+		t.Fatalf("expected the pending job %d to be reused, got %d", player.ID, again.ID)
+	}
+
+	if _, err := q.Enqueue(ctx, jobqueue.KindRefreshMap, 439, now.Add(time.Second)); err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	job, ok, err := q.Claim(ctx, now.Add(time.Second), lease)
+	if err != nil || !ok {
+		t.Fatalf("claim: %v %v", ok, err)
+	}
+
+	if job.ID != player.ID || job.State != jobqueue.StateRunning || job.Attempts != 1 {
+		t.Fatalf("expected to claim the player job, got %+v", job)
+	}
+
+	// the lease runs out and another worker takes over
+	stale := job
+
+	job, ok, _ = q.Claim(ctx, now.Add(2*time.Second), lease)
+	if !ok || job.Kind != jobqueue.KindRefreshMap {
+		t.Fatalf("expected to claim the map job, got %+v", job)
+	}
+
+	if err := q.Complete(ctx, job, now.Add(time.Minute), nil); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+
+	if _, ok, _ := q.Claim(ctx, now.Add(time.Minute), lease); ok {
+		t.Fatalf("expected the player job to still be leased")
+	}
+
+	job, ok, _ = q.Claim(ctx, now.Add(lease+time.Second), lease)
+	if !ok || job.ID != player.ID || job.Attempts != 2 {
+		t.Fatalf("expected to reclaim the player job, got %+v", job)
+	}
+
+	if err := q.Complete(ctx, stale, now.Add(lease+time.Minute), nil); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+
+	if got, _ := q.Get(ctx, player.ID); got.State != jobqueue.StateRunning {
+		t.Fatalf("expected a stale completion to be ignored, got %+v", got)
+	}
+
+	failed := errors.New("tempus unavailable")
+
+	if err := q.Complete(ctx, job, now.Add(lease+time.Minute), failed); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+
+	job, _ = q.Get(ctx, player.ID)
+	if job.State != jobqueue.StatePending || job.Error != failed.Error() {
+		t.Fatalf("expected the player job to be retried, got %+v", job)
+	}
+
+	job, ok, _ = q.Claim(ctx, job.Available, lease)
+	if !ok || job.Attempts != jobqueue.MaxAttempts {
+		t.Fatalf("expected the final attempt, got %+v", job)
+	}
+
+	if err := q.Complete(ctx, job, job.Available, failed); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+
+	if job, _ = q.Get(ctx, player.ID); job.State != jobqueue.StateFailed {
+		t.Fatalf("expected the player job to fail, got %+v", job)
+	}
+
+	if _, err := q.Get(ctx, 100); !errors.Is(err, jobqueue.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestMemoryExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	lease := 10 * time.Minute
+
+	q := jobqueue.NewMemory()
+
+	job, err := q.Enqueue(ctx, jobqueue.KindRefreshPlayer, 59983, now)
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	// every attempt runs out of lease without completing
+	for attempt := 1; attempt <= jobqueue.MaxAttempts; attempt++ {
+		claimed, ok, _ := q.Claim(ctx, now, lease)
+		if !ok || claimed.Attempts != attempt {
+			t.Fatalf("expected attempt %d, got %+v", attempt, claimed)
+		}
+
+		now = claimed.Available
+	}
+
+	if _, ok, _ := q.Claim(ctx, now, lease); ok {
+		t.Fatalf("expected the job not to be claimed after %d attempts", jobqueue.MaxAttempts)
+	}
+
+	job, _ = q.Get(ctx, job.ID)
+	if job.State != jobqueue.StateFailed || job.Error != jobqueue.ErrLeaseExpired.Error() || job.Attempts != jobqueue.MaxAttempts {
+		t.Fatalf("expected the job to fail, got %+v", job)
+	}
+}
+
+func TestMemoryLatestAndPending(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	q := jobqueue.NewMemory()
+
+	if _, ok, _ := q.Latest(ctx, jobqueue.KindRefreshMap, 439); ok {
+		t.Fatalf("expected no job for the map yet")
+	}
+
+	first, _ := q.Enqueue(ctx, jobqueue.KindRefreshMap, 439, now)
+	q.Enqueue(ctx, jobqueue.KindRefreshPlayer, 59983, now)
+
+	if n, _ := q.Pending(ctx); n != 2 {
+		t.Fatalf("expected 2 pending jobs, got %d", n)
+	}
+
+	job, _, _ := q.Claim(ctx, now, time.Minute)
+	q.Complete(ctx, job, now, nil)
+
+	second, _ := q.Enqueue(ctx, jobqueue.KindRefreshMap, 439, now)
+	if second.ID == first.ID {
+		t.Fatalf("expected a new job once the first is done")
+	}
+
+	if latest, ok, _ := q.Latest(ctx, jobqueue.KindRefreshMap, 439); !ok || latest.ID != second.ID {
+		t.Fatalf("expected the latest job to be %d, got %+v", second.ID, latest)
+	}
+
+	if n, _ := q.Pending(ctx); n != 2 {
+		t.Fatalf("expected 2 pending jobs, got %d", n)
+	}
+}
@@ -0,0 +1,99 @@
+// Package logutil sets up the structured logging shared by the binaries.
+//
+// Fields carried by a context, such as a request ID or the fetcher's
+// iteration, are added to every record logged with that context.
+package logutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// RequestIDHeader is read from incoming requests and echoed in responses.
+const RequestIDHeader = "X-Request-ID"
+
+// New returns a logger writing to w in the given format, text or json, that
+// drops records below level, one of debug, info, warn or error.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var l slog.Level
+
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("parse level: %w", err)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: l,
+	}
+
+	var h slog.Handler
+
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("log format '%s' is not supported", format)
+	}
+
+	return slog.New(contextHandler{Handler: h}), nil
+}
+
+type attrsKey struct{}
+
+// With returns a copy of ctx carrying the fields in args, given as alternating
+// keys and values or slog.Attr, in addition to those ctx already carries.
+func With(ctx context.Context, args ...any) context.Context {
+	prev, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+
+	r := slog.Record{}
+	r.Add(args...)
+
+	attrs := make([]slog.Attr, 0, len(prev)+r.NumAttrs())
+	attrs = append(attrs, prev...)
+
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// WithRequestID returns a copy of ctx whose records carry a request_id field.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return With(ctx, "request_id", id)
+}
+
+// NewRequestID returns a random ID for a request that did not come with one.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
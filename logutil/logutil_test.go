@@ -0,0 +1,53 @@
+package logutil_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"tempus-completion/logutil"
+	"testing"
+)
+
+func TestContextFields(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := logutil.New(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("new logger: %s", err)
+	}
+
+	ctx := logutil.WithRequestID(context.Background(), "abc")
+	ctx = logutil.With(ctx, "player_id", 59983)
+
+	logger.DebugContext(ctx, "dropped")
+	logger.With("route", "/player").InfoContext(ctx, "request", "status", 200)
+
+	var record map[string]any
+
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single json record, got %q: %s", buf.String(), err)
+	}
+
+	expected := map[string]any{
+		"msg":        "request",
+		"level":      "INFO",
+		"request_id": "abc",
+		"player_id":  float64(59983),
+		"route":      "/player",
+		"status":     float64(200),
+	}
+
+	for k, v := range expected {
+		if record[k] != v {
+			t.Fatalf("expected %s to be %v, got %v", k, v, record[k])
+		}
+	}
+
+	if _, err := logutil.New(&buf, "xml", "info"); err == nil {
+		t.Fatalf("expected an unsupported format to fail")
+	}
+
+	if _, err := logutil.New(&buf, "text", "loud"); err == nil {
+		t.Fatalf("expected an unknown level to fail")
+	}
+}
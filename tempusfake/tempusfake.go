@@ -0,0 +1,577 @@
+// Package tempusfake serves the parts of the Tempus v0 API used by
+// tempushttprpc from an in-memory World.
+package tempusfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"tempus-completion/tempushttp"
+	"time"
+)
+
+type Server struct {
+	world *World
+	mux   *http.ServeMux
+}
+
+// NewServer returns a handler for the API rooted at "/", so the client address
+// is the server's URL with no /api/v0 suffix.
+func NewServer(w *World) *Server {
+	s := &Server{
+		world: w,
+		mux:   http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /maps/detailedList", s.detailedMapList)
+	s.mux.HandleFunc("GET /maps/id/{id}/zones/typeindex/{type}/{index}/records/list", s.zoneRecords)
+	s.mux.HandleFunc("GET /maps/name/{name}/zones/typeindex/{type}/{index}/records/player/{player}/{class}", s.playerZoneClassCompletion)
+	s.mux.HandleFunc("GET /players/id/{id}/info", s.playerInfo)
+	s.mux.HandleFunc("GET /players/id/{id}/stats", s.playerStats)
+	s.mux.HandleFunc("GET /players/id/{id}/records/list", s.playerRecords)
+	s.mux.HandleFunc("GET /search/playersAndMaps/{name}", s.search)
+	s.mux.HandleFunc("POST /fake/records", s.addRecord)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) detailedMapList(w http.ResponseWriter, r *http.Request) {
+	s.world.mu.RLock()
+	defer s.world.mu.RUnlock()
+
+	etag := fmt.Sprintf(`"%d"`, s.world.version)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response := make(tempushttp.GetDetailedMapListResponse, 0, len(s.world.maps))
+
+	for _, m := range s.world.maps {
+		item := tempushttp.DetailedMapListMap{
+			ID:      int(m.ID),
+			Name:    m.Name,
+			Authors: make([]tempushttp.DetailedMapListAuthor, 0, len(m.Authors)),
+		}
+
+		for i, a := range m.Authors {
+			item.Authors = append(item.Authors, tempushttp.DetailedMapListAuthor{
+				MapID: int(m.ID),
+				Name:  a,
+				ID:    i + 1,
+			})
+		}
+
+		for _, z := range m.Zones {
+			switch z.Type {
+			case tempushttp.ZoneTypeMap:
+				item.ZoneCounts.Map++
+				item.ZoneCounts.MapEnd++
+				item.TierInfo.Soldier = z.Tiers.Soldier
+				item.TierInfo.Demoman = z.Tiers.Demoman
+			case tempushttp.ZoneTypeCourse:
+				item.ZoneCounts.Course++
+				item.ZoneCounts.CourseEnd++
+			case tempushttp.ZoneTypeBonus:
+				item.ZoneCounts.Bonus++
+				item.ZoneCounts.BonusEnd++
+			case tempushttp.ZoneTypeTrick:
+				item.ZoneCounts.Trick++
+			}
+		}
+
+		response = append(response, item)
+	}
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].ID < response[j].ID
+	})
+
+	w.Header().Set("ETag", etag)
+	writeJSON(w, response)
+}
+
+func (s *Server) zoneRecords(w http.ResponseWriter, r *http.Request) {
+	mapID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid map id", http.StatusBadRequest)
+		return
+	}
+
+	zoneIndex, err := strconv.ParseUint(r.PathValue("index"), 10, 8)
+	if err != nil {
+		http.Error(w, "invalid zone index", http.StatusBadRequest)
+		return
+	}
+
+	start, limit, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.world.mu.RLock()
+	defer s.world.mu.RUnlock()
+
+	z, err := s.world.zone(mapID, tempushttp.ZoneType(r.PathValue("type")), uint8(zoneIndex))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	soldier := z.ranked(tempushttp.ClassTypeSoldier)
+	demoman := z.ranked(tempushttp.ClassTypeDemoman)
+
+	response := tempushttp.ZoneRecordsResponse{
+		ZoneInfo: s.zoneInfo(z),
+		TierInfo: z.Tiers,
+		CompletionInfo: tempushttp.CompletionInfo{
+			Soldier: len(soldier),
+			Demoman: len(demoman),
+		},
+		Results: tempushttp.ZoneRecordsResults{
+			Soldier: s.results(z, soldier, start, limit),
+			Demoman: s.results(z, demoman, start, limit),
+		},
+	}
+
+	writeJSON(w, response)
+}
+
+// parsePage reads the 1-based start rank and the page size, where a limit of
+// zero means every record.
+func parsePage(r *http.Request) (int, int, error) {
+	start, limit := 1, 0
+
+	if v := r.URL.Query().Get("start"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid start %q", v)
+		}
+
+		start = n
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q", v)
+		}
+
+		limit = n
+	}
+
+	return start, limit, nil
+}
+
+func (s *Server) results(z *Zone, records []Record, start, limit int) []tempushttp.CompletionResult {
+	results := []tempushttp.CompletionResult{}
+
+	for i := start - 1; i < len(records); i++ {
+		if limit > 0 && len(results) == limit {
+			break
+		}
+
+		results = append(results, s.result(z, records[i], i+1))
+	}
+
+	return results
+}
+
+func (s *Server) result(z *Zone, record Record, rank int) tempushttp.CompletionResult {
+	p := s.world.players[record.PlayerID]
+
+	return tempushttp.CompletionResult{
+		ZoneID: int(z.ID),
+		Class:  int(record.Class),
+		DemoInfo: tempushttp.PlayerZoneClassCompletionDemoInfo{
+			ID: int(record.DemoID),
+			ServerInfo: tempushttp.PlayerZoneClassCompletionServerInfo{
+				ID:   1,
+				Name: "tempusfake",
+			},
+		},
+		UserID:  int(p.ID),
+		SteamID: p.SteamID,
+		PlayerInfo: tempushttp.PlayerZoneClassCompletionPlayerInfo{
+			ID:      int(p.ID),
+			Steamid: p.SteamID,
+			Name:    p.Name,
+		},
+		ID:       int(record.ID),
+		Duration: record.Duration.Seconds(),
+		Date:     float64(record.Date.UnixMilli()) / 1000,
+		Name:     p.Name,
+		Rank:     rank,
+	}
+}
+
+func (s *Server) zoneInfo(z *Zone) tempushttp.ZoneInfo {
+	return tempushttp.ZoneInfo{
+		ID:         int(z.ID),
+		MapID:      z.MapID,
+		Zoneindex:  int(z.Index),
+		CustomName: z.CustomName,
+		Type:       string(z.Type),
+	}
+}
+
+func (s *Server) playerZoneClassCompletion(w http.ResponseWriter, r *http.Request) {
+	zoneIndex, err := strconv.ParseUint(r.PathValue("index"), 10, 8)
+	if err != nil {
+		http.Error(w, "invalid zone index", http.StatusBadRequest)
+		return
+	}
+
+	playerID, err := strconv.ParseUint(r.PathValue("player"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid player id", http.StatusBadRequest)
+		return
+	}
+
+	class, err := strconv.ParseUint(r.PathValue("class"), 10, 8)
+	if err != nil {
+		http.Error(w, "invalid class", http.StatusBadRequest)
+		return
+	}
+
+	s.world.mu.RLock()
+	defer s.world.mu.RUnlock()
+
+	m, ok := s.world.mapByName(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "map not found", http.StatusNotFound)
+		return
+	}
+
+	z, err := s.world.zone(m.ID, tempushttp.ZoneType(r.PathValue("type")), uint8(zoneIndex))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if _, ok := s.world.players[playerID]; !ok {
+		http.Error(w, "player not found", http.StatusNotFound)
+		return
+	}
+
+	// the real API sends a null result when the player has not completed the
+	// zone, which the shared response type cannot express
+	var response struct {
+		ZoneInfo       tempushttp.ZoneInfo          `json:"zone_info"`
+		TierInfo       tempushttp.TierInfo          `json:"tier_info"`
+		CompletionInfo tempushttp.CompletionInfo    `json:"completion_info"`
+		Result         *tempushttp.CompletionResult `json:"result"`
+	}
+
+	response.ZoneInfo = s.zoneInfo(z)
+	response.TierInfo = z.Tiers
+	response.CompletionInfo = tempushttp.CompletionInfo{
+		Soldier: len(z.records[tempushttp.ClassTypeSoldier]),
+		Demoman: len(z.records[tempushttp.ClassTypeDemoman]),
+	}
+
+	for i, record := range z.ranked(tempushttp.ClassType(class)) {
+		if record.PlayerID == playerID {
+			result := s.result(z, record, i+1)
+			response.Result = &result
+
+			break
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+func (s *Server) playerInfo(w http.ResponseWriter, r *http.Request) {
+	playerID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid player id", http.StatusBadRequest)
+		return
+	}
+
+	s.world.mu.RLock()
+	defer s.world.mu.RUnlock()
+
+	p, ok := s.world.players[playerID]
+	if !ok {
+		http.Error(w, "player not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, tempushttp.PlayerInfoResponse{
+		ID:          p.ID,
+		SteamID:     p.SteamID,
+		Name:        p.Name,
+		FirstSeen:   float64(p.FirstSeen.Unix()),
+		LastSeen:    float64(p.LastSeen.Unix()),
+		Country:     p.Country,
+		CountryCode: p.CountryCode,
+	})
+}
+
+// playerRecords lists a player's runs, newest first, optionally of one class
+// or zone type.
+func (s *Server) playerRecords(w http.ResponseWriter, r *http.Request) {
+	playerID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid player id", http.StatusBadRequest)
+		return
+	}
+
+	start, limit, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var class tempushttp.ClassType
+
+	if v := r.URL.Query().Get("class"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			http.Error(w, "invalid class", http.StatusBadRequest)
+			return
+		}
+
+		class = tempushttp.ClassType(n)
+	}
+
+	zoneType := tempushttp.ZoneType(r.URL.Query().Get("zone_type"))
+
+	s.world.mu.RLock()
+	defer s.world.mu.RUnlock()
+
+	p, ok := s.world.players[playerID]
+	if !ok {
+		http.Error(w, "player not found", http.StatusNotFound)
+		return
+	}
+
+	records := []tempushttp.PlayerRecord{}
+
+	for _, m := range s.world.maps {
+		for _, z := range m.Zones {
+			if zoneType != "" && z.Type != zoneType {
+				continue
+			}
+
+			for _, c := range []tempushttp.ClassType{tempushttp.ClassTypeSoldier, tempushttp.ClassTypeDemoman} {
+				if class != 0 && c != class {
+					continue
+				}
+
+				for i, record := range z.ranked(c) {
+					if record.PlayerID != playerID {
+						continue
+					}
+
+					records = append(records, tempushttp.PlayerRecord{
+						RecordInfo: tempushttp.RecordInfo{
+							ID:       record.ID,
+							ZoneID:   z.ID,
+							UserID:   p.ID,
+							Class:    uint8(c),
+							Duration: record.Duration.Seconds(),
+							Date:     float64(record.Date.UnixMilli()) / 1000,
+							DemoID:   record.DemoID,
+							ServerID: 1,
+							Rank:     uint32(i + 1),
+						},
+						MapInfo: tempushttp.MapInfo{
+							ID:        m.ID,
+							Name:      m.Name,
+							DateAdded: float64(m.DateAdded.Unix()),
+						},
+						ZoneInfo: s.zoneInfo(z),
+						TierInfo: z.Tiers,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].RecordInfo.Date != records[j].RecordInfo.Date {
+			return records[i].RecordInfo.Date > records[j].RecordInfo.Date
+		}
+
+		return records[i].RecordInfo.ID > records[j].RecordInfo.ID
+	})
+
+	records = records[min(start-1, len(records)):]
+
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+
+	writeJSON(w, tempushttp.PlayerRecordsResponse{
+		PlayerInfo: tempushttp.RecordPlayerInfo{
+			ID:      p.ID,
+			SteamID: p.SteamID,
+			Name:    p.Name,
+		},
+		Records: records,
+	})
+}
+
+func (s *Server) playerStats(w http.ResponseWriter, r *http.Request) {
+	playerID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid player id", http.StatusBadRequest)
+		return
+	}
+
+	s.world.mu.RLock()
+	defer s.world.mu.RUnlock()
+
+	p, ok := s.world.players[playerID]
+	if !ok {
+		http.Error(w, "player not found", http.StatusNotFound)
+		return
+	}
+
+	response := tempushttp.GetPlayerStatsResponse{
+		PlayerInfo: tempushttp.PlayerStatsPlayerInfo{
+			ID:          p.ID,
+			SteamID:     p.SteamID,
+			Name:        p.Name,
+			FirstSeen:   float64(p.FirstSeen.Unix()),
+			LastSeen:    float64(p.LastSeen.Unix()),
+			Country:     p.Country,
+			CountryCode: p.CountryCode,
+		},
+	}
+
+	for _, m := range s.world.maps {
+		for _, z := range m.Zones {
+			switch z.Type {
+			case tempushttp.ZoneTypeMap:
+				response.ZoneCount.Map++
+			case tempushttp.ZoneTypeCourse:
+				response.ZoneCount.Course++
+			case tempushttp.ZoneTypeBonus:
+				response.ZoneCount.Bonus++
+			case tempushttp.ZoneTypeTrick:
+				response.ZoneCount.Trick++
+			}
+
+			for _, class := range []tempushttp.ClassType{tempushttp.ClassTypeSoldier, tempushttp.ClassTypeDemoman} {
+				for i, record := range z.ranked(class) {
+					if record.PlayerID != p.ID {
+						continue
+					}
+
+					addZoneStat(&response.PRStats, class, z.Type)
+
+					if i == 0 {
+						addZoneStat(&response.WRStats, class, z.Type)
+					}
+
+					if i < 10 {
+						addZoneStat(&response.TopStats, class, z.Type)
+					}
+				}
+			}
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+func addZoneStat(stats *tempushttp.PlayerStatsClassZoneStats, class tempushttp.ClassType, zoneType tempushttp.ZoneType) {
+	zoneStats := &stats.Soldier
+	if class == tempushttp.ClassTypeDemoman {
+		zoneStats = &stats.Demoman
+	}
+
+	switch zoneType {
+	case tempushttp.ZoneTypeMap:
+		zoneStats.Map.Count++
+	case tempushttp.ZoneTypeCourse:
+		zoneStats.Course.Count++
+	case tempushttp.ZoneTypeBonus:
+		zoneStats.Bonus.Count++
+	case tempushttp.ZoneTypeTrick:
+		zoneStats.Trick.Count++
+	}
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(r.PathValue("name"))
+
+	s.world.mu.RLock()
+	defer s.world.mu.RUnlock()
+
+	response := tempushttp.PlayersAndMapsSearchResponse{
+		Players: []tempushttp.PlayersAndMapsSearchPlayer{},
+		Maps:    []tempushttp.PlayersAndMapsSearchMap{},
+	}
+
+	for _, p := range s.world.players {
+		if strings.Contains(strings.ToLower(p.Name), name) {
+			response.Players = append(response.Players, tempushttp.PlayersAndMapsSearchPlayer{
+				SteamID: p.SteamID,
+				ID:      p.ID,
+				Name:    p.Name,
+			})
+		}
+	}
+
+	for _, m := range s.world.maps {
+		if strings.Contains(strings.ToLower(m.Name), name) {
+			response.Maps = append(response.Maps, tempushttp.PlayersAndMapsSearchMap{
+				ID:   m.ID,
+				Name: m.Name,
+			})
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+type AddRecordRequest struct {
+	MapID     uint64               `json:"map_id"`
+	ZoneType  tempushttp.ZoneType  `json:"zone_type"`
+	ZoneIndex uint8                `json:"zone_index"`
+	PlayerID  uint64               `json:"player_id"`
+	Class     tempushttp.ClassType `json:"class"`
+	Duration  float64              `json:"duration"`
+}
+
+// addRecord is not part of the Tempus API; it lets a developer submit runs to a
+// running fake.
+func (s *Server) addRecord(w http.ResponseWriter, r *http.Request) {
+	var request AddRecordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("decode request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	duration := time.Duration(request.Duration * float64(time.Second))
+
+	improved, err := s.world.AddRecord(request.MapID, request.ZoneType, request.ZoneIndex, request.PlayerID, request.Class, duration, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]bool{"improved": improved})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,219 @@
+package tempusfake_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"tempus-completion/tempusfake"
+	"tempus-completion/tempushttp"
+	"tempus-completion/tempushttprpc"
+	"testing"
+	"time"
+)
+
+func newFakeClient(t *testing.T) (*tempusfake.World, *tempushttprpc.Client) {
+	world := tempusfake.NewWorld()
+
+	if err := world.Seed(); err != nil {
+		t.Fatalf("seed world: %s", err)
+	}
+
+	ts := httptest.NewServer(tempusfake.NewServer(world))
+	t.Cleanup(ts.Close)
+
+	c := tempushttprpc.NewClient(
+		http.Client{},
+		ts.URL,
+		tempushttprpc.WithRetryPolicy(tempushttprpc.NoRetryPolicy),
+		tempushttprpc.WithCache(tempushttprpc.NewMemoryCache()),
+	)
+
+	return world, c
+}
+
+func fakeContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+func TestDetailedMapList(t *testing.T) {
+	world, c := newFakeClient(t)
+	ctx := fakeContext(t)
+
+	response, err := c.GetDetailedMapList(ctx)
+	if err != nil {
+		t.Fatalf("get detailed map list: %s", err)
+	}
+
+	if len(response) != 2 {
+		t.Fatalf("expected 2 maps, got %d", len(response))
+	}
+
+	if _, modified, err := c.GetDetailedMapListIfModified(ctx); err != nil {
+		t.Fatalf("get detailed map list if modified: %s", err)
+	} else if modified {
+		t.Fatalf("expected map list to be unmodified")
+	}
+
+	world.AddMap(1000, "jump_new")
+
+	response, modified, err := c.GetDetailedMapListIfModified(ctx)
+	if err != nil {
+		t.Fatalf("get detailed map list if modified: %s", err)
+	}
+
+	if !modified || len(response) != 3 {
+		t.Fatalf("expected modified map list with 3 maps, got %t with %d", modified, len(response))
+	}
+}
+
+func TestZoneRecordsAddRecord(t *testing.T) {
+	world, c := newFakeClient(t)
+	ctx := fakeContext(t)
+
+	response, err := c.GetZoneRecords(ctx, 439, tempushttp.ZoneTypeMap, 1, 0)
+	if err != nil {
+		t.Fatalf("get zone records: %s", err)
+	}
+
+	if len(response.Results.Soldier) != 3 {
+		t.Fatalf("expected 3 soldier results, got %d", len(response.Results.Soldier))
+	}
+
+	improved, err := world.AddRecord(439, tempushttp.ZoneTypeMap, 1, 59983, tempushttp.ClassTypeSoldier, 30*time.Second, time.Unix(1730000000, 0))
+	if err != nil {
+		t.Fatalf("add record: %s", err)
+	}
+
+	if !improved {
+		t.Fatalf("expected record to improve")
+	}
+
+	response, err = c.GetZoneRecords(ctx, 439, tempushttp.ZoneTypeMap, 1, 0)
+	if err != nil {
+		t.Fatalf("get zone records: %s", err)
+	}
+
+	if len(response.Results.Soldier) != 3 {
+		t.Fatalf("expected 3 soldier results, got %d", len(response.Results.Soldier))
+	}
+
+	first := response.Results.Soldier[0]
+
+	if first.UserID != 59983 || first.Rank != 1 || first.Duration != 30 {
+		t.Fatalf("expected new world record, got %+v", first)
+	}
+
+	completion, err := c.GetPlayerZoneClassCompletion(ctx, tempushttprpc.GetPlayerZoneClassCompletionData{
+		MapName:   "jump_cow",
+		ZoneType:  tempushttp.ZoneTypeMap,
+		ZoneIndex: 1,
+		PlayerID:  59983,
+		Class:     tempushttp.ClassTypeSoldier,
+	})
+	if err != nil {
+		t.Fatalf("get player zone class completion: %s", err)
+	}
+
+	if completion.Result.ID != first.ID {
+		t.Fatalf("expected completion %d, got %d", first.ID, completion.Result.ID)
+	}
+}
+
+func TestPlayerStatsAndSearch(t *testing.T) {
+	_, c := newFakeClient(t)
+	ctx := fakeContext(t)
+
+	stats, err := c.GetPlayerStats(ctx, 1207)
+	if err != nil {
+		t.Fatalf("get player stats: %s", err)
+	}
+
+	if stats.WRStats.Soldier.Map.Count != 2 || stats.WRStats.Soldier.Course.Count != 1 {
+		t.Fatalf("unexpected wr stats %+v", stats.WRStats.Soldier)
+	}
+
+	if _, err := c.GetPlayerStats(ctx, 1); !errors.Is(err, tempushttprpc.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	info, err := c.GetPlayerInfo(ctx, 3817)
+	if err != nil {
+		t.Fatalf("get player info: %s", err)
+	}
+
+	if info.Name != "nolem" {
+		t.Fatalf("unexpected player info %+v", info)
+	}
+
+	search, err := c.SearchPlayersAndMaps(ctx, "cow")
+	if err != nil {
+		t.Fatalf("search: %s", err)
+	}
+
+	if len(search.Maps) != 1 || search.Maps[0].ID != 439 {
+		t.Fatalf("unexpected search result %+v", search)
+	}
+}
+
+func TestAddZoneAfterRemoval(t *testing.T) {
+	world := tempusfake.NewWorld()
+	world.AddMap(1000, "jump_new")
+
+	for range 3 {
+		if _, err := world.AddZone(1000, tempushttp.ZoneTypeBonus, "", 2, 2); err != nil {
+			t.Fatalf("add zone: %s", err)
+		}
+	}
+
+	if err := world.RemoveZone(1000, tempushttp.ZoneTypeBonus, 2); err != nil {
+		t.Fatalf("remove zone: %s", err)
+	}
+
+	z, err := world.AddZone(1000, tempushttp.ZoneTypeBonus, "", 2, 2)
+	if err != nil {
+		t.Fatalf("add zone: %s", err)
+	}
+
+	if z.Index != 4 {
+		t.Fatalf("expected the zone after bonus 3 to be bonus 4, got %d", z.Index)
+	}
+}
+
+func TestPlayerRecordPages(t *testing.T) {
+	world, c := newFakeClient(t)
+	ctx := fakeContext(t)
+
+	if improved, err := world.AddRecord(439, tempushttp.ZoneTypeBonus, 1, 59983, tempushttp.ClassTypeDemoman, 11*time.Second, time.Now()); err != nil || !improved {
+		t.Fatalf("add record: %v %v", improved, err)
+	}
+
+	var records []tempushttp.PlayerRecord
+
+	for response, err := range c.PlayerRecordPages(ctx, 59983, tempushttp.ClassTypeDemoman, 1) {
+		if err != nil {
+			t.Fatalf("player record pages: %s", err)
+		}
+
+		records = append(records, response.Records...)
+	}
+
+	if len(records) == 0 {
+		t.Fatalf("expected demoman records")
+	}
+
+	first := records[0]
+
+	if first.ZoneInfo.MapID != 439 || first.ZoneInfo.Type != string(tempushttp.ZoneTypeBonus) || first.ZoneInfo.Zoneindex != 1 {
+		t.Fatalf("expected the newest record first, got %+v", first)
+	}
+
+	for _, r := range records {
+		if r.RecordInfo.Class != uint8(tempushttp.ClassTypeDemoman) || r.RecordInfo.UserID != 59983 {
+			t.Fatalf("expected only the player's demoman records, got %+v", r.RecordInfo)
+		}
+	}
+}
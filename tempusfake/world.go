@@ -0,0 +1,355 @@
+package tempusfake
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"tempus-completion/tempushttp"
+	"time"
+)
+
+type Player struct {
+	ID          uint64
+	SteamID     string
+	Name        string
+	Country     string
+	CountryCode string
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+type Record struct {
+	ID       uint64
+	PlayerID uint64
+	Class    tempushttp.ClassType
+	Duration time.Duration
+	Date     time.Time
+	DemoID   uint64
+}
+
+type Zone struct {
+	ID         uint64
+	MapID      uint64
+	Type       tempushttp.ZoneType
+	Index      uint8
+	CustomName string
+	Tiers      tempushttp.TierInfo
+
+	// records holds each player's best run, per class
+	records map[tempushttp.ClassType]map[uint64]Record
+}
+
+type Map struct {
+	ID        uint64
+	Name      string
+	DateAdded time.Time
+	Authors   []string
+	Zones     []*Zone
+}
+
+// World is the mutable state served by the fake API. All of its methods are
+// safe for concurrent use.
+type World struct {
+	mu sync.RWMutex
+
+	maps    map[uint64]*Map
+	players map[uint64]*Player
+
+	nextZoneID   uint64
+	nextRecordID uint64
+
+	// version changes whenever the map list does, and is used as its ETag
+	version uint64
+}
+
+func NewWorld() *World {
+	return &World{
+		maps:         make(map[uint64]*Map),
+		players:      make(map[uint64]*Player),
+		nextZoneID:   1,
+		nextRecordID: 1,
+		version:      1,
+	}
+}
+
+func (w *World) AddMap(id uint64, name string, authors ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.maps[id] = &Map{
+		ID:        id,
+		Name:      name,
+		DateAdded: time.Unix(1482627600, 0),
+		Authors:   authors,
+	}
+
+	w.version++
+}
+
+func (w *World) RemoveMap(id uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.maps, id)
+
+	w.version++
+}
+
+func (w *World) RenameMap(id uint64, name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	m, ok := w.maps[id]
+	if !ok {
+		return fmt.Errorf("map %d does not exist", id)
+	}
+
+	m.Name = name
+
+	w.version++
+
+	return nil
+}
+
+// AddZone adds a zone to a map. It gets the index after the highest of the
+// map's zones of the same type, starting at 1.
+func (w *World) AddZone(mapID uint64, zoneType tempushttp.ZoneType, customName string, soldierTier, demomanTier int) (*Zone, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	m, ok := w.maps[mapID]
+	if !ok {
+		return nil, fmt.Errorf("map %d does not exist", mapID)
+	}
+
+	var index uint8 = 1
+
+	for _, z := range m.Zones {
+		if z.Type == zoneType && z.Index >= index {
+			index = z.Index + 1
+		}
+	}
+
+	z := &Zone{
+		ID:         w.nextZoneID,
+		MapID:      mapID,
+		Type:       zoneType,
+		Index:      index,
+		CustomName: customName,
+		Tiers: tempushttp.TierInfo{
+			Soldier: soldierTier,
+			Demoman: demomanTier,
+		},
+		records: make(map[tempushttp.ClassType]map[uint64]Record),
+	}
+
+	w.nextZoneID++
+
+	m.Zones = append(m.Zones, z)
+
+	w.version++
+
+	return z, nil
+}
+
+func (w *World) RemoveZone(mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	m, ok := w.maps[mapID]
+	if !ok {
+		return fmt.Errorf("map %d does not exist", mapID)
+	}
+
+	for i, z := range m.Zones {
+		if z.Type == zoneType && z.Index == zoneIndex {
+			m.Zones = append(m.Zones[:i], m.Zones[i+1:]...)
+			w.version++
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("zone %s %d does not exist on map %d", zoneType, zoneIndex, mapID)
+}
+
+func (w *World) SetZoneTiers(mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, soldierTier, demomanTier int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	z, err := w.zone(mapID, zoneType, zoneIndex)
+	if err != nil {
+		return err
+	}
+
+	z.Tiers = tempushttp.TierInfo{
+		Soldier: soldierTier,
+		Demoman: demomanTier,
+	}
+
+	w.version++
+
+	return nil
+}
+
+func (w *World) AddPlayer(p Player) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.players[p.ID] = &p
+}
+
+// AddRecord submits a run. Like the real API, only a player's best run on a
+// zone is kept; it reports whether the run was an improvement.
+func (w *World) AddRecord(mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, playerID uint64, class tempushttp.ClassType, duration time.Duration, date time.Time) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	z, err := w.zone(mapID, zoneType, zoneIndex)
+	if err != nil {
+		return false, err
+	}
+
+	p, ok := w.players[playerID]
+	if !ok {
+		return false, fmt.Errorf("player %d does not exist", playerID)
+	}
+
+	records, ok := z.records[class]
+	if !ok {
+		records = make(map[uint64]Record)
+		z.records[class] = records
+	}
+
+	if r, ok := records[playerID]; ok && r.Duration <= duration {
+		return false, nil
+	}
+
+	records[playerID] = Record{
+		ID:       w.nextRecordID,
+		PlayerID: playerID,
+		Class:    class,
+		Duration: duration,
+		Date:     date,
+		DemoID:   w.nextRecordID + 1000000,
+	}
+
+	w.nextRecordID++
+
+	if date.After(p.LastSeen) {
+		p.LastSeen = date
+	}
+
+	return true, nil
+}
+
+func (w *World) zone(mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8) (*Zone, error) {
+	m, ok := w.maps[mapID]
+	if !ok {
+		return nil, fmt.Errorf("map %d does not exist", mapID)
+	}
+
+	for _, z := range m.Zones {
+		if z.Type == zoneType && z.Index == zoneIndex {
+			return z, nil
+		}
+	}
+
+	return nil, fmt.Errorf("zone %s %d does not exist on map %d", zoneType, zoneIndex, mapID)
+}
+
+func (w *World) mapByName(name string) (*Map, bool) {
+	for _, m := range w.maps {
+		if m.Name == name {
+			return m, true
+		}
+	}
+
+	return nil, false
+}
+
+// ranked returns a zone's records for a class, fastest first.
+func (z *Zone) ranked(class tempushttp.ClassType) []Record {
+	records := make([]Record, 0, len(z.records[class]))
+
+	for _, r := range z.records[class] {
+		records = append(records, r)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Duration != records[j].Duration {
+			return records[i].Duration < records[j].Duration
+		}
+
+		return records[i].ID < records[j].ID
+	})
+
+	return records
+}
+
+// Seed fills the world with a few maps, players and runs, enough to exercise
+// both binaries locally.
+func (w *World) Seed() error {
+	players := []Player{
+		{ID: 59983, SteamID: "STEAM_0:0:29372477", Name: "a hedgehog", Country: "United States", CountryCode: "US"},
+		{ID: 1207, SteamID: "STEAM_0:1:21380541", Name: "Boshy", Country: "Canada", CountryCode: "CA"},
+		{ID: 3817, SteamID: "STEAM_0:0:40213221", Name: "nolem", Country: "Germany", CountryCode: "DE"},
+	}
+
+	for _, p := range players {
+		p.FirstSeen = time.Unix(1546150812, 0)
+		p.LastSeen = p.FirstSeen
+		w.AddPlayer(p)
+	}
+
+	w.AddMap(439, "jump_cow", "Jacko")
+	w.AddMap(712, "jump_sync_a2", "Waldo")
+
+	zones := []struct {
+		mapID      uint64
+		zoneType   tempushttp.ZoneType
+		customName string
+		soldier    int
+		demoman    int
+	}{
+		{mapID: 439, zoneType: tempushttp.ZoneTypeMap, soldier: 2, demoman: 2},
+		{mapID: 439, zoneType: tempushttp.ZoneTypeBonus, customName: "the roof", soldier: 1, demoman: 1},
+		{mapID: 712, zoneType: tempushttp.ZoneTypeMap, soldier: 5, demoman: 4},
+		{mapID: 712, zoneType: tempushttp.ZoneTypeCourse, customName: "stage 1", soldier: 4, demoman: 3},
+		{mapID: 712, zoneType: tempushttp.ZoneTypeCourse, customName: "stage 2", soldier: 5, demoman: 4},
+		{mapID: 712, zoneType: tempushttp.ZoneTypeTrick, customName: "skip", soldier: 0, demoman: 0},
+	}
+
+	for _, z := range zones {
+		if _, err := w.AddZone(z.mapID, z.zoneType, z.customName, z.soldier, z.demoman); err != nil {
+			return fmt.Errorf("add zone: %w", err)
+		}
+	}
+
+	records := []struct {
+		mapID     uint64
+		zoneType  tempushttp.ZoneType
+		zoneIndex uint8
+		playerID  uint64
+		class     tempushttp.ClassType
+		duration  time.Duration
+		date      int64
+	}{
+		{439, tempushttp.ZoneTypeMap, 1, 1207, tempushttp.ClassTypeSoldier, 41040 * time.Millisecond, 1668712410},
+		{439, tempushttp.ZoneTypeMap, 1, 3817, tempushttp.ClassTypeSoldier, 44870 * time.Millisecond, 1679021122},
+		{439, tempushttp.ZoneTypeMap, 1, 59983, tempushttp.ClassTypeSoldier, 145725 * time.Millisecond, 1702860794},
+		{439, tempushttp.ZoneTypeMap, 1, 3817, tempushttp.ClassTypeDemoman, 33975 * time.Millisecond, 1651004221},
+		{439, tempushttp.ZoneTypeBonus, 1, 59983, tempushttp.ClassTypeSoldier, 12345 * time.Millisecond, 1703299411},
+		{712, tempushttp.ZoneTypeMap, 1, 1207, tempushttp.ClassTypeSoldier, 88120 * time.Millisecond, 1729790011},
+		{712, tempushttp.ZoneTypeCourse, 1, 1207, tempushttp.ClassTypeSoldier, 20500 * time.Millisecond, 1729780011},
+		{712, tempushttp.ZoneTypeCourse, 2, 3817, tempushttp.ClassTypeDemoman, 14110 * time.Millisecond, 1729781020},
+	}
+
+	for _, r := range records {
+		if _, err := w.AddRecord(r.mapID, r.zoneType, r.zoneIndex, r.playerID, r.class, r.duration, time.Unix(r.date, 0)); err != nil {
+			return fmt.Errorf("add record: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -166,9 +166,200 @@ type PlayerStatsClassRankInfo struct {
 	Demoman PlayerStatsClassRankInfoClass `json:"4"`
 }
 
-// TODO: parse more
+type PlayerStatsCountryRankInfo struct {
+	Points      float64 `json:"points"`
+	Rank        uint32  `json:"rank"`
+	TotalRanked uint32  `json:"total_ranked"`
+}
+
+type PlayerStatsCountryClassRankInfo struct {
+	Soldier PlayerStatsCountryRankInfo `json:"3"`
+	Demoman PlayerStatsCountryRankInfo `json:"4"`
+}
+
+type PlayerStatsZoneStat struct {
+	Count  uint32  `json:"count"`
+	Points float64 `json:"points"`
+}
+
+type PlayerStatsZoneStats struct {
+	Map    PlayerStatsZoneStat `json:"map"`
+	Course PlayerStatsZoneStat `json:"course"`
+	Bonus  PlayerStatsZoneStat `json:"bonus"`
+	Trick  PlayerStatsZoneStat `json:"trick"`
+}
+
+type PlayerStatsClassZoneStats struct {
+	Soldier PlayerStatsZoneStats `json:"3"`
+	Demoman PlayerStatsZoneStats `json:"4"`
+}
+
+type PlayerStatsZoneCount struct {
+	Map    uint32 `json:"map"`
+	Course uint32 `json:"course"`
+	Bonus  uint32 `json:"bonus"`
+	Trick  uint32 `json:"trick"`
+}
+
 type GetPlayerStatsResponse struct {
-	PlayerInfo      PlayerStatsPlayerInfo      `json:"player_info"`
-	OverallRankInfo PlayerStatsOverallRankInfo `json:"rank_info"`
-	ClassRankInfo   PlayerStatsClassRankInfo   `json:"class_rank_info"`
+	PlayerInfo           PlayerStatsPlayerInfo           `json:"player_info"`
+	OverallRankInfo      PlayerStatsOverallRankInfo      `json:"rank_info"`
+	ClassRankInfo        PlayerStatsClassRankInfo        `json:"class_rank_info"`
+	CountryRankInfo      PlayerStatsCountryRankInfo      `json:"country_rank_info"`
+	CountryClassRankInfo PlayerStatsCountryClassRankInfo `json:"country_class_rank_info"`
+	PRStats              PlayerStatsClassZoneStats       `json:"pr_stats"`
+	WRStats              PlayerStatsClassZoneStats       `json:"wr_stats"`
+	TopStats             PlayerStatsClassZoneStats       `json:"top_stats"`
+	ZoneCount            PlayerStatsZoneCount            `json:"zone_count"`
+}
+
+type PlayerInfoResponse struct {
+	ID          uint64  `json:"id"`
+	SteamID     string  `json:"steamid"`
+	Name        string  `json:"name"`
+	FirstSeen   float64 `json:"first_seen"`
+	LastSeen    float64 `json:"last_seen"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"country_code"`
+}
+
+type MapInfo struct {
+	ID        uint64  `json:"id"`
+	Name      string  `json:"name"`
+	DateAdded float64 `json:"date_added"`
+}
+
+type MapZones struct {
+	Bonus      []ZoneInfo `json:"bonus"`
+	BonusEnd   []ZoneInfo `json:"bonus_end"`
+	Checkpoint []ZoneInfo `json:"checkpoint"`
+	Course     []ZoneInfo `json:"course"`
+	CourseEnd  []ZoneInfo `json:"course_end"`
+	Linear     []ZoneInfo `json:"linear"`
+	Map        []ZoneInfo `json:"map"`
+	MapEnd     []ZoneInfo `json:"map_end"`
+	Misc       []ZoneInfo `json:"misc"`
+	Special    []ZoneInfo `json:"special"`
+	Trick      []ZoneInfo `json:"trick"`
+}
+
+type MapOverviewResponse struct {
+	MapInfo     MapInfo                   `json:"map_info"`
+	ZoneCounts  DetailedMapListZoneCounts `json:"zone_counts"`
+	Zones       MapZones                  `json:"zones"`
+	Authors     []DetailedMapListAuthor   `json:"authors"`
+	TierInfo    TierInfo                  `json:"tier_info"`
+	Videos      DetailedMapListVideos     `json:"videos"`
+	SoldierRuns []CompletionResult        `json:"soldier_runs"`
+	DemomanRuns []CompletionResult        `json:"demoman_runs"`
+}
+
+type RecordInfo struct {
+	ID       uint64  `json:"id"`
+	ZoneID   uint64  `json:"zone_id"`
+	UserID   uint64  `json:"user_id"`
+	Class    uint8   `json:"class"`
+	Duration float64 `json:"duration"`
+	Date     float64 `json:"date"`
+	DemoID   uint64  `json:"demo_id"`
+	ServerID uint64  `json:"server_id"`
+	Rank     uint32  `json:"rank"`
+}
+
+type RecordPlayerInfo struct {
+	ID      uint64 `json:"id"`
+	SteamID string `json:"steamid"`
+	Name    string `json:"name"`
+}
+
+type PlayerRecord struct {
+	RecordInfo RecordInfo `json:"record_info"`
+	MapInfo    MapInfo    `json:"map_info"`
+	ZoneInfo   ZoneInfo   `json:"zone_info"`
+	TierInfo   TierInfo   `json:"tier_info"`
+}
+
+type PlayerRecordsResponse struct {
+	PlayerInfo RecordPlayerInfo `json:"player_info"`
+	Records    []PlayerRecord   `json:"records"`
+}
+
+type Activity struct {
+	RecordInfo RecordInfo       `json:"record_info"`
+	PlayerInfo RecordPlayerInfo `json:"player_info"`
+	MapInfo    MapInfo          `json:"map_info"`
+	ZoneInfo   ZoneInfo         `json:"zone_info"`
+}
+
+type ActivityResponse struct {
+	MapWRs    []Activity `json:"map_wrs"`
+	CourseWRs []Activity `json:"course_wrs"`
+	BonusWRs  []Activity `json:"bonus_wrs"`
+	MapTops   []Activity `json:"map_tops"`
+}
+
+type RankedPlayer struct {
+	Rank        uint32  `json:"rank"`
+	Points      float64 `json:"points"`
+	ID          uint64  `json:"id"`
+	SteamID     string  `json:"steamid"`
+	Name        string  `json:"name"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"country_code"`
+}
+
+type RanksResponse struct {
+	Count   uint32         `json:"count"`
+	Players []RankedPlayer `json:"players"`
+}
+
+type ServerInfo struct {
+	ID        uint64 `json:"id"`
+	Name      string `json:"name"`
+	Shortname string `json:"shortname"`
+	Addr      string `json:"addr"`
+	Port      uint16 `json:"port"`
+	Country   string `json:"country"`
+	Hidden    bool   `json:"hidden"`
+}
+
+type ServerGameUser struct {
+	ID      uint64 `json:"id"`
+	SteamID string `json:"steamid"`
+	Name    string `json:"name"`
+}
+
+type ServerGameInfo struct {
+	CurrentMap  string           `json:"currentMap"`
+	NextMap     string           `json:"nextMap"`
+	PlayerCount uint32           `json:"playerCount"`
+	MaxPlayers  uint32           `json:"maxPlayers"`
+	Users       []ServerGameUser `json:"users"`
+	Timestamp   float64          `json:"timestamp"`
+}
+
+type ServerStatus struct {
+	ServerInfo ServerInfo     `json:"server_info"`
+	GameInfo   ServerGameInfo `json:"game_info"`
+}
+
+type ServerStatusListResponse []ServerStatus
+
+type DemoInfo struct {
+	ID         uint64  `json:"id"`
+	ServerID   uint64  `json:"server_id"`
+	Date       float64 `json:"date"`
+	URL        string  `json:"url"`
+	Mapname    string  `json:"mapname"`
+	Filename   string  `json:"filename"`
+	Deleted    bool    `json:"deleted"`
+	Recording  bool    `json:"recording"`
+	Requested  bool    `json:"requested"`
+	Expired    bool    `json:"expired"`
+	UploaderID uint64  `json:"uploader_id"`
+}
+
+type DemoOverviewResponse struct {
+	DemoInfo   DemoInfo   `json:"demo_info"`
+	ServerInfo ServerInfo `json:"server_info"`
 }
@@ -0,0 +1,122 @@
+package tempushttprpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheEntry is a response body along with the validators needed to make a
+// conditional request for it.
+type CacheEntry struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	Body         []byte `json:"body"`
+}
+
+// Cache stores responses for endpoints that support conditional requests.
+type Cache interface {
+	Get(key string) (CacheEntry, bool, error)
+	Set(key string, entry CacheEntry) error
+}
+
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: make(map[string]CacheEntry),
+	}
+}
+
+func (c *MemoryCache) Get(key string) (CacheEntry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+
+	return entry, ok, nil
+}
+
+func (c *MemoryCache) Set(key string, entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = entry
+
+	return nil
+}
+
+// DiskCache keeps one file per entry, so cached responses survive restarts.
+type DiskCache struct {
+	dir string
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *DiskCache) Get(key string) (CacheEntry, bool, error) {
+	var entry CacheEntry
+
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return entry, false, nil
+		}
+
+		return entry, false, fmt.Errorf("read entry: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return entry, false, fmt.Errorf("unmarshal entry: %w", err)
+	}
+
+	return entry, true, nil
+}
+
+func (c *DiskCache) Set(key string, entry CacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %w", err)
+	}
+
+	f, err := os.CreateTemp(c.dir, "entry-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("write entry: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close entry: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("rename entry: %w", err)
+	}
+
+	return nil
+}
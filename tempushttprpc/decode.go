@@ -0,0 +1,185 @@
+package tempushttprpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type DecodeMode uint8
+
+const (
+	// DecodeStrict fails any response that has fields the models do not.
+	DecodeStrict DecodeMode = iota
+	// DecodeLenient ignores unknown fields, reporting them to the client's
+	// UnknownFieldsFunc if it has one.
+	DecodeLenient
+)
+
+// UnknownFieldsFunc receives the paths of response fields that are not
+// modelled in tempushttp, e.g. "results.soldier[].demo_info.foo".
+type UnknownFieldsFunc func(endpoint string, paths []string)
+
+func (c *Client) decode(endpoint string, b []byte, response any) error {
+	strict := json.NewDecoder(bytes.NewReader(b))
+	strict.DisallowUnknownFields()
+
+	err := strict.Decode(response)
+	if err == nil {
+		return nil
+	}
+
+	if c.decodeMode == DecodeStrict {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	// the strict attempt may have partially filled in the response
+	v := reflect.ValueOf(response).Elem()
+	v.SetZero()
+
+	if err := json.Unmarshal(b, response); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	if c.onUnknownFields == nil {
+		return nil
+	}
+
+	paths, err := unknownFields(b, v.Type())
+	if err != nil {
+		return fmt.Errorf("find unknown fields: %w", err)
+	}
+
+	if len(paths) != 0 {
+		c.onUnknownFields(endpoint, paths)
+	}
+
+	return nil
+}
+
+func unknownFields(b []byte, t reflect.Type) ([]string, error) {
+	var v any
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	found := make(map[string]struct{})
+	walkUnknownFields(v, t, "", found)
+
+	paths := make([]string, 0, len(found))
+
+	for p := range found {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func walkUnknownFields(v any, t reflect.Type, path string, found map[string]struct{}) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+
+			for k, fv := range v {
+				p := joinPath(path, k)
+
+				ft, ok := lookupField(fields, k)
+				if !ok {
+					found[p] = struct{}{}
+					continue
+				}
+
+				walkUnknownFields(fv, ft, p, found)
+			}
+		case reflect.Map:
+			for k, fv := range v {
+				walkUnknownFields(fv, t.Elem(), joinPath(path, k), found)
+			}
+		}
+	case []any:
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+			for _, e := range v {
+				walkUnknownFields(e, t.Elem(), path+"[]", found)
+			}
+		}
+	}
+}
+
+func joinPath(path, k string) string {
+	if path == "" {
+		return k
+	}
+
+	return path + "." + k
+}
+
+// lookupField matches a key to a field the way encoding/json does, preferring
+// an exact match and falling back to a case-insensitive one.
+func lookupField(fields map[string]reflect.Type, k string) (reflect.Type, bool) {
+	if t, ok := fields[k]; ok {
+		return t, true
+	}
+
+	for name, t := range fields {
+		if strings.EqualFold(name, k) {
+			return t, true
+		}
+	}
+
+	return nil, false
+}
+
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					fields[k] = v
+				}
+
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields[name] = f.Type
+	}
+
+	return fields
+}
@@ -0,0 +1,60 @@
+package tempushttprpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RequestInfo describes a single attempt at a request to the Tempus API.
+type RequestInfo struct {
+	Endpoint string
+	Path     string
+	Attempt  int
+
+	// StatusCode is zero when no response was received, in which case Err
+	// is set.
+	StatusCode int
+	Duration   time.Duration
+	Bytes      int
+	Err        error
+}
+
+// ObserverFunc is called after every attempt at a request, including retries,
+// with the request's context. It is called from the requesting goroutine, so
+// it should not block.
+type ObserverFunc func(ctx context.Context, info RequestInfo)
+
+// WithObserver adds f to the functions called after every attempt at a
+// request.
+func WithObserver(f ObserverFunc) Option {
+	return func(c *Client) {
+		c.observers = append(c.observers, f)
+	}
+}
+
+func (c *Client) observe(ctx context.Context, info RequestInfo) {
+	for _, f := range c.observers {
+		f(ctx, info)
+	}
+}
+
+// LogObserver logs every attempt at a request.
+func LogObserver(logger *slog.Logger) ObserverFunc {
+	return func(ctx context.Context, info RequestInfo) {
+		attrs := []slog.Attr{
+			slog.String("endpoint", info.Endpoint),
+			slog.String("path", info.Path),
+			slog.Int("attempt", info.Attempt),
+			slog.Int("status", info.StatusCode),
+			slog.Int("bytes", info.Bytes),
+			slog.Duration("latency", info.Duration),
+		}
+
+		if info.Err != nil {
+			attrs = append(attrs, slog.String("error", info.Err.Error()))
+		}
+
+		logger.LogAttrs(ctx, slog.LevelInfo, "tempus request", attrs...)
+	}
+}
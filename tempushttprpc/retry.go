@@ -0,0 +1,107 @@
+package tempushttprpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how the client retries requests that fail with a
+// transient error. Only timeouts, dropped or refused connections, truncated
+// responses, rate limiting and gateway/server unavailability are retried;
+// every request the client makes is a GET, so all of them are safe to repeat.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+var NoRetryPolicy = RetryPolicy{
+	MaxAttempts: 1,
+}
+
+// delay returns how long to wait before the next attempt, using full jitter
+// over an exponentially growing window. A Retry-After hint from the server
+// takes precedence; false is returned if it exceeds MaxDelay.
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > 0 {
+		if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+			return 0, false
+		}
+
+		return retryAfter, true
+	}
+
+	window := p.BaseDelay << (attempt - 1)
+	if window <= 0 || (p.MaxDelay > 0 && window > p.MaxDelay) {
+		window = p.MaxDelay
+	}
+
+	if window <= 0 {
+		return 0, true
+	}
+
+	return rand.N(window), true
+}
+
+func isTemporary(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerUnavailable)
+}
+
+// isTransportTemporary reports whether a failure to make a request or read its
+// response is worth retrying. Timeouts, dropped and refused connections and
+// truncated responses are; a malformed URL, an unsupported scheme or a failed
+// TLS handshake fail the same way every time.
+func isTransportTemporary(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1,134 +1,454 @@
 package tempushttprpc
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
+	"net/url"
 	"tempus-completion/tempushttp"
+	"time"
 )
 
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrServerUnavailable = errors.New("server unavailable")
+)
+
+// APIError is returned when the Tempus API responds with a non-200 status.
+// It unwraps to one of the sentinel errors when the status maps onto one.
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s", e.Endpoint, e.StatusCode, e.Body)
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrServerUnavailable
+	default:
+		return nil
+	}
+}
+
+const maxErrorBodySize = 512
+
+func newAPIError(endpoint string, res *http.Response, body []byte) *APIError {
+	if len(body) > maxErrorBodySize {
+		body = body[:maxErrorBodySize]
+	}
+
+	return &APIError{
+		StatusCode: res.StatusCode,
+		Endpoint:   endpoint,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(res.Header, time.Now()),
+	}
+}
+
 type Client struct {
-	address string
-	httpc   http.Client
+	address  string
+	httpc    http.Client
+	retry    RetryPolicy
+	limiter  *limiter
+	inflight semaphore
+	cache    Cache
+
+	decodeMode      DecodeMode
+	onUnknownFields UnknownFieldsFunc
+
+	observers []ObserverFunc
+}
+
+type Option func(c *Client)
+
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// WithRateLimit limits the client to rps requests per second, allowing short
+// bursts of up to burst requests. Retries count against the limit.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *Client) {
+		if rps <= 0 {
+			c.limiter = nil
+			return
+		}
+
+		c.limiter = newLimiter(rps, burst)
+	}
 }
 
-func NewClient(httpc http.Client, address string) *Client {
+// WithMaxConcurrency limits the number of requests the client has in flight.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Client) {
+		if n <= 0 {
+			c.inflight = nil
+			return
+		}
+
+		c.inflight = make(semaphore, n)
+	}
+}
+
+// WithCache enables conditional requests for endpoints that support them,
+// keeping the last response and its validators in cache.
+func WithCache(cache Cache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+func WithDecodeMode(mode DecodeMode) Option {
+	return func(c *Client) {
+		c.decodeMode = mode
+	}
+}
+
+// WithUnknownFieldsFunc sets the function that unknown response fields are
+// reported to in lenient decode mode.
+func WithUnknownFieldsFunc(f UnknownFieldsFunc) Option {
+	return func(c *Client) {
+		c.onUnknownFields = f
+	}
+}
+
+func NewClient(httpc http.Client, address string, opts ...Option) *Client {
 	if address == "" {
 		address = "https://tempus2.xyz/api/v0"
 	}
 
-	return &Client{
+	c := &Client{
 		address: address,
 		httpc:   httpc,
+		retry:   DefaultRetryPolicy,
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
-func (c *Client) SearchPlayersAndMaps(ctx context.Context, name string) (*tempushttp.PlayersAndMapsSearchResponse, error) {
-	addr := c.address + "/search/playersAndMaps/" + name
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+type request struct {
+	// endpoint is the route pattern, shared by every request to the same
+	// API method regardless of its path parameters.
+	endpoint string
+	path     string
+	query    url.Values
+
+	// conditional requests are revalidated against the client cache with
+	// If-None-Match and If-Modified-Since, if the client has one.
+	conditional bool
+}
+
+func (r request) key() string {
+	if len(r.query) == 0 {
+		return r.path
+	}
+
+	return r.path + "?" + r.query.Encode()
+}
+
+type response struct {
+	body        []byte
+	notModified bool
+}
+
+func get[T any](ctx context.Context, c *Client, r request) (T, error) {
+	var response T
+
+	res, err := c.fetch(ctx, r)
 	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
+		return response, err
+	}
+
+	if err := c.decode(r.endpoint, res.body, &response); err != nil {
+		return response, err
 	}
 
+	return response, nil
+}
+
+func (c *Client) fetch(ctx context.Context, r request) (response, error) {
+	for attempt := 1; ; attempt++ {
+		res, retryable, err := c.do(ctx, r, attempt)
+		if err == nil {
+			return res, nil
+		}
+
+		if !retryable || attempt >= c.retry.MaxAttempts || ctx.Err() != nil {
+			return res, err
+		}
+
+		var retryAfter time.Duration
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			retryAfter = apiErr.RetryAfter
+		}
+
+		d, ok := c.retry.delay(attempt, retryAfter)
+		if !ok {
+			return res, err
+		}
+
+		if serr := sleep(ctx, d); serr != nil {
+			return res, fmt.Errorf("wait to retry: %w: %w", serr, err)
+		}
+	}
+}
+
+// do makes a single attempt at a request, reporting whether a failure is
+// worth retrying.
+func (c *Client) do(ctx context.Context, r request, attempt int) (response, bool, error) {
+	var response response
+
+	key := r.key()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.address+key, nil)
+	if err != nil {
+		return response, false, fmt.Errorf("new request: %w", err)
+	}
+
+	conditional := r.conditional && c.cache != nil
+
+	var cached CacheEntry
+
+	if conditional {
+		entry, ok, err := c.cache.Get(key)
+		if err != nil {
+			return response, false, fmt.Errorf("get cache entry: %w", err)
+		}
+
+		// a 304 is only useful with a body to reuse
+		if ok && entry.Body != nil {
+			cached = entry
+
+			if entry.ETag != "" {
+				req.Header.Set("If-None-Match", entry.ETag)
+			}
+
+			if entry.LastModified != "" {
+				req.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+	}
+
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx); err != nil {
+			return response, false, fmt.Errorf("wait for rate limit: %w", err)
+		}
+	}
+
+	if c.inflight != nil {
+		if err := c.inflight.acquire(ctx); err != nil {
+			return response, false, fmt.Errorf("wait for request slot: %w", err)
+		}
+
+		defer c.inflight.release()
+	}
+
+	info := RequestInfo{
+		Endpoint: r.endpoint,
+		Path:     key,
+		Attempt:  attempt,
+	}
+
+	start := time.Now()
+
 	res, err := c.httpc.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		info.Duration = time.Since(start)
+		info.Err = err
+		c.observe(ctx, info)
+
+		return response, isTransportTemporary(err), fmt.Errorf("do request: %w", err)
 	}
 
 	defer res.Body.Close()
 
 	b, err := io.ReadAll(res.Body)
+
+	info.StatusCode = res.StatusCode
+	info.Duration = time.Since(start)
+	info.Bytes = len(b)
+	info.Err = err
+	c.observe(ctx, info)
+
 	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+		return response, isTransportTemporary(err), fmt.Errorf("read body: %w", err)
+	}
+
+	if conditional && res.StatusCode == http.StatusNotModified && cached.Body != nil {
+		response.body = cached.Body
+		response.notModified = true
+
+		return response, false, nil
 	}
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status %d: %s", res.StatusCode, string(b))
+		err := newAPIError(r.endpoint, res, b)
+		return response, isTemporary(err), err
+	}
+
+	if conditional {
+		entry := CacheEntry{
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			Body:         b,
+		}
+
+		if entry.ETag != "" || entry.LastModified != "" {
+			if err := c.cache.Set(key, entry); err != nil {
+				return response, false, fmt.Errorf("set cache entry: %w", err)
+			}
+		}
 	}
 
-	var response tempushttp.PlayersAndMapsSearchResponse
+	response.body = b
 
-	decoder := json.NewDecoder(bytes.NewReader(b))
-	decoder.DisallowUnknownFields()
+	return response, false, nil
+}
+
+func (c *Client) SearchPlayersAndMaps(ctx context.Context, name string) (*tempushttp.PlayersAndMapsSearchResponse, error) {
+	r := request{
+		endpoint: "/search/playersAndMaps/{name}",
+		path:     "/search/playersAndMaps/" + url.PathEscape(name),
+	}
 
-	if err := decoder.Decode(&response); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+	response, err := get[tempushttp.PlayersAndMapsSearchResponse](ctx, c, r)
+	if err != nil {
+		return nil, err
 	}
 
 	return &response, nil
 }
 
 func (c *Client) GetDetailedMapList(ctx context.Context) (tempushttp.GetDetailedMapListResponse, error) {
-	addr := c.address + "/maps/detailedList"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
-	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
+	r := request{
+		endpoint:    "/maps/detailedList",
+		path:        "/maps/detailedList",
+		conditional: true,
 	}
 
-	res, err := c.httpc.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
-	}
+	return get[tempushttp.GetDetailedMapListResponse](ctx, c, r)
+}
 
-	defer res.Body.Close()
+// GetDetailedMapListIfModified revalidates the detailed map list against the
+// client cache. It returns false and a nil response when the list has not
+// changed since it was cached, without decoding it.
+func (c *Client) GetDetailedMapListIfModified(ctx context.Context) (tempushttp.GetDetailedMapListResponse, bool, error) {
+	r := request{
+		endpoint:    "/maps/detailedList",
+		path:        "/maps/detailedList",
+		conditional: true,
+	}
 
-	b, err := io.ReadAll(res.Body)
+	res, err := c.fetch(ctx, r)
 	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+		return nil, false, err
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status %d: %s", res.StatusCode, string(b))
+	if res.notModified {
+		return nil, false, nil
 	}
 
 	var response tempushttp.GetDetailedMapListResponse
 
-	decoder := json.NewDecoder(bytes.NewReader(b))
-	decoder.DisallowUnknownFields()
-
-	if err := decoder.Decode(&response); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+	if err := c.decode(r.endpoint, res.body, &response); err != nil {
+		return nil, false, err
 	}
 
-	return response, nil
+	return response, true, nil
 }
 
 func (c *Client) GetZoneRecords(ctx context.Context, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, limit uint32) (*tempushttp.ZoneRecordsResponse, error) {
-	addr := fmt.Sprintf("%s/maps/id/%d/zones/typeindex/%s/%d/records/list?limit=%d", c.address, mapID, zoneType, zoneIndex, limit)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
-	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
+	r := request{
+		endpoint: "/maps/id/{id}/zones/typeindex/{type}/{index}/records/list",
+		path:     fmt.Sprintf("/maps/id/%d/zones/typeindex/%s/%d/records/list", mapID, zoneType, zoneIndex),
+		query:    url.Values{"limit": {fmt.Sprint(limit)}},
 	}
 
-	res, err := c.httpc.Do(req)
+	response, err := get[tempushttp.ZoneRecordsResponse](ctx, c, r)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	return &response, nil
+}
 
-	b, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+// GetZoneRecordsPage returns up to limit records per class, starting at the
+// 1-based rank start.
+func (c *Client) GetZoneRecordsPage(ctx context.Context, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, start, limit uint32) (*tempushttp.ZoneRecordsResponse, error) {
+	r := request{
+		endpoint: "/maps/id/{id}/zones/typeindex/{type}/{index}/records/list",
+		path:     fmt.Sprintf("/maps/id/%d/zones/typeindex/%s/%d/records/list", mapID, zoneType, zoneIndex),
+		query: url.Values{
+			"start": {fmt.Sprint(start)},
+			"limit": {fmt.Sprint(limit)},
+		},
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status %d: %s", res.StatusCode, string(b))
+	response, err := get[tempushttp.ZoneRecordsResponse](ctx, c, r)
+	if err != nil {
+		return nil, err
 	}
 
-	var response tempushttp.ZoneRecordsResponse
-
-	decoder := json.NewDecoder(bytes.NewReader(b))
-	decoder.DisallowUnknownFields()
+	return &response, nil
+}
 
-	if err := decoder.Decode(&response); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+// ZoneRecordPages iterates over a zone's records a page at a time, in rank
+// order. Iteration stops after the first error, or once both classes return a
+// short page or the page reaches the zone's completion count.
+//
+// Pages are separate requests, so a record set between two of them can shift
+// ranks and make a player appear on both pages or on neither.
+func (c *Client) ZoneRecordPages(ctx context.Context, mapID uint64, zoneType tempushttp.ZoneType, zoneIndex uint8, pageSize uint32) iter.Seq2[*tempushttp.ZoneRecordsResponse, error] {
+	return func(yield func(*tempushttp.ZoneRecordsResponse, error) bool) {
+		if pageSize == 0 {
+			yield(nil, fmt.Errorf("page size must be greater than zero"))
+			return
+		}
+
+		for start := uint32(1); ; start += pageSize {
+			response, err := c.GetZoneRecordsPage(ctx, mapID, zoneType, zoneIndex, start, pageSize)
+			if err != nil {
+				yield(nil, fmt.Errorf("get zone records page at %d: %w", start, err))
+				return
+			}
+
+			if !yield(response, nil) {
+				return
+			}
+
+			if len(response.Results.Soldier) < int(pageSize) && len(response.Results.Demoman) < int(pageSize) {
+				return
+			}
+
+			last := int(start + pageSize - 1)
+
+			if last >= max(response.CompletionInfo.Soldier, response.CompletionInfo.Demoman) {
+				return
+			}
+		}
 	}
-
-	return &response, nil
 }
 
 type GetPlayerZoneClassCompletionData struct {
@@ -140,70 +460,221 @@ type GetPlayerZoneClassCompletionData struct {
 }
 
 func (c *Client) GetPlayerZoneClassCompletion(ctx context.Context, data GetPlayerZoneClassCompletionData) (*tempushttp.GetPlayerZoneClassCompletionResponse, error) {
-	addr := fmt.Sprintf("%s/maps/name/%s/zones/typeindex/%s/%d/records/player/%d/%d", c.address, data.MapName, data.ZoneType, data.ZoneIndex, data.PlayerID, data.Class)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	r := request{
+		endpoint: "/maps/name/{name}/zones/typeindex/{type}/{index}/records/player/{id}/{class}",
+		path:     fmt.Sprintf("/maps/name/%s/zones/typeindex/%s/%d/records/player/%d/%d", url.PathEscape(data.MapName), data.ZoneType, data.ZoneIndex, data.PlayerID, data.Class),
+	}
+
+	response, err := get[tempushttp.GetPlayerZoneClassCompletionResponse](ctx, c, r)
 	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
+		return nil, err
 	}
 
-	res, err := c.httpc.Do(req)
+	return &response, nil
+}
+
+func (c *Client) GetPlayerStats(ctx context.Context, playerID uint64) (*tempushttp.GetPlayerStatsResponse, error) {
+	r := request{
+		endpoint: "/players/id/{id}/stats",
+		path:     fmt.Sprintf("/players/id/%d/stats", playerID),
+	}
+
+	response, err := get[tempushttp.GetPlayerStatsResponse](ctx, c, r)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	return &response, nil
+}
 
-	b, err := io.ReadAll(res.Body)
+func (c *Client) GetPlayerInfo(ctx context.Context, playerID uint64) (*tempushttp.PlayerInfoResponse, error) {
+	r := request{
+		endpoint: "/players/id/{id}/info",
+		path:     fmt.Sprintf("/players/id/%d/info", playerID),
+	}
+
+	response, err := get[tempushttp.PlayerInfoResponse](ctx, c, r)
 	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+		return nil, err
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status %d: %s", res.StatusCode, string(b))
+	return &response, nil
+}
+
+type GetPlayerRecordsData struct {
+	PlayerID uint64
+	ZoneType tempushttp.ZoneType
+	Class    tempushttp.ClassType
+	Start    uint32
+	Limit    uint32
+}
+
+func (c *Client) GetPlayerRecords(ctx context.Context, data GetPlayerRecordsData) (*tempushttp.PlayerRecordsResponse, error) {
+	query := url.Values{
+		"start": {fmt.Sprint(data.Start)},
+		"limit": {fmt.Sprint(data.Limit)},
+	}
+
+	if data.ZoneType != "" {
+		query.Set("zone_type", string(data.ZoneType))
 	}
 
-	var response tempushttp.GetPlayerZoneClassCompletionResponse
+	if data.Class != 0 {
+		query.Set("class", fmt.Sprint(data.Class))
+	}
 
-	decoder := json.NewDecoder(bytes.NewReader(b))
-	decoder.DisallowUnknownFields()
+	r := request{
+		endpoint: "/players/id/{id}/records/list",
+		path:     fmt.Sprintf("/players/id/%d/records/list", data.PlayerID),
+		query:    query,
+	}
 
-	if err := decoder.Decode(&response); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+	response, err := get[tempushttp.PlayerRecordsResponse](ctx, c, r)
+	if err != nil {
+		return nil, err
 	}
 
 	return &response, nil
 }
 
-func (c *Client) GetPlayerStats(ctx context.Context, playerID uint64) (*tempushttp.GetPlayerStatsResponse, error) {
-	addr := fmt.Sprintf("%s/players/id/%d/stats", c.address, playerID)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+// PlayerRecordPages iterates over a player's records of one class, pageSize
+// at a time. Iteration stops after the first error or a short page.
+func (c *Client) PlayerRecordPages(ctx context.Context, playerID uint64, class tempushttp.ClassType, pageSize uint32) iter.Seq2[*tempushttp.PlayerRecordsResponse, error] {
+	return func(yield func(*tempushttp.PlayerRecordsResponse, error) bool) {
+		if pageSize == 0 {
+			yield(nil, fmt.Errorf("page size must be greater than zero"))
+			return
+		}
+
+		for start := uint32(1); ; start += pageSize {
+			data := GetPlayerRecordsData{
+				PlayerID: playerID,
+				Class:    class,
+				Start:    start,
+				Limit:    pageSize,
+			}
+
+			response, err := c.GetPlayerRecords(ctx, data)
+			if err != nil {
+				yield(nil, fmt.Errorf("get player records page at %d: %w", start, err))
+				return
+			}
+
+			if !yield(response, nil) {
+				return
+			}
+
+			if len(response.Records) < int(pageSize) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) GetMapOverviewByName(ctx context.Context, name string) (*tempushttp.MapOverviewResponse, error) {
+	r := request{
+		endpoint: "/maps/name/{name}/fullOverview",
+		path:     fmt.Sprintf("/maps/name/%s/fullOverview", url.PathEscape(name)),
+	}
+
+	response, err := get[tempushttp.MapOverviewResponse](ctx, c, r)
 	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
+		return nil, err
 	}
 
-	res, err := c.httpc.Do(req)
+	return &response, nil
+}
+
+func (c *Client) GetMapOverviewByID(ctx context.Context, mapID uint64) (*tempushttp.MapOverviewResponse, error) {
+	r := request{
+		endpoint: "/maps/id/{id}/fullOverview",
+		path:     fmt.Sprintf("/maps/id/%d/fullOverview", mapID),
+	}
+
+	response, err := get[tempushttp.MapOverviewResponse](ctx, c, r)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	return &response, nil
+}
 
-	b, err := io.ReadAll(res.Body)
+func (c *Client) GetMapZones(ctx context.Context, mapID uint64) (*tempushttp.MapZones, error) {
+	r := request{
+		endpoint: "/maps/id/{id}/zones",
+		path:     fmt.Sprintf("/maps/id/%d/zones", mapID),
+	}
+
+	response, err := get[tempushttp.MapZones](ctx, c, r)
 	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+		return nil, err
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status %d: %s", res.StatusCode, string(b))
+	return &response, nil
+}
+
+func (c *Client) GetActivity(ctx context.Context) (*tempushttp.ActivityResponse, error) {
+	r := request{
+		endpoint: "/activity",
+		path:     "/activity",
 	}
 
-	var response tempushttp.GetPlayerStatsResponse
+	response, err := get[tempushttp.ActivityResponse](ctx, c, r)
+	if err != nil {
+		return nil, err
+	}
 
-	decoder := json.NewDecoder(bytes.NewReader(b))
-	// decoder.DisallowUnknownFields()
+	return &response, nil
+}
+
+func (c *Client) GetOverallRanks(ctx context.Context, start uint32) (*tempushttp.RanksResponse, error) {
+	r := request{
+		endpoint: "/ranks/overall",
+		path:     "/ranks/overall",
+		query:    url.Values{"start": {fmt.Sprint(start)}},
+	}
+
+	response, err := get[tempushttp.RanksResponse](ctx, c, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (c *Client) GetClassRanks(ctx context.Context, class tempushttp.ClassType, start uint32) (*tempushttp.RanksResponse, error) {
+	r := request{
+		endpoint: "/ranks/class/{class}",
+		path:     fmt.Sprintf("/ranks/class/%d", class),
+		query:    url.Values{"start": {fmt.Sprint(start)}},
+	}
+
+	response, err := get[tempushttp.RanksResponse](ctx, c, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (c *Client) GetServerStatusList(ctx context.Context) (tempushttp.ServerStatusListResponse, error) {
+	r := request{
+		endpoint: "/servers/statusList",
+		path:     "/servers/statusList",
+	}
+
+	return get[tempushttp.ServerStatusListResponse](ctx, c, r)
+}
 
-	if err := decoder.Decode(&response); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+func (c *Client) GetDemoOverview(ctx context.Context, demoID uint64) (*tempushttp.DemoOverviewResponse, error) {
+	r := request{
+		endpoint: "/demos/id/{id}/overview",
+		path:     fmt.Sprintf("/demos/id/%d/overview", demoID),
+	}
+
+	response, err := get[tempushttp.DemoOverviewResponse](ctx, c, r)
+	if err != nil {
+		return nil, err
 	}
 
 	return &response, nil
@@ -0,0 +1,144 @@
+// Package tempusmetrics collects per-endpoint metrics from a tempushttprpc
+// client and serves them in the Prometheus text format.
+package tempusmetrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"tempus-completion/tempushttprpc"
+)
+
+// Buckets are the upper bounds, in seconds, of the request duration histogram.
+var Buckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	endpoint string
+	code     string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type Metrics struct {
+	mu sync.Mutex
+
+	requests  map[requestKey]uint64
+	bytes     map[string]uint64
+	durations map[string]*histogram
+}
+
+func New() *Metrics {
+	return &Metrics{
+		requests:  make(map[requestKey]uint64),
+		bytes:     make(map[string]uint64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// Observe records one request attempt. It is a tempushttprpc.ObserverFunc.
+func (m *Metrics) Observe(ctx context.Context, info tempushttprpc.RequestInfo) {
+	code := "error"
+	if info.StatusCode != 0 {
+		code = strconv.Itoa(info.StatusCode)
+	}
+
+	seconds := info.Duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{endpoint: info.Endpoint, code: code}]++
+	m.bytes[info.Endpoint] += uint64(info.Bytes)
+
+	h, ok := m.durations[info.Endpoint]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(Buckets))}
+		m.durations[info.Endpoint] = h
+	}
+
+	for i, le := range Buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += seconds
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m.WriteTo(w)
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	m.mu.Lock()
+
+	requests := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		requests = append(requests, k)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].endpoint != requests[j].endpoint {
+			return requests[i].endpoint < requests[j].endpoint
+		}
+
+		return requests[i].code < requests[j].code
+	})
+
+	b.WriteString("# HELP tempus_api_requests_total Requests made to the Tempus API, by endpoint and status code.\n")
+	b.WriteString("# TYPE tempus_api_requests_total counter\n")
+
+	for _, k := range requests {
+		fmt.Fprintf(&b, "tempus_api_requests_total{endpoint=%q,code=%q} %d\n", k.endpoint, k.code, m.requests[k])
+	}
+
+	endpoints := make([]string, 0, len(m.durations))
+	for endpoint := range m.durations {
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Strings(endpoints)
+
+	b.WriteString("# HELP tempus_api_response_bytes_total Response body bytes read from the Tempus API, by endpoint.\n")
+	b.WriteString("# TYPE tempus_api_response_bytes_total counter\n")
+
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&b, "tempus_api_response_bytes_total{endpoint=%q} %d\n", endpoint, m.bytes[endpoint])
+	}
+
+	b.WriteString("# HELP tempus_api_request_duration_seconds Time taken by requests to the Tempus API, by endpoint.\n")
+	b.WriteString("# TYPE tempus_api_request_duration_seconds histogram\n")
+
+	for _, endpoint := range endpoints {
+		h := m.durations[endpoint]
+
+		for i, le := range Buckets {
+			fmt.Fprintf(&b, "tempus_api_request_duration_seconds_bucket{endpoint=%q,le=%q} %d\n", endpoint, strconv.FormatFloat(le, 'g', -1, 64), h.counts[i])
+		}
+
+		fmt.Fprintf(&b, "tempus_api_request_duration_seconds_bucket{endpoint=%q,le=\"+Inf\"} %d\n", endpoint, h.count)
+		fmt.Fprintf(&b, "tempus_api_request_duration_seconds_sum{endpoint=%q} %g\n", endpoint, h.sum)
+		fmt.Fprintf(&b, "tempus_api_request_duration_seconds_count{endpoint=%q} %d\n", endpoint, h.count)
+	}
+
+	m.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+
+	return int64(n), err
+}
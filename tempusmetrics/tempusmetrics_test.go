@@ -0,0 +1,40 @@
+package tempusmetrics_test
+
+import (
+	"context"
+	"strings"
+	"tempus-completion/tempushttprpc"
+	"tempus-completion/tempusmetrics"
+	"testing"
+	"time"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	m := tempusmetrics.New()
+
+	m.Observe(context.Background(), tempushttprpc.RequestInfo{Endpoint: "/activity", StatusCode: 200, Duration: 80 * time.Millisecond, Bytes: 100})
+	m.Observe(context.Background(), tempushttprpc.RequestInfo{Endpoint: "/activity", StatusCode: 200, Duration: 3 * time.Second, Bytes: 50})
+	m.Observe(context.Background(), tempushttprpc.RequestInfo{Endpoint: "/activity", Duration: time.Second})
+
+	var b strings.Builder
+
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("write metrics: %s", err)
+	}
+
+	expected := []string{
+		`tempus_api_requests_total{endpoint="/activity",code="200"} 2`,
+		`tempus_api_requests_total{endpoint="/activity",code="error"} 1`,
+		`tempus_api_response_bytes_total{endpoint="/activity"} 150`,
+		`tempus_api_request_duration_seconds_bucket{endpoint="/activity",le="0.1"} 1`,
+		`tempus_api_request_duration_seconds_bucket{endpoint="/activity",le="1"} 2`,
+		`tempus_api_request_duration_seconds_bucket{endpoint="/activity",le="+Inf"} 3`,
+		`tempus_api_request_duration_seconds_count{endpoint="/activity"} 3`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, b.String())
+		}
+	}
+}